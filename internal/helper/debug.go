@@ -0,0 +1,153 @@
+package helper
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Debug levels, every level includes the ones before
+const (
+	// DebugRequests traces the method, URL and headers of every request
+	DebugRequests = 1
+	// DebugResponses traces the status and duration of every response
+	DebugResponses = 2
+	// DebugResults traces the results after they are parsed
+	DebugResults = 3
+)
+
+// DebugLevel sets how much is traced, 0 disables the tracing
+var DebugLevel int
+
+// DebugBody adds the request and response bodies to the trace
+var DebugBody bool
+
+// DebugWriter receives the trace, it must never be stdout as that would break the plugin output
+var DebugWriter io.Writer = os.Stderr
+
+// RedactHeaders are additional headers whose values are hidden in the trace
+var RedactHeaders []string
+
+// defaultRedactHeaders are always hidden, they contain credentials
+var defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Amz-Security-Token"}
+
+var (
+	debugMutex sync.Mutex
+	debugFile  *os.File
+)
+
+// OpenDebugFile appends the trace to the file instead of stderr
+func OpenDebugFile(path string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	debugMutex.Lock()
+	defer debugMutex.Unlock()
+	if debugFile != nil {
+		debugFile.Close()
+	}
+	debugFile = file
+	DebugWriter = file
+
+	return nil
+}
+
+// CloseDebugFile closes the file opened by OpenDebugFile and traces to stderr again
+func CloseDebugFile() {
+	debugMutex.Lock()
+	defer debugMutex.Unlock()
+	if debugFile != nil {
+		debugFile.Close()
+		debugFile = nil
+	}
+	DebugWriter = os.Stderr
+}
+
+// DebugEnabled returns true if the level is traced, the verbose flag enables the requests and responses
+func DebugEnabled(level int) bool {
+	return DebugLevel >= level || (Verbose && level <= DebugResponses)
+}
+
+// Debugf writes a line to the trace if the level is enabled
+func Debugf(level int, format string, args ...any) {
+	if !DebugEnabled(level) {
+		return
+	}
+
+	debugMutex.Lock()
+	defer debugMutex.Unlock()
+	fmt.Fprintf(DebugWriter, "[%s] %s\n", time.Now().Format("15:04:05.000"), fmt.Sprintf(format, args...))
+}
+
+// redactedHeaders returns the headers sorted by name, one per line, with the values of secret headers hidden
+func redactedHeaders(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result strings.Builder
+	for _, name := range names {
+		value := strings.Join(header[name], ", ")
+		for _, secret := range append(defaultRedactHeaders, RedactHeaders...) {
+			if strings.EqualFold(name, secret) {
+				value = "<redacted>"
+				break
+			}
+		}
+		fmt.Fprintf(&result, "\n  %s: %s", name, value)
+	}
+
+	return result.String()
+}
+
+// debugRoundTripper traces the requests and responses of the wrapped transport
+type debugRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (d *debugRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !DebugEnabled(DebugRequests) {
+		return d.next.RoundTrip(req)
+	}
+
+	Debugf(DebugRequests, "Request: %s %s%s", req.Method, req.URL.Redacted(), redactedHeaders(req.Header))
+	if DebugBody && req.Body != nil && req.GetBody != nil {
+		// GetBody returns a copy, the body itself is left for the transport
+		if body, err := req.GetBody(); err == nil {
+			content, _ := io.ReadAll(body)
+			body.Close()
+			Debugf(DebugRequests, "Request body: %s", content)
+		}
+	}
+
+	start := time.Now()
+	resp, err := d.next.RoundTrip(req)
+	duration := time.Since(start)
+	if err != nil {
+		Debugf(DebugResponses, "Response: %s %s failed after %s: %s", req.Method, req.URL.Redacted(), duration, err.Error())
+		return nil, err
+	}
+
+	Debugf(DebugResponses, "Response: %s %s returned %s after %s%s", req.Method, req.URL.Redacted(), resp.Status, duration, redactedHeaders(resp.Header))
+	if DebugBody && DebugEnabled(DebugResponses) {
+		content, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		Debugf(DebugResponses, "Response body: %s", content)
+		resp.Body = io.NopCloser(bytes.NewReader(content))
+	}
+
+	return resp, nil
+}
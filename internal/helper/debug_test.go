@@ -0,0 +1,74 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDebugRoundTripperRedactsSecrets(t *testing.T) {
+	oldDebugLevel, oldDebugBody, oldDebugWriter, oldRedactHeaders, oldCookies := DebugLevel, DebugBody, DebugWriter, RedactHeaders, Cookies
+	t.Cleanup(func() {
+		DebugLevel, DebugBody, DebugWriter, RedactHeaders, Cookies = oldDebugLevel, oldDebugBody, oldDebugWriter, oldRedactHeaders, oldCookies
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Api-Token", "response-secret")
+		fmt.Fprint(w, "up 1\n")
+	}))
+	t.Cleanup(server.Close)
+
+	var trace bytes.Buffer
+	DebugWriter = &trace
+	DebugLevel = DebugResponses
+	DebugBody = true
+	RedactHeaders = []string{"x-api-token"}
+	Cookies = []*http.Cookie{{Name: "session", Value: "cookie-secret"}}
+
+	address, _ := url.Parse(server.URL + "/metrics")
+	body, err := DoAPIRequest(context.Background(), address)
+	if err != nil {
+		t.Fatalf("DoAPIRequest returned error: %s", err)
+	}
+	if string(body) != "up 1\n" {
+		t.Errorf("body = %q, the trace must not consume it", body)
+	}
+
+	output := trace.String()
+	for _, expected := range []string{"Request: GET " + address.String(), "Cookie: <redacted>", "returned 200 OK", "X-Api-Token: <redacted>", "Response body: up 1"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("trace %q does not contain %q", output, expected)
+		}
+	}
+	for _, secret := range []string{"cookie-secret", "response-secret"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("trace %q leaks %q", output, secret)
+		}
+	}
+}
+
+func TestDebugDisabled(t *testing.T) {
+	oldDebugLevel, oldVerbose, oldDebugWriter := DebugLevel, Verbose, DebugWriter
+	t.Cleanup(func() { DebugLevel, Verbose, DebugWriter = oldDebugLevel, oldVerbose, oldDebugWriter })
+
+	var trace bytes.Buffer
+	DebugWriter = &trace
+	DebugLevel = 0
+	Verbose = false
+	Debugf(DebugRequests, "hidden")
+	if trace.Len() != 0 {
+		t.Errorf("trace without debug level: %q", trace.String())
+	}
+
+	Verbose = true
+	Debugf(DebugResponses, "shown")
+	Debugf(DebugResults, "hidden")
+	if output := trace.String(); !strings.Contains(output, "shown") || strings.Contains(output, "hidden") {
+		t.Errorf("verbose trace = %q", output)
+	}
+}
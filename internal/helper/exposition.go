@@ -0,0 +1,267 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sample is a single sample out of the prometheus text exposition or OpenMetrics format
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+	// Timestamp in milliseconds, 0 if the sample has none
+	Timestamp int64
+}
+
+// Exposition contains all samples and metric family informations of a scraped /metrics endpoint
+type Exposition struct {
+	Samples []Sample
+	Types   map[string]string
+	Help    map[string]string
+}
+
+// Select returns the samples of the metric matching all matchers
+func (e *Exposition) Select(name string, matchers []*LabelMatcher) []Sample {
+	result := []Sample{}
+	for _, sample := range e.Samples {
+		if sample.Name == name && MatchesAll(matchers, sample.Labels) {
+			result = append(result, sample)
+		}
+	}
+
+	return result
+}
+
+// LabelsKey returns a stable string representation of the labels, usable as map key
+func LabelsKey(name string, labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for label := range labels {
+		names = append(names, label)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, label := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", label, labels[label]))
+	}
+
+	return name + "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// ParseExposition parses the prometheus text exposition format. The sample lines of the OpenMetrics format are
+// compatible, its exemplars are ignored and its timestamps in seconds are converted into milliseconds.
+func ParseExposition(reader io.Reader) (*Exposition, error) {
+	exposition := &Exposition{
+		Types: map[string]string{},
+		Help:  map[string]string{},
+	}
+	openMetrics := false
+	timestamps := []float64{}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.SplitN(strings.TrimSpace(line[1:]), " ", 3)
+			switch {
+			case fields[0] == "EOF":
+				openMetrics = true
+			case len(fields) >= 3 && fields[0] == "TYPE":
+				exposition.Types[fields[1]] = strings.ToLower(fields[2])
+			case len(fields) >= 3 && fields[0] == "HELP":
+				exposition.Help[fields[1]] = fields[2]
+			}
+			continue
+		}
+
+		sample, timestamp, err := parseSampleLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNumber, err.Error())
+		}
+		exposition.Samples = append(exposition.Samples, *sample)
+		timestamps = append(timestamps, timestamp)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, timestamp := range timestamps {
+		if openMetrics {
+			timestamp *= 1000
+		}
+		exposition.Samples[i].Timestamp = int64(timestamp)
+	}
+
+	return exposition, nil
+}
+
+// ScrapeMetrics fetches and parses a /metrics endpoint
+func ScrapeMetrics(ctx context.Context, url *url.URL) (*Exposition, error) {
+	body, err := DoAPIRequest(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	exposition, err := ParseExposition(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	Debugf(DebugResults, "Parsed %d samples of %d metric families from %s", len(exposition.Samples), len(exposition.Types), url.Redacted())
+
+	return exposition, nil
+}
+
+// parseSampleLine parses 'name{label="value",...} value [timestamp] [# exemplar]', the timestamp is returned unconverted
+func parseSampleLine(line string) (*Sample, float64, error) {
+	sample := &Sample{Labels: map[string]string{}}
+
+	rest := line
+	nameEnd := strings.IndexAny(rest, "{ \t")
+	if nameEnd == -1 {
+		return nil, 0, fmt.Errorf("sample '%s' has no value", line)
+	}
+	sample.Name = rest[:nameEnd]
+	rest = rest[nameEnd:]
+
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		rest, err = parseLabels(rest[1:], sample)
+		if err != nil {
+			return nil, 0, fmt.Errorf("sample '%s': %s", line, err.Error())
+		}
+	}
+	if sample.Name == "" {
+		return nil, 0, fmt.Errorf("sample '%s' has no metric name", line)
+	}
+
+	// Exemplars are separated by ' # '
+	if index := strings.Index(rest, "#"); index != -1 {
+		rest = rest[:index]
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, 0, fmt.Errorf("sample '%s' has no valid value and timestamp", line)
+	}
+
+	value, err := parseSampleValue(fields[0])
+	if err != nil {
+		return nil, 0, fmt.Errorf("sample '%s' has an invalid value: %s", line, err.Error())
+	}
+	sample.Value = value
+
+	timestamp := 0.0
+	if len(fields) == 2 {
+		timestamp, err = strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("sample '%s' has an invalid timestamp: %s", line, err.Error())
+		}
+	}
+
+	return sample, timestamp, nil
+}
+
+// parseLabels parses the labels up to the closing brace and returns the remaining line. A quoted string without
+// value is the metric name, as used by the UTF-8 names of newer exposition formats.
+func parseLabels(rest string, sample *Sample) (string, error) {
+	for {
+		rest = strings.TrimLeft(rest, " \t,")
+		if strings.HasPrefix(rest, "}") {
+			return rest[1:], nil
+		}
+		if rest == "" {
+			return "", fmt.Errorf("labels are not closed")
+		}
+
+		var name string
+		if strings.HasPrefix(rest, "\"") {
+			quoted, remaining, err := parseQuoted(rest)
+			if err != nil {
+				return "", err
+			}
+			remaining = strings.TrimLeft(remaining, " \t")
+			if !strings.HasPrefix(remaining, "=") {
+				sample.Name = quoted
+				rest = remaining
+				continue
+			}
+			name = quoted
+			rest = remaining
+		} else {
+			end := strings.IndexAny(rest, "= \t")
+			if end <= 0 {
+				return "", fmt.Errorf("label without name")
+			}
+			name = rest[:end]
+			rest = strings.TrimLeft(rest[end:], " \t")
+		}
+
+		if !strings.HasPrefix(rest, "=") {
+			return "", fmt.Errorf("label '%s' has no value", name)
+		}
+		rest = strings.TrimLeft(rest[1:], " \t")
+		value, remaining, err := parseQuoted(rest)
+		if err != nil {
+			return "", fmt.Errorf("label '%s': %s", name, err.Error())
+		}
+		sample.Labels[name] = value
+		rest = remaining
+	}
+}
+
+// parseQuoted parses a double quoted string with the escapes \\, \" and \n
+func parseQuoted(rest string) (string, string, error) {
+	if !strings.HasPrefix(rest, "\"") {
+		return "", "", fmt.Errorf("value is not quoted")
+	}
+
+	var value strings.Builder
+	for i := 1; i < len(rest); i++ {
+		switch rest[i] {
+		case '\\':
+			if i+1 >= len(rest) {
+				return "", "", fmt.Errorf("unterminated escape sequence")
+			}
+			i++
+			switch rest[i] {
+			case 'n':
+				value.WriteByte('\n')
+			default:
+				value.WriteByte(rest[i])
+			}
+		case '"':
+			return value.String(), rest[i+1:], nil
+		default:
+			value.WriteByte(rest[i])
+		}
+	}
+
+	return "", "", fmt.Errorf("unterminated quoted string")
+}
+
+func parseSampleValue(value string) (float64, error) {
+	switch strings.ToLower(value) {
+	case "nan":
+		return math.NaN(), nil
+	case "+inf", "inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	}
+
+	return strconv.ParseFloat(value, 64)
+}
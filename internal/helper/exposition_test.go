@@ -0,0 +1,79 @@
+package helper
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseExposition(t *testing.T) {
+	input := `# HELP prometheus_remote_storage_samples_pending The number of samples pending in the queues shards to be sent to the remote storage.
+# TYPE prometheus_remote_storage_samples_pending gauge
+prometheus_remote_storage_samples_pending{remote_name="5dc8e1",url="https://aps.example/api/v1/remote_write"} 42
+node_filesystem_avail_bytes{mountpoint="/var",device="/dev/sda1"} 1.5e+09 1700000000000
+label_escapes{path="C:\\temp",quote="say \"hi\"",line="a\nb"} -Inf
+{"metric.with.dots", job="utf8"} NaN
+`
+	exposition, err := ParseExposition(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseExposition returned error: %s", err)
+	}
+
+	if len(exposition.Samples) != 4 {
+		t.Fatalf("got %d samples, want 4", len(exposition.Samples))
+	}
+	if exposition.Types["prometheus_remote_storage_samples_pending"] != "gauge" {
+		t.Errorf("type = %q, want gauge", exposition.Types["prometheus_remote_storage_samples_pending"])
+	}
+
+	pending := exposition.Select("prometheus_remote_storage_samples_pending", []*LabelMatcher{{Name: "remote_name", Operator: "=", Value: "5dc8e1"}})
+	if len(pending) != 1 || pending[0].Value != 42 {
+		t.Errorf("pending samples = %+v, want a single sample with value 42", pending)
+	}
+
+	filesystem := exposition.Samples[1]
+	if filesystem.Value != 1.5e9 || filesystem.Timestamp != 1700000000000 || filesystem.Labels["mountpoint"] != "/var" {
+		t.Errorf("unexpected filesystem sample %+v", filesystem)
+	}
+
+	escapes := exposition.Samples[2]
+	if escapes.Labels["path"] != `C:\temp` || escapes.Labels["quote"] != `say "hi"` || escapes.Labels["line"] != "a\nb" || !math.IsInf(escapes.Value, -1) {
+		t.Errorf("unexpected escaped sample %+v", escapes)
+	}
+
+	utf8 := exposition.Samples[3]
+	if utf8.Name != "metric.with.dots" || utf8.Labels["job"] != "utf8" || !math.IsNaN(utf8.Value) {
+		t.Errorf("unexpected utf8 sample %+v", utf8)
+	}
+}
+
+func TestParseExpositionOpenMetrics(t *testing.T) {
+	input := `# TYPE http_requests counter
+http_requests_total{code="200"} 1027 1700000000.5 # {trace_id="abc"} 1 1700000000.1
+# EOF
+`
+	exposition, err := ParseExposition(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseExposition returned error: %s", err)
+	}
+	if len(exposition.Samples) != 1 {
+		t.Fatalf("got %d samples, want 1", len(exposition.Samples))
+	}
+	if sample := exposition.Samples[0]; sample.Value != 1027 || sample.Timestamp != 1700000000500 {
+		t.Errorf("unexpected sample %+v", sample)
+	}
+}
+
+func TestParseExpositionErrors(t *testing.T) {
+	for _, input := range []string{
+		`metric_without_value`,
+		`metric{label="unterminated} 1`,
+		`metric{label=unquoted} 1`,
+		`metric 1 2 3`,
+		`metric abc`,
+	} {
+		if _, err := ParseExposition(strings.NewReader(input)); err == nil {
+			t.Errorf("ParseExposition(%q) did not return an error", input)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package helper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LabelMatcher matches a single label like a prometheus selector: name=value, name!=value, name=~regex or name!~regex
+type LabelMatcher struct {
+	Name     string
+	Operator string
+	Value    string
+	re       *regexp.Regexp
+}
+
+// ParseLabelMatcher parses a matcher out of its string representation, the value may be quoted
+func ParseLabelMatcher(matcher string) (*LabelMatcher, error) {
+	index := strings.IndexAny(matcher, "=!")
+	if index <= 0 {
+		return nil, fmt.Errorf("label matcher '%s' has no label name or operator", matcher)
+	}
+	name := strings.TrimSpace(matcher[:index])
+	rest := matcher[index:]
+
+	var operator string
+	for _, op := range []string{"!~", "=~", "!=", "="} {
+		if strings.HasPrefix(rest, op) {
+			operator = op
+			break
+		}
+	}
+	if operator == "" {
+		return nil, fmt.Errorf("label matcher '%s' has an unknown operator", matcher)
+	}
+
+	value := strings.TrimSpace(rest[len(operator):])
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+
+	labelMatcher := &LabelMatcher{Name: name, Operator: operator, Value: value}
+	if operator == "=~" || operator == "!~" {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("label matcher '%s' has an invalid regex: %s", matcher, err.Error())
+		}
+		labelMatcher.re = re
+	}
+
+	return labelMatcher, nil
+}
+
+// ParseLabelMatchers parses every given matcher, see ParseLabelMatcher
+func ParseLabelMatchers(matchers []string) ([]*LabelMatcher, error) {
+	result := make([]*LabelMatcher, 0, len(matchers))
+	for _, matcher := range matchers {
+		labelMatcher, err := ParseLabelMatcher(matcher)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, labelMatcher)
+	}
+
+	return result, nil
+}
+
+// Matches tests the matcher against the value of its label, a missing label is treated as empty string
+func (m *LabelMatcher) Matches(labels map[string]string) bool {
+	value := labels[m.Name]
+	switch m.Operator {
+	case "=":
+		return value == m.Value
+	case "!=":
+		return value != m.Value
+	case "=~":
+		return m.re.MatchString(value)
+	case "!~":
+		return !m.re.MatchString(value)
+	}
+
+	return false
+}
+
+// String returns the matcher in prometheus selector syntax
+func (m *LabelMatcher) String() string {
+	return fmt.Sprintf("%s%s%q", m.Name, m.Operator, m.Value)
+}
+
+// MatchesAll tests if all matchers match the labels
+func MatchesAll(matchers []*LabelMatcher, labels map[string]string) bool {
+	for _, matcher := range matchers {
+		if !matcher.Matches(labels) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -25,49 +25,103 @@ var InsecureSkipVerify bool
 // Cookies parsed into []*http.Cookie
 var Cookies []*http.Cookie
 
-// Verbose flag writes to here
+// Verbose flag writes to here, it traces the requests and responses to the DebugWriter
 var Verbose bool
 
+// Headers are added to every request, e.g. the X-Scope-OrgID tenant header of Mimir
+var Headers = http.Header{}
+
+// ParseHeaders parses 'Name: Value' pairs into Headers
+func ParseHeaders(headers []string) error {
+	for _, header := range headers {
+		name, value, found := strings.Cut(header, ":")
+		if !found || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("header '%s' is not in the format 'Name: Value'", header)
+		}
+		Headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	return nil
+}
+
 type prometheusInterceptor struct {
 	next http.RoundTripper
 }
 
-// Interceptor function used in verbose mode
+// RoundTrip sets the content type of the form encoded api requests
 func (i *prometheusInterceptor) RoundTrip(req *http.Request) (*http.Response, error) {
-	if Verbose {
-		fmt.Printf("Sending %s request to %s\n", req.Method, req.URL.String())
-		fmt.Printf("Request:\n%+v\n", req)
-		fmt.Printf("Url:\n%+v\n", req.URL)
-		fmt.Printf("Header:\n%+v\n", req.Header)
-
-		// Read and print the body content
-		if req.Body != nil {
-			bodyBytes, err := io.ReadAll(req.Body)
-			if err != nil {
-				fmt.Printf("Error reading body: %v\n", err)
-			} else {
-				fmt.Printf("Body:\n%s\n", string(bodyBytes))
-				// Restore the body for further processing
-				req.Body = io.NopCloser(strings.NewReader(string(bodyBytes)))
+	// Ensure the Content-Type is set
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return i.next.RoundTrip(req)
+}
+
+type queryParametersKey struct{}
+
+// WithQueryParameters returns a context whose requests get the additional url parameters, e.g. dedup of Thanos
+func WithQueryParameters(ctx context.Context, parameters url.Values) context.Context {
+	return context.WithValue(ctx, queryParametersKey{}, parameters)
+}
+
+// headerRoundTripper adds the configured Headers and the query parameters of the context to every request
+type headerRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (h *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	parameters, _ := req.Context().Value(queryParametersKey{}).(url.Values)
+	if len(Headers) > 0 || len(parameters) > 0 {
+		// RoundTrippers must not modify the request of the caller
+		req = req.Clone(req.Context())
+		for name, values := range Headers {
+			req.Header[name] = values
+		}
+		if len(parameters) > 0 {
+			query := req.URL.Query()
+			for name, values := range parameters {
+				query[name] = values
 			}
-		} else {
-			fmt.Printf("Body is empty\n")
+			req.URL.RawQuery = query.Encode()
 		}
 	}
 
-	// 2. Ensure the Content-Type is set
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return h.next.RoundTrip(req)
+}
 
-	return i.next.RoundTrip(req)
+// newRoundTripper creates the transport shared by all requests, timing and tracing them, adding the headers and
+// signing them if SigV4 is enabled. The exchanges are recorded into RecordDir or replayed out of ReplayDir if set.
+func newRoundTripper() (http.RoundTripper, error) {
+	if ReplayDir != "" {
+		return &timingRoundTripper{next: &headerRoundTripper{next: &debugRoundTripper{next: &replayRoundTripper{dir: ReplayDir}}}}, nil
+	}
+
+	baseTransport := http.DefaultTransport.(*http.Transport).Clone()
+	baseTransport.TLSClientConfig = &tls.Config{InsecureSkipVerify: InsecureSkipVerify}
+
+	var transport http.RoundTripper = baseTransport
+	if SigV4Enabled {
+		signingTransport, err := newSigV4RoundTripper(baseTransport)
+		if err != nil {
+			return nil, err
+		}
+		transport = signingTransport
+	}
+	if RecordDir != "" {
+		transport = &recordRoundTripper{dir: RecordDir, next: transport}
+	}
+
+	return &timingRoundTripper{next: &headerRoundTripper{next: &debugRoundTripper{next: transport}}}, nil
 }
 
 // NewAPIClientV1 will create an prometheus api client v1
 func NewAPIClientV1(address *url.URL) (v1.API, error) {
-	baseTransport := http.DefaultTransport.(*http.Transport).Clone()
-	baseTransport.TLSClientConfig = &tls.Config{InsecureSkipVerify: InsecureSkipVerify}
+	transport, err := newRoundTripper()
+	if err != nil {
+		return nil, err
+	}
 
 	interceptedTransport := &prometheusInterceptor{
-		next: baseTransport,
+		next: transport,
 	}
 
 	httpClient := &http.Client{
@@ -95,8 +149,17 @@ func NewAPIClientV1(address *url.URL) (v1.API, error) {
 
 // DoAPIRequest does the http handling for an api request
 func DoAPIRequest(ctx context.Context, url *url.URL) ([]byte, error) {
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: InsecureSkipVerify}
+	_, body, err := DoHTTPRequest(ctx, url, nil)
+
+	return body, err
+}
+
+// DoHTTPRequest does a GET request with the additional headers and returns the status code and the body
+func DoHTTPRequest(ctx context.Context, url *url.URL, header http.Header) (int, []byte, error) {
+	transport, err := newRoundTripper()
+	if err != nil {
+		return 0, nil, err
+	}
 
 	httpClient := &http.Client{
 		Transport: transport,
@@ -111,32 +174,36 @@ func DoAPIRequest(ctx context.Context, url *url.URL) ([]byte, error) {
 	// Create request with context to support timeout
 	req, err := http.NewRequestWithContext(ctx, "GET", url.String(), nil)
 	if err != nil {
-		return nil, err
+		return 0, nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
 	}
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return resp.StatusCode, nil, err
 	}
 
-	return body, nil
+	return resp.StatusCode, body, nil
 }
 
 // CheckTimestampFreshness tests if the data is still valid
 func CheckTimestampFreshness(timestamp model.Time) error {
-	return CheckTimeFreshness(time.Unix(int64(timestamp), 0))
+	return CheckTimeFreshness(timestamp.Time())
 }
 
-// CheckTimeFreshness tests if the data is still valid
+// CheckTimeFreshness tests if the data is still valid, a TimestampFreshness of zero disables the check. Replayed
+// responses are as old as their recording, so they are never checked.
 func CheckTimeFreshness(timestamp time.Time) error {
-	if TimestampFreshness == 0 {
-		return fmt.Errorf("error when checking time freshness, timestampFreshness is zero")
+	if TimestampFreshness <= 0 || ReplayDir != "" {
+		return nil
 	}
 	timeDiff := time.Since(timestamp)
 	if int(timeDiff.Seconds()) > TimestampFreshness {
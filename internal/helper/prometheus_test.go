@@ -0,0 +1,72 @@
+package helper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestCheckTimestampFreshness(t *testing.T) {
+	oldTimestampFreshness := TimestampFreshness
+	t.Cleanup(func() { TimestampFreshness = oldTimestampFreshness })
+
+	tests := []struct {
+		name      string
+		freshness int
+		age       time.Duration
+		wantError bool
+	}{
+		{name: "fresh sample", freshness: 300, age: 10 * time.Second},
+		{name: "old sample", freshness: 300, age: 10 * time.Minute, wantError: true},
+		{name: "disabled", freshness: 0, age: 10 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			TimestampFreshness = tt.freshness
+			err := CheckTimestampFreshness(model.TimeFromUnixNano(time.Now().Add(-tt.age).UnixNano()))
+			if (err != nil) != tt.wantError {
+				t.Errorf("CheckTimestampFreshness() error = %v, wantError %v", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestHeadersAndQueryParameters(t *testing.T) {
+	t.Cleanup(func() { Headers = http.Header{} })
+	if err := ParseHeaders([]string{"no header"}); err == nil {
+		t.Error("ParseHeaders accepted a header without ':'")
+	}
+	if err := ParseHeaders([]string{"X-Scope-OrgID: tenant-1"}); err != nil {
+		t.Fatalf("ParseHeaders returned error: %s", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("X-Scope-OrgID"); got != "tenant-1" {
+			t.Errorf("X-Scope-OrgID = %q, want tenant-1", got)
+		}
+		if got := r.URL.Query().Get("dedup"); got != "false" {
+			t.Errorf("dedup = %q, want false", got)
+		}
+		if got := r.URL.Query().Get("kept"); got != "1" {
+			t.Errorf("kept = %q, want 1", got)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	requestURL, _ := url.Parse(server.URL + "/ready?kept=1")
+	ctx := WithQueryParameters(context.Background(), url.Values{"dedup": {"false"}})
+	status, _, err := DoHTTPRequest(ctx, requestURL, nil)
+	if err != nil {
+		t.Fatalf("DoHTTPRequest returned error: %s", err)
+	}
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", status)
+	}
+}
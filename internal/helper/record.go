@@ -0,0 +1,231 @@
+package helper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// RecordDir saves every http exchange sanitized of secrets into this directory, if set
+var RecordDir string
+
+// ReplayDir serves the responses recorded into this directory instead of sending the requests, if set
+var ReplayDir string
+
+// volatileParameters change with every run, they are neither part of the name of a recording nor recorded
+var volatileParameters = map[string]bool{"time": true, "start": true, "end": true}
+
+// secretParameters are parts of the names of url parameters whose values are hidden in recordings
+var secretParameters = []string{"token", "password", "secret", "key", "auth"}
+
+var recordingNameChars = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+type recordedRequest struct {
+	Method     string      `json:"method"`
+	Path       string      `json:"path"`
+	Parameters url.Values  `json:"parameters,omitempty"`
+	Header     http.Header `json:"header,omitempty"`
+}
+
+type recordedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+}
+
+// recording is a single http exchange as it is saved to and loaded from disk
+type recording struct {
+	Request  recordedRequest  `json:"request"`
+	Response recordedResponse `json:"response"`
+}
+
+// sanitizedHeader returns a copy of the header with the values of secret headers hidden
+func sanitizedHeader(header http.Header) http.Header {
+	result := http.Header{}
+	for name, values := range header {
+		result[name] = values
+		for _, secret := range append(defaultRedactHeaders, RedactHeaders...) {
+			if strings.EqualFold(name, secret) {
+				result[name] = []string{"<redacted>"}
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// requestParameters returns the url and form parameters of the request without the volatile ones and with the values
+// of secret ones hidden. The body is read out of a copy, the request itself is left untouched.
+func requestParameters(req *http.Request) (url.Values, error) {
+	parameters := url.Values{}
+	for name, values := range req.URL.Query() {
+		parameters[name] = values
+	}
+
+	if req.Body != nil && req.GetBody != nil && strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+		form, err := url.ParseQuery(string(content))
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range form {
+			parameters[name] = append(parameters[name], values...)
+		}
+	}
+
+	for name := range parameters {
+		if volatileParameters[name] {
+			parameters.Del(name)
+			continue
+		}
+		for _, secret := range secretParameters {
+			if strings.Contains(strings.ToLower(name), secret) {
+				parameters[name] = []string{"<redacted>"}
+				break
+			}
+		}
+	}
+
+	return parameters, nil
+}
+
+// recordingFile returns the file of the exchange, named by the path and a hash of the method, path and parameters
+func recordingFile(dir string, request recordedRequest) string {
+	hash := sha256.Sum256([]byte(request.Method + " " + request.Path + "?" + request.Parameters.Encode()))
+	name := strings.Trim(recordingNameChars.ReplaceAllString(request.Path, "_"), "_")
+	if name == "" {
+		name = "root"
+	}
+
+	return filepath.Join(dir, fmt.Sprintf("%s_%s.json", name, hex.EncodeToString(hash[:6])))
+}
+
+// newRecordedRequest converts the request into its sanitized recording
+func newRecordedRequest(req *http.Request) (recordedRequest, error) {
+	parameters, err := requestParameters(req)
+	if err != nil {
+		return recordedRequest{}, err
+	}
+
+	return recordedRequest{
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		Parameters: parameters,
+		Header:     sanitizedHeader(req.Header),
+	}, nil
+}
+
+var recordMutex sync.Mutex
+
+// recordRoundTripper saves every exchange of the wrapped transport into the directory
+type recordRoundTripper struct {
+	dir  string
+	next http.RoundTripper
+}
+
+func (r *recordRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	request, err := newRecordedRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(content))
+
+	exchange := recording{
+		Request: request,
+		Response: recordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     sanitizedHeader(resp.Header),
+			Body:       string(content),
+		},
+	}
+	jsonBytes, err := json.MarshalIndent(exchange, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	recordMutex.Lock()
+	defer recordMutex.Unlock()
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return nil, err
+	}
+	file := recordingFile(r.dir, request)
+	if err := os.WriteFile(file, append(jsonBytes, '\n'), 0o600); err != nil {
+		return nil, err
+	}
+	Debugf(DebugRequests, "Recorded %s %s into %s", req.Method, req.URL.Redacted(), file)
+
+	return resp, nil
+}
+
+// replayRoundTripper answers every request with the response recorded into the directory, without network access
+type replayRoundTripper struct {
+	dir string
+}
+
+func (r *replayRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	request, err := newRecordedRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	file := recordingFile(r.dir, request)
+	jsonBytes, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no recorded response for %s %s?%s in %s", request.Method, request.Path, request.Parameters.Encode(), r.dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var exchange recording
+	if err := json.Unmarshal(jsonBytes, &exchange); err != nil {
+		return nil, fmt.Errorf("error parsing recording %s: %s", file, err.Error())
+	}
+	Debugf(DebugRequests, "Replayed %s %s out of %s", req.Method, req.URL.Redacted(), file)
+
+	header := exchange.Response.Header
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", exchange.Response.StatusCode, http.StatusText(exchange.Response.StatusCode)),
+		StatusCode:    exchange.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(exchange.Response.Body)),
+		ContentLength: int64(len(exchange.Response.Body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,75 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordReplay(t *testing.T) {
+	oldHeaders := Headers
+	t.Cleanup(func() {
+		Headers = oldHeaders
+		RecordDir = ""
+		ReplayDir = ""
+	})
+	Headers = http.Header{"Authorization": {"Bearer secret"}, "X-Scope-Orgid": {"tenant"}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %s", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1,"%s"]}]}}`, r.Form.Get("query"))
+	}))
+	address, _ := url.Parse(server.URL)
+	dir := t.TempDir()
+
+	RecordDir = dir
+	apiClient, err := NewAPIClientV1(address)
+	if err != nil {
+		t.Fatalf("NewAPIClientV1 returned error: %s", err)
+	}
+	if _, _, err := apiClient.Query(context.Background(), "42", time.Now()); err != nil {
+		t.Fatalf("recorded query returned error: %s", err)
+	}
+	query := address.JoinPath("/api/v1/query")
+	query.RawQuery = url.Values{"query": {"7"}, "access_token": {"secret"}}.Encode()
+	if _, err := DoAPIRequest(context.Background(), query); err != nil {
+		t.Fatalf("recorded request returned error: %s", err)
+	}
+	server.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("recorded %d exchanges, want 2", len(files))
+	}
+	for _, file := range files {
+		content, _ := os.ReadFile(file)
+		if strings.Contains(string(content), "secret") || !strings.Contains(string(content), "tenant") {
+			t.Errorf("recording %s is not sanitized: %s", file, content)
+		}
+	}
+
+	// The server is gone, the responses come out of the recordings
+	RecordDir = ""
+	ReplayDir = dir
+	apiClient, _ = NewAPIClientV1(address)
+	result, _, err := apiClient.Query(context.Background(), "42", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("replayed query returned error: %s", err)
+	}
+	if !strings.Contains(result.String(), "=> 42") {
+		t.Errorf("replayed result = %s, want 42", result)
+	}
+	if _, _, err := apiClient.Query(context.Background(), "43", time.Now()); err == nil || !strings.Contains(err.Error(), "no recorded response") {
+		t.Errorf("query without recording returned %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// SigV4Enabled turns on AWS Signature Version 4 signing for every request
+var SigV4Enabled bool
+
+// SigV4Region is the AWS region used for signing, falls back to the region of the AWS configuration
+var SigV4Region string
+
+// SigV4Service is the AWS service name used for signing, "aps" for Amazon Managed Service for Prometheus
+var SigV4Service = DefaultSigV4Service
+
+// SigV4Profile is the profile of the shared AWS configuration, falls back to AWS_PROFILE
+var SigV4Profile string
+
+// SigV4RoleARN is the role which will be assumed with the resolved credentials, if set
+var SigV4RoleARN string
+
+const (
+	// DefaultSigV4Service is the service name of Amazon Managed Service for Prometheus
+	DefaultSigV4Service = "aps"
+
+	roleSessionName = "check_prometheus"
+)
+
+// stsEndpoint overrides the regional STS endpoint, used by tests
+var stsEndpoint string
+
+type sigV4RoundTripper struct {
+	next        http.RoundTripper
+	region      string
+	service     string
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+}
+
+// newSigV4RoundTripper wraps next with a round tripper signing every request using the global SigV4 settings. The
+// credentials are resolved by the default chain of the AWS SDK: environment, shared config and credentials files
+// with their profiles, SSO and credential processes, web identity, the ECS task role and the EC2 instance profile.
+func newSigV4RoundTripper(next http.RoundTripper) (*sigV4RoundTripper, error) {
+	options := []func(*config.LoadOptions) error{}
+	if SigV4Region != "" {
+		options = append(options, config.WithRegion(SigV4Region))
+	}
+	if SigV4Profile != "" {
+		options = append(options, config.WithSharedConfigProfile(SigV4Profile))
+	}
+	awsConfig, err := config.LoadDefaultConfig(context.Background(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading the aws configuration: %s", err.Error())
+	}
+	if awsConfig.Region == "" {
+		return nil, fmt.Errorf("sigv4 signing requires a region, set --sigv4-region, AWS_REGION or the region of the profile")
+	}
+
+	credentials := awsConfig.Credentials
+	if SigV4RoleARN != "" {
+		stsClient := sts.NewFromConfig(awsConfig, func(o *sts.Options) {
+			if stsEndpoint != "" {
+				o.BaseEndpoint = aws.String(stsEndpoint)
+			}
+		})
+		credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(stsClient, SigV4RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = roleSessionName
+		}))
+	}
+
+	service := SigV4Service
+	if service == "" {
+		service = DefaultSigV4Service
+	}
+
+	return &sigV4RoundTripper{
+		next:        next,
+		region:      awsConfig.Region,
+		service:     service,
+		credentials: credentials,
+		signer:      v4.NewSigner(),
+	}, nil
+}
+
+// RoundTrip signs the request and passes it to the next round tripper
+func (s *sigV4RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	creds, err := s.credentials.Retrieve(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("error resolving aws credentials: %s", err.Error())
+	}
+
+	payload, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// RoundTrippers must not modify the original request
+	signed := req.Clone(req.Context())
+	if payload != nil {
+		signed.Body = io.NopCloser(bytes.NewReader(payload))
+	}
+	if err := s.signer.SignHTTP(req.Context(), creds, signed, hashHex(payload), s.service, s.region, time.Now()); err != nil {
+		return nil, fmt.Errorf("error signing the request: %s", err.Error())
+	}
+
+	return s.next.RoundTrip(signed)
+}
+
+// readRequestBody returns the body of the request without consuming it
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+
+	payload, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(payload))
+
+	return payload, nil
+}
+
+// hashHex returns the hex encoded sha256 of the payload, as signed in the canonical request
+func hashHex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
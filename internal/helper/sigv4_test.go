@@ -0,0 +1,193 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+var authorizationRegex = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=([^/]+)/(\d{8})/([^/]+)/([^/]+)/aws4_request, SignedHeaders=([^,]+), Signature=([0-9a-f]{64})$`)
+
+func resetSigV4(t *testing.T) {
+	t.Helper()
+	oldEnabled, oldRegion, oldService, oldProfile, oldRoleARN, oldEndpoint := SigV4Enabled, SigV4Region, SigV4Service, SigV4Profile, SigV4RoleARN, stsEndpoint
+	t.Cleanup(func() {
+		SigV4Enabled, SigV4Region, SigV4Service, SigV4Profile, SigV4RoleARN, stsEndpoint = oldEnabled, oldRegion, oldService, oldProfile, oldRoleARN, oldEndpoint
+	})
+	for _, env := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION"} {
+		t.Setenv(env, "")
+	}
+	// Neither the files of the user nor the instance metadata of the machine running the tests are used
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
+
+// verifySigV4 recomputes the signature of a received request, as the AWS endpoint would do
+func verifySigV4(r *http.Request, secrets map[string]string) error {
+	match := authorizationRegex.FindStringSubmatch(r.Header.Get("Authorization"))
+	if match == nil {
+		return fmt.Errorf("malformed authorization header %q", r.Header.Get("Authorization"))
+	}
+	accessKey, region, service, signature := match[1], match[3], match[4], match[6]
+	secret, ok := secrets[accessKey]
+	if !ok {
+		return fmt.Errorf("unknown access key %q", accessKey)
+	}
+
+	signedAt, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return err
+	}
+
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+
+	// Rebuild the request as the client has seen it
+	check, err := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), strings.NewReader(string(payload)))
+	if err != nil {
+		return err
+	}
+	for _, name := range strings.Split(match[5], ";") {
+		if name != "host" && name != "content-length" {
+			check.Header.Set(name, r.Header.Get(name))
+		}
+	}
+	creds := aws.Credentials{AccessKeyID: accessKey, SecretAccessKey: secret, SessionToken: r.Header.Get("X-Amz-Security-Token")}
+	if err := v4.NewSigner().SignHTTP(context.Background(), creds, check, hashHex(payload), service, region, signedAt); err != nil {
+		return err
+	}
+
+	expected := authorizationRegex.FindStringSubmatch(check.Header.Get("Authorization"))
+	if expected[5] != match[5] || expected[6] != signature {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	return nil
+}
+
+func TestAPIClientSignsQueries(t *testing.T) {
+	resetSigV4(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "envsecret")
+	SigV4Enabled = true
+	SigV4Region = "eu-central-1"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := verifySigV4(r, map[string]string{"AKIDENV": "envsecret"}); err != nil {
+			t.Errorf("request to %s not correctly signed: %s", r.URL.Path, err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"scalar","result":[1,"1"]}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	address, _ := url.Parse(server.URL + "/workspaces/ws-1234")
+	apiClient, err := NewAPIClientV1(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := apiClient.Query(context.Background(), `up{job="prometheus"}`, time.Now()); err != nil {
+		t.Fatalf("query failed: %s", err)
+	}
+
+	targets, _ := url.Parse(server.URL + "/workspaces/ws-1234/api/v1/targets?state=active")
+	if _, err := DoAPIRequest(context.Background(), targets); err != nil {
+		t.Fatalf("api request failed: %s", err)
+	}
+}
+
+func TestSigV4RequiresRegion(t *testing.T) {
+	resetSigV4(t)
+	SigV4Enabled = true
+
+	if _, err := NewAPIClientV1(&url.URL{Scheme: "http", Host: "localhost"}); err == nil {
+		t.Fatal("expected an error without region")
+	}
+}
+
+func TestSigV4AssumesRoleWithSharedCredentials(t *testing.T) {
+	resetSigV4(t)
+	credentialsFile := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	content := "[default]\naws_access_key_id = AKIDDEFAULT\naws_secret_access_key = defaultsecret\n\n[monitoring]\naws_access_key_id = AKIDFILE\naws_secret_access_key = filesecret\n"
+	if err := os.WriteFile(credentialsFile, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_PROFILE", "monitoring")
+
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := verifySigV4(r, map[string]string{"AKIDFILE": "filesecret"}); err != nil {
+			t.Errorf("sts request not correctly signed: %s", err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `<AssumeRoleResponse><AssumeRoleResult><Credentials><AccessKeyId>ASIAROLE</AccessKeyId><SecretAccessKey>rolesecret</SecretAccessKey><SessionToken>token</SessionToken><Expiration>2099-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`)
+	}))
+	t.Cleanup(sts.Close)
+
+	prometheus := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Security-Token") != "token" {
+			t.Errorf("session token of the assumed role missing")
+		}
+		if err := verifySigV4(r, map[string]string{"ASIAROLE": "rolesecret"}); err != nil {
+			t.Errorf("request not signed with the assumed role: %s", err)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"status":"success","data":{"activeTargets":[]}}`)
+	}))
+	t.Cleanup(prometheus.Close)
+
+	stsEndpoint = sts.URL
+	SigV4Enabled = true
+	SigV4Region = "us-west-2"
+	SigV4RoleARN = "arn:aws:iam::123456789012:role/monitoring"
+
+	targets, _ := url.Parse(prometheus.URL + "/api/v1/targets")
+	if _, err := DoAPIRequest(context.Background(), targets); err != nil {
+		t.Fatalf("api request failed: %s", err)
+	}
+}
+
+func TestSigV4RegionOfProfile(t *testing.T) {
+	resetSigV4(t)
+	content := "[profile monitoring]\nregion = ap-southeast-2\naws_access_key_id = AKIDCONFIG\naws_secret_access_key = configsecret\n"
+	if err := os.WriteFile(os.Getenv("AWS_CONFIG_FILE"), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := verifySigV4(r, map[string]string{"AKIDCONFIG": "configsecret"}); err != nil {
+			t.Errorf("request not correctly signed: %s", err)
+		}
+		if !strings.Contains(r.Header.Get("Authorization"), "/ap-southeast-2/aps/") {
+			t.Errorf("request not signed for the region of the profile: %s", r.Header.Get("Authorization"))
+		}
+		fmt.Fprint(w, `{"status":"success","data":{"activeTargets":[]}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	SigV4Enabled = true
+	SigV4Profile = "monitoring"
+	targets, _ := url.Parse(server.URL + "/api/v1/targets")
+	if _, err := DoAPIRequest(context.Background(), targets); err != nil {
+		t.Fatalf("api request failed: %s", err)
+	}
+}
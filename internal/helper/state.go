@@ -0,0 +1,120 @@
+package helper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CounterState keeps counter values between two check runs, so rates can be calculated out of single scrapes
+type CounterState struct {
+	file     string
+	previous counterStateFile
+	current  counterStateFile
+}
+
+type counterStateFile struct {
+	Timestamp time.Time          `json:"timestamp"`
+	Values    map[string]float64 `json:"values"`
+}
+
+// DefaultStateFile returns a state file in the cache directory of the user, unique for the mode and address. The
+// directory is only accessible by the user, so other users can neither read nor replace the state.
+func DefaultStateFile(mode, address string) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("no cache directory for the state file, set one with --state-file: %s", err.Error())
+	}
+	dir := filepath.Join(cacheDir, "check_prometheus")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(address))
+	return filepath.Join(dir, fmt.Sprintf("%s_%s.json", mode, hex.EncodeToString(hash[:])[:16])), nil
+}
+
+// LoadCounterState reads the values of the last run, a missing file results in an empty state
+func LoadCounterState(file string, now time.Time) (*CounterState, error) {
+	state := &CounterState{
+		file:    file,
+		current: counterStateFile{Timestamp: now, Values: map[string]float64{}},
+	}
+
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &state.previous); err != nil {
+		return nil, fmt.Errorf("state file '%s' is corrupt: %s", file, err.Error())
+	}
+
+	return state, nil
+}
+
+// Rate records the counter value and returns its per second rate since the last run.
+// False is returned if there is no previous value or the value is not finite. A decreased value is treated as
+// counter reset.
+func (s *CounterState) Rate(key string, value float64) (float64, bool) {
+	// NaN and infinite values have no rate and can't be saved as json
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+	s.current.Values[key] = value
+
+	previous, ok := s.previous.Values[key]
+	elapsed := s.current.Timestamp.Sub(s.previous.Timestamp).Seconds()
+	if !ok || elapsed <= 0 {
+		return 0, false
+	}
+
+	delta := value - previous
+	if delta < 0 {
+		delta = value
+	}
+
+	return delta / elapsed, true
+}
+
+// Elapsed returns the time since the last run, 0 if there was none
+func (s *CounterState) Elapsed() time.Duration {
+	if s.previous.Timestamp.IsZero() {
+		return 0
+	}
+
+	return s.current.Timestamp.Sub(s.previous.Timestamp)
+}
+
+// Save writes the recorded values for the next run
+func (s *CounterState) Save() error {
+	content, err := json.Marshal(s.current)
+	if err != nil {
+		return err
+	}
+
+	// Write to a new temporary file first, parallel runs should never read a half written file or share the
+	// temporary one
+	tmpFile, err := os.CreateTemp(filepath.Dir(s.file), filepath.Base(s.file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), s.file)
+}
@@ -0,0 +1,86 @@
+package helper
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDefaultStateFile(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+	t.Setenv("HOME", cacheDir)
+
+	file, err := DefaultStateFile("scrape", "http://localhost:9100")
+	if err != nil {
+		t.Fatalf("DefaultStateFile returned error: %s", err)
+	}
+	if filepath.Dir(file) != filepath.Join(cacheDir, "check_prometheus") {
+		t.Errorf("state file %s is not in the cache directory %s", file, cacheDir)
+	}
+	info, err := os.Stat(filepath.Dir(file))
+	if err != nil || info.Mode().Perm() != 0o700 {
+		t.Errorf("state directory = %v, err = %v, want only accessible by the user", info, err)
+	}
+	if other, _ := DefaultStateFile("scrape", "http://localhost:9101"); other == file {
+		t.Errorf("addresses share the state file %s", file)
+	}
+}
+
+func TestCounterStateSave(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state.json")
+	now := time.Now()
+
+	state, err := LoadCounterState(file, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("LoadCounterState returned error: %s", err)
+	}
+	if _, ok := state.Rate("requests", 100); ok {
+		t.Errorf("rate without previous run")
+	}
+	if err := state.Save(); err != nil {
+		t.Fatalf("Save returned error: %s", err)
+	}
+
+	state, err = LoadCounterState(file, now)
+	if err != nil {
+		t.Fatalf("LoadCounterState returned error: %s", err)
+	}
+	if rate, ok := state.Rate("requests", 160); !ok || rate != 1 {
+		t.Errorf("rate = %f, %t, want 1", rate, ok)
+	}
+
+	// Only the state file is left, the temporary file is renamed
+	entries, _ := os.ReadDir(filepath.Dir(file))
+	if len(entries) != 1 || entries[0].Name() != "state.json" {
+		t.Errorf("directory contains %v", entries)
+	}
+}
+
+func TestCounterStateSkipsNonFiniteValues(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state.json")
+
+	state, err := LoadCounterState(file, time.Now())
+	if err != nil {
+		t.Fatalf("LoadCounterState returned error: %s", err)
+	}
+	for key, value := range map[string]float64{"nan": math.NaN(), "inf": math.Inf(1), "-inf": math.Inf(-1)} {
+		if _, ok := state.Rate(key, value); ok {
+			t.Errorf("rate of %s", key)
+		}
+	}
+	state.Rate("requests", 100)
+	if err := state.Save(); err != nil {
+		t.Fatalf("Save returned error: %s", err)
+	}
+
+	state, err = LoadCounterState(file, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("LoadCounterState returned error: %s", err)
+	}
+	if _, ok := state.Rate("requests", 160); !ok {
+		t.Errorf("finite value of the last run was not saved")
+	}
+}
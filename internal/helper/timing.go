@@ -0,0 +1,114 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// QueryStats are the statistics prometheus returns for queries with stats=all
+type QueryStats struct {
+	Timings struct {
+		EvalTotalTime        float64 `json:"evalTotalTime"`
+		QueryPreparationTime float64 `json:"queryPreparationTime"`
+		ExecTotalTime        float64 `json:"execTotalTime"`
+	} `json:"timings"`
+	Samples struct {
+		TotalQueryableSamples int64 `json:"totalQueryableSamples"`
+		PeakSamples           int64 `json:"peakSamples"`
+	} `json:"samples"`
+}
+
+type queryStatsKey struct{}
+
+// WithQueryStats returns a context whose api responses fill the returned stats, the query has to request them with stats=all
+func WithQueryStats(ctx context.Context) (context.Context, *QueryStats) {
+	stats := &QueryStats{}
+
+	return context.WithValue(ctx, queryStatsKey{}, stats), stats
+}
+
+var (
+	timingMutex     sync.Mutex
+	requestCount    int
+	requestDuration time.Duration
+)
+
+// ResetRequestTiming forgets the requests of the last check
+func ResetRequestTiming() {
+	timingMutex.Lock()
+	defer timingMutex.Unlock()
+	requestCount = 0
+	requestDuration = 0
+}
+
+// RequestTiming returns the number of requests since the last reset and their summed up duration, from sending the
+// request until the response body is read
+func RequestTiming() (int, time.Duration) {
+	timingMutex.Lock()
+	defer timingMutex.Unlock()
+
+	return requestCount, requestDuration
+}
+
+func recordRequest(duration time.Duration) {
+	timingMutex.Lock()
+	defer timingMutex.Unlock()
+	requestCount++
+	requestDuration += duration
+}
+
+// timingRoundTripper measures the duration of every request and parses the query stats of the responses
+type timingRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (t *timingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		recordRequest(time.Since(start))
+		return nil, err
+	}
+
+	stats, _ := req.Context().Value(queryStatsKey{}).(*QueryStats)
+	if stats == nil {
+		resp.Body = &timedBody{ReadCloser: resp.Body, start: start}
+		return resp, nil
+	}
+
+	content, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	recordRequest(time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Data struct {
+			Stats *QueryStats `json:"stats"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(content, &result) == nil && result.Data.Stats != nil {
+		*stats = *result.Data.Stats
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(content))
+
+	return resp, nil
+}
+
+// timedBody records the request once its response body is closed
+type timedBody struct {
+	io.ReadCloser
+	start time.Time
+	once  sync.Once
+}
+
+func (b *timedBody) Close() error {
+	b.once.Do(func() { recordRequest(time.Since(b.start)) })
+
+	return b.ReadCloser.Close()
+}
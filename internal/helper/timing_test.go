@@ -0,0 +1,54 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+func TestRequestTimingAndQueryStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %s", err)
+		}
+		if r.Form.Get("stats") != "all" {
+			t.Errorf("stats = %q, want all", r.Form.Get("stats"))
+		}
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"scalar","result":[%d,"1"],
+			"stats":{"timings":{"evalTotalTime":0.25,"execTotalTime":0.3},"samples":{"totalQueryableSamples":1234,"peakSamples":56}}}}`, time.Now().Unix())
+	}))
+	t.Cleanup(server.Close)
+
+	ResetRequestTiming()
+	t.Cleanup(ResetRequestTiming)
+	address, _ := url.Parse(server.URL)
+	apiClient, err := NewAPIClientV1(address)
+	if err != nil {
+		t.Fatalf("NewAPIClientV1 returned error: %s", err)
+	}
+
+	ctx, stats := WithQueryStats(context.Background())
+	for i := 0; i < 2; i++ {
+		if _, _, err := apiClient.Query(ctx, "1", time.Now(), v1.WithStats(v1.AllStatsValue)); err != nil {
+			t.Fatalf("Query returned error: %s", err)
+		}
+	}
+
+	if stats.Samples.TotalQueryableSamples != 1234 || stats.Samples.PeakSamples != 56 || stats.Timings.EvalTotalTime != 0.25 {
+		t.Errorf("stats = %+v, want 1234 samples, 56 peak samples and 0.25s evaluation", *stats)
+	}
+	requests, duration := RequestTiming()
+	if requests != 2 {
+		t.Errorf("requests = %d, want 2", requests)
+	}
+	if duration < 20*time.Millisecond {
+		t.Errorf("duration = %s, want at least 20ms", duration)
+	}
+}
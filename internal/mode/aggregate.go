@@ -0,0 +1,158 @@
+package mode
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/consol-monitoring/check_x"
+	"github.com/prometheus/common/model"
+)
+
+// Aggregate evaluations, worst takes the worst state of all series
+const (
+	AggregateWorst   = "worst"
+	AggregateCount   = "count"
+	AggregatePercent = "percent"
+	AggregateQuorum  = "quorum"
+	AggregateSum     = "sum"
+	AggregateAvg     = "avg"
+	AggregateMin     = "min"
+	AggregateMax     = "max"
+)
+
+// Aggregation evaluates the state of a vector out of all its series instead of the worst series.
+// count and percent apply the warning threshold on the number of series in WARNING or worse and the critical
+// threshold on the number of series in CRITICAL, quorum applies both on the number of OK series. sum, avg, min
+// and max apply them on the aggregated value of the series.
+type Aggregation struct {
+	Mode     string
+	Warning  string
+	Critical string
+	// MinSeries and MaxSeries limit the number of series, 0 disables them. If the number is out of the limits the
+	// check gets the SeriesCountState, CRITICAL if it is not set.
+	MinSeries        int
+	MaxSeries        int
+	SeriesCountState check_x.State
+}
+
+// enabled returns true if the state is not the worst state of the series
+func (a Aggregation) enabled() bool {
+	return a.Mode != "" && a.Mode != AggregateWorst
+}
+
+// thresholds validates the mode and returns the thresholds of the aggregate
+func (a Aggregation) thresholds() (*check_x.Threshold, *check_x.Threshold, error) {
+	switch a.Mode {
+	case "", AggregateWorst, AggregateCount, AggregatePercent, AggregateQuorum, AggregateSum, AggregateAvg, AggregateMin, AggregateMax:
+	default:
+		return nil, nil, fmt.Errorf("unknown aggregation '%s', available aggregations are 'worst', 'count', 'percent', 'quorum', 'sum', 'avg', 'min' and 'max'", a.Mode)
+	}
+	if a.MaxSeries > 0 && a.MinSeries > a.MaxSeries {
+		return nil, nil, fmt.Errorf("minimum number of series %d is above the maximum %d", a.MinSeries, a.MaxSeries)
+	}
+
+	return newThresholds(a.Warning, a.Critical)
+}
+
+// checkSeriesCount returns the SeriesCountState and the problem if the number of series is out of the limits
+func (a Aggregation) checkSeriesCount(count int) (check_x.State, string) {
+	state := a.SeriesCountState
+	if state.Name == "" {
+		state = check_x.Critical
+	}
+	if a.MinSeries > 0 && count < a.MinSeries {
+		return state, fmt.Sprintf("returned %d series, expected at least %d", count, a.MinSeries)
+	}
+	if a.MaxSeries > 0 && count > a.MaxSeries {
+		return state, fmt.Sprintf("returned %d series, expected at most %d", count, a.MaxSeries)
+	}
+
+	return check_x.OK, ""
+}
+
+// evaluate returns the state of the aggregate, its summary for the first line and the states of the series as long output
+func (a Aggregation) evaluate(series []aliasSeries, warnThreshold, critThreshold *check_x.Threshold, labels *perfdataLabels, collection *check_x.PerformanceDataCollection) (check_x.State, string, string) {
+	details := ""
+	okSeries, warningSeries, criticalSeries := 0, 0, 0
+	values := []float64{}
+	for _, s := range series {
+		details += fmt.Sprintf("\n[%s] %s %s", s.State.Name, model.LabelSet(s.Labels).String(), strconv.FormatFloat(s.Value, 'g', -1, 64))
+		switch s.State.Code {
+		case check_x.OK.Code:
+			okSeries++
+		case check_x.Critical.Code:
+			criticalSeries++
+			warningSeries++
+		case check_x.Warning.Code:
+			warningSeries++
+		}
+		if !math.IsNaN(s.Value) {
+			values = append(values, s.Value)
+		}
+	}
+
+	addPerfdata := func(label string, value float64, warn, crit *check_x.Threshold) string {
+		label = labels.label(label)
+		collection.AddPerformanceDataFloat64(label, value)
+		collection.Warn(label, warn)
+		collection.Crit(label, crit)
+		collection.Min(label, 0)
+		return label
+	}
+
+	total := len(series)
+	switch a.Mode {
+	case AggregateCount, AggregatePercent:
+		warningValue, criticalValue := float64(warningSeries), float64(criticalSeries)
+		summary := fmt.Sprintf(", %d of %d series warning or worse, %d critical", warningSeries, total, criticalSeries)
+		if a.Mode == AggregatePercent {
+			warningValue, criticalValue = warningValue/float64(total)*100, criticalValue/float64(total)*100
+			summary = fmt.Sprintf(", %.4g%% of %d series warning or worse, %.4g%% critical", warningValue, total, criticalValue)
+			for _, label := range []string{addPerfdata("series_warning", warningValue, warnThreshold, nil), addPerfdata("series_critical", criticalValue, nil, critThreshold)} {
+				collection.Unit(label, "%")
+				collection.Max(label, 100)
+			}
+		} else {
+			addPerfdata("series_warning", warningValue, warnThreshold, nil)
+			addPerfdata("series_critical", criticalValue, nil, critThreshold)
+		}
+		states := check_x.States{
+			check_x.Evaluator{Warning: warnThreshold}.Evaluate(warningValue),
+			check_x.Evaluator{Critical: critThreshold}.Evaluate(criticalValue),
+		}
+		state, err := states.GetWorst()
+		if err != nil {
+			return check_x.Unknown, fmt.Sprintf(", error when picking the worst state: %s", err.Error()), details
+		}
+		return *state, summary, details
+	case AggregateQuorum:
+		addPerfdata("series_ok", float64(okSeries), warnThreshold, critThreshold)
+		state := check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(float64(okSeries))
+		return state, fmt.Sprintf(", %d of %d series OK", okSeries, total), details
+	}
+
+	aggregate := math.NaN()
+	for i, value := range values {
+		switch {
+		case i == 0:
+			aggregate = value
+		case a.Mode == AggregateMin:
+			aggregate = math.Min(aggregate, value)
+		case a.Mode == AggregateMax:
+			aggregate = math.Max(aggregate, value)
+		default:
+			aggregate += value
+		}
+	}
+	if a.Mode == AggregateAvg && len(values) > 0 {
+		aggregate /= float64(len(values))
+	}
+	label := labels.label(a.Mode)
+	collection.AddPerformanceDataFloat64(label, aggregate)
+	collection.Warn(label, warnThreshold)
+	collection.Crit(label, critThreshold)
+	state := check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(aggregate)
+
+	return state, fmt.Sprintf(", %s of %d series is %s", a.Mode, total, strconv.FormatFloat(aggregate, 'g', -1, 64)), details
+}
@@ -0,0 +1,104 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+func TestQueryAggregation(t *testing.T) {
+	now := float64(time.Now().Unix())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := []string{}
+		for i, value := range []string{"1", "1", "1", "0", "1", "1", "1", "1", "0", "1"} {
+			result = append(result, fmt.Sprintf(`{"metric":{"__name__":"up","instance":"node%02d"},"value":[%f,"%s"]}`, i, now, value))
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[%s]}}`, strings.Join(result, ","))
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	tests := []struct {
+		name        string
+		aggregation Aggregation
+		state       check_x.State
+		firstLine   string
+		perfdata    string
+	}{
+		{
+			name:      "worst",
+			state:     check_x.Critical,
+			firstLine: "Query: 'up'",
+		},
+		{
+			name:        "count",
+			aggregation: Aggregation{Mode: AggregateCount, Critical: "2"},
+			state:       check_x.OK,
+			firstLine:   "Query: 'up', 2 of 10 series warning or worse, 2 critical",
+			perfdata:    `'series_critical'=2;;2;0;`,
+		},
+		{
+			name:        "percent",
+			aggregation: Aggregation{Mode: AggregatePercent, Critical: "@20:"},
+			state:       check_x.Critical,
+			firstLine:   "Query: 'up', 20% of 10 series warning or worse, 20% critical",
+			perfdata:    `'series_critical'=20%;;@20:;0;100`,
+		},
+		{
+			name:        "quorum",
+			aggregation: Aggregation{Mode: AggregateQuorum, Warning: "9:", Critical: "6:"},
+			state:       check_x.Warning,
+			firstLine:   "Query: 'up', 8 of 10 series OK",
+			perfdata:    `'series_ok'=8;9:;6:;0;`,
+		},
+		{
+			name:        "avg",
+			aggregation: Aggregation{Mode: AggregateAvg, Critical: "0.9:"},
+			state:       check_x.Critical,
+			firstLine:   "Query: 'up', avg of 10 series is 0.8",
+			perfdata:    `'avg'=0.8;;0.9:;;`,
+		},
+		{
+			name:        "too few series",
+			aggregation: Aggregation{Mode: AggregateSum, MinSeries: 12, SeriesCountState: check_x.Warning},
+			state:       check_x.Warning,
+			firstLine:   "Query: 'up', sum of 10 series is 8, returned 10 series, expected at least 12",
+			perfdata:    `'sum'=8;;;;`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collection := check_x.NewPerformanceDataCollection()
+			state, msg, err := Query(context.Background(), address, "up", QueryOptions{Critical: "1:", Aggregation: tt.aggregation}, &collection)
+			if err != nil {
+				t.Fatalf("Query returned error: %s", err)
+			}
+			if state.Code != tt.state.Code {
+				t.Errorf("state = %s, want %s", state.Name, tt.state.Name)
+			}
+			lines := strings.Split(msg, "\n")
+			if lines[0] != tt.firstLine {
+				t.Errorf("first line = %q, want %q", lines[0], tt.firstLine)
+			}
+			if tt.aggregation.Mode != "" && (len(lines) != 11 || lines[4] != `[CRITICAL] {__name__="up", instance="node03"} 0`) {
+				t.Errorf("long output does not list the states of the series: %q", msg)
+			}
+			if perfdata := collection.PrintAllPerformanceData(); !strings.Contains(perfdata, tt.perfdata) {
+				t.Errorf("perfdata = %s, want %s", perfdata, tt.perfdata)
+			}
+		})
+	}
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, _, err := Query(context.Background(), address, "up", QueryOptions{Aggregation: Aggregation{Mode: "median"}}, &collection)
+	if err == nil || state.Code != check_x.Unknown.Code {
+		t.Errorf("unknown aggregation: state = %s, err = %v, want UNKNOWN", state.Name, err)
+	}
+}
@@ -0,0 +1,180 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/consol-monitoring/check_prometheus/internal/helper"
+	"github.com/consol-monitoring/check_x"
+	"github.com/prometheus/common/model"
+)
+
+// CertsAuto selects the expiry metrics of the blackbox exporter and the x509-certificate-exporter
+const CertsAuto = "auto"
+
+// certMetrics are the metrics with the expiry time of certificates in unix seconds selected by CertsAuto
+var certMetrics = []string{"probe_ssl_earliest_cert_expiry", "x509_cert_not_after"}
+
+type certExpiry struct {
+	labels map[string]string
+	days   float64
+	state  check_x.State
+}
+
+// certSelector builds the selector of the expiry metric, CertsAuto selects all certMetrics
+func certSelector(metric string, matchers []*helper.LabelMatcher) string {
+	if metric != CertsAuto {
+		return seriesSelector(metric, "", matchers)
+	}
+	selectors := []string{fmt.Sprintf("__name__=~%q", strings.Join(certMetrics, "|"))}
+	for _, matcher := range matchers {
+		selectors = append(selectors, matcher.String())
+	}
+
+	return "{" + strings.Join(selectors, ", ") + "}"
+}
+
+// formatDays prints the remaining days of a certificate
+func formatDays(days float64) string {
+	switch {
+	case days < 0:
+		return fmt.Sprintf("expired %.0f days ago", -days)
+	case days == 1:
+		return "expires in 1 day"
+	default:
+		return fmt.Sprintf("expires in %.0f days", days)
+	}
+}
+
+// Certs checks the expiry of certificates out of a metric whose value is the expiry time in unix seconds, like
+// probe_ssl_earliest_cert_expiry of the blackbox exporter or x509_cert_not_after of the x509-certificate-exporter.
+// The warning and critical thresholds are applied on the whole days remaining of every certificate, the certificates
+// expiring first are listed with the labels, all labels besides the metric name if none are given.
+func Certs(ctx context.Context, address *url.URL, metric string, matchers []string, labels []string, warning, critical string, maxListed int, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+	if address == nil {
+		err := fmt.Errorf("address to query is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if collection == nil {
+		err := fmt.Errorf("collection to store perf data is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	warnThreshold, critThreshold, err := newThresholds(warning, critical)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	labelMatchers, err := helper.ParseLabelMatchers(matchers)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+	if metric == "" {
+		metric = CertsAuto
+	}
+	selector := certSelector(metric, labelMatchers)
+
+	apiClient, err := helper.NewAPIClientV1(address)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error creating apiClient: %s", err.Error()), err
+	}
+	result, _, err := apiClient.Query(ctx, selector, time.Now())
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when querying: %s", err.Error()), err
+	}
+	vector, ok := result.(model.Vector)
+	if !ok {
+		err := fmt.Errorf("query '%s' returned a %s instead of a vector", selector, result.Type().String())
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+	helper.Debugf(helper.DebugResults, "Query '%s' returned %d series", selector, len(vector))
+	if len(vector) == 0 {
+		err := fmt.Errorf("no certificates found with %s", selector)
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	now := time.Now()
+	certs := make([]certExpiry, 0, len(vector))
+	states := check_x.States{check_x.OK}
+	expiring := 0
+	expired := 0
+	for _, sample := range vector {
+		expiry := time.UnixMilli(int64(float64(sample.Value) * 1000))
+		days := math.Floor(expiry.Sub(now).Hours() / 24)
+
+		certLabels := map[string]string{}
+		for name, value := range sample.Metric {
+			if name == model.MetricNameLabel {
+				continue
+			}
+			certLabels[string(name)] = string(value)
+		}
+		if len(labels) > 0 {
+			selected := map[string]string{}
+			for _, name := range labels {
+				if value, ok := certLabels[name]; ok {
+					selected[name] = value
+				}
+			}
+			certLabels = selected
+		}
+
+		certState := check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(days)
+		if certState.Code != check_x.OK.Code {
+			expiring++
+		}
+		if days < 0 {
+			expired++
+		}
+		states = append(states, certState)
+		certs = append(certs, certExpiry{labels: certLabels, days: days, state: certState})
+	}
+	sort.SliceStable(certs, func(i, j int) bool {
+		if certs[i].days != certs[j].days {
+			return certs[i].days < certs[j].days
+		}
+		return formatLabels(certs[i].labels) < formatLabels(certs[j].labels)
+	})
+
+	collection.AddPerformanceDataFloat64("soonest_days", certs[0].days)
+	collection.Warn("soonest_days", warnThreshold)
+	collection.Crit("soonest_days", critThreshold)
+	collection.AddPerformanceDataFloat64("certificates", float64(len(certs)))
+	collection.Min("certificates", 0)
+	collection.AddPerformanceDataFloat64("expiring", float64(expiring))
+	collection.Min("expiring", 0)
+	collection.AddPerformanceDataFloat64("expired", float64(expired))
+	collection.Min("expired", 0)
+
+	state, err := states.GetWorst()
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when picking the worst state out of many states: %s", err.Error()), err
+	}
+
+	msg := fmt.Sprintf("%d certificates, soonest %s %s", len(certs), formatDays(certs[0].days), formatLabels(certs[0].labels))
+	if expiring > 0 {
+		msg += fmt.Sprintf(", %d certificates expire soon", expiring)
+	}
+	if expired > 0 {
+		msg += fmt.Sprintf(", %d expired", expired)
+	}
+	details := ""
+	for i, cert := range certs {
+		if maxListed >= 0 && i >= maxListed {
+			details += fmt.Sprintf("... %d more certificates\n", len(certs)-i)
+			break
+		}
+		details += fmt.Sprintf("[%s] %s %s\n", cert.state.Name, formatLabels(cert.labels), formatDays(cert.days))
+	}
+	if details != "" {
+		msg += "\n" + strings.TrimSuffix(details, "\n")
+	}
+
+	return *state, msg, nil
+}
@@ -0,0 +1,74 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+func TestCerts(t *testing.T) {
+	now := time.Now()
+	expiry := func(days int) string {
+		return fmt.Sprintf("%d", now.Add(time.Duration(days)*24*time.Hour+time.Hour).Unix())
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %s", err)
+		}
+		if query := r.Form.Get("query"); query != `{__name__=~"probe_ssl_earliest_cert_expiry|x509_cert_not_after"}` {
+			t.Errorf("unexpected query %q", query)
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"__name__":"x509_cert_not_after","subject_CN":"api.example.com","issuer_CN":"R3"},"value":[%d,"%s"]},
+			{"metric":{"__name__":"probe_ssl_earliest_cert_expiry","instance":"https://example.com","job":"blackbox"},"value":[%d,"%s"]},
+			{"metric":{"__name__":"x509_cert_not_after","subject_CN":"old.example.com","issuer_CN":"R3"},"value":[%d,"%s"]},
+			{"metric":{"__name__":"x509_cert_not_after","subject_CN":"www.example.com","issuer_CN":"R3"},"value":[%d,"%s"]}]}}`,
+			now.Unix(), expiry(64), now.Unix(), expiry(21), now.Unix(), expiry(-3), now.Unix(), expiry(80))
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := Certs(context.Background(), address, "", nil, nil, "30:", "7:", 3, &collection)
+	if err != nil {
+		t.Fatalf("Certs returned error: %s", err)
+	}
+	if state.Code != check_x.Critical.Code {
+		t.Errorf("state = %s, want CRITICAL", state.Name)
+	}
+	expected := strings.Join([]string{
+		`4 certificates, soonest expired 3 days ago {issuer_CN="R3", subject_CN="old.example.com"}, 2 certificates expire soon, 1 expired`,
+		`[CRITICAL] {issuer_CN="R3", subject_CN="old.example.com"} expired 3 days ago`,
+		`[WARNING] {instance="https://example.com", job="blackbox"} expires in 21 days`,
+		`[OK] {issuer_CN="R3", subject_CN="api.example.com"} expires in 64 days`,
+		`... 1 more certificates`,
+	}, "\n")
+	if msg != expected {
+		t.Errorf("message = %q, want %q", msg, expected)
+	}
+	perfdata := collection.PrintAllPerformanceData()
+	for _, want := range []string{"'soonest_days'=-3;30:;7:;;", "'certificates'=4;;;0;", "'expiring'=2;;;0;", "'expired'=1;;;0;"} {
+		if !strings.Contains(perfdata, want) {
+			t.Errorf("perfdata = %s, want %s", perfdata, want)
+		}
+	}
+
+	collection = check_x.NewPerformanceDataCollection()
+	_, msg, err = Certs(context.Background(), address, "", nil, []string{"subject_CN"}, "", "", -1, &collection)
+	if err != nil || !strings.HasSuffix(msg, `[OK] {subject_CN="www.example.com"} expires in 80 days`) {
+		t.Errorf("label selection: message = %q, err = %v", msg, err)
+	}
+}
+
+func TestCertSelector(t *testing.T) {
+	if got := certSelector("ssl_cert_not_after", nil); got != `{__name__="ssl_cert_not_after"}` {
+		t.Errorf("certSelector = %s", got)
+	}
+}
@@ -0,0 +1,191 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+type scrapePoolTargets struct {
+	name     string
+	active   int
+	dropped  int
+	examples []map[string]string
+}
+
+// formatLabels prints the labels sorted by name in prometheus selector syntax
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, labels[name]))
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// collectScrapePools fetches the active and dropped targets of the given pools, or of all pools if none are given
+func collectScrapePools(ctx context.Context, address *url.URL, pools []string, maxExamples int) (map[string]*scrapePoolTargets, error) {
+	requests := []url.Values{}
+	if len(pools) == 0 {
+		requests = append(requests, url.Values{"state": []string{"any"}})
+	}
+	for _, pool := range pools {
+		requests = append(requests, url.Values{"state": []string{"any"}, "scrapePool": []string{pool}})
+	}
+
+	result := map[string]*scrapePoolTargets{}
+	getPool := func(name string) *scrapePoolTargets {
+		if _, ok := result[name]; !ok {
+			result[name] = &scrapePoolTargets{name: name}
+		}
+		return result[name]
+	}
+	for _, pool := range pools {
+		getPool(pool)
+	}
+
+	for _, params := range requests {
+		targets, err := getTargets(ctx, address, params)
+		if err != nil {
+			return nil, err
+		}
+		if targets.Status != "success" {
+			return nil, fmt.Errorf("the API target return status was %s", targets.Status)
+		}
+
+		for i := range targets.Data.ActiveTargets {
+			target := &targets.Data.ActiveTargets[i]
+			pool := target.ScrapePool
+			if pool == "" {
+				pool = target.Labels["job"]
+			}
+			getPool(pool).active++
+		}
+
+		countedDropped := map[string]int{}
+		for _, target := range targets.Data.DroppedTargets {
+			pool := target.ScrapePool
+			if pool == "" {
+				pool = target.DiscoveredLabels["job"]
+			}
+			countedDropped[pool]++
+			scrapePool := getPool(pool)
+			if len(scrapePool.examples) < maxExamples {
+				scrapePool.examples = append(scrapePool.examples, target.DiscoveredLabels)
+			}
+		}
+
+		// droppedTargetCounts is only returned by newer prometheus versions, older ones need the dropped targets to be counted
+		dropped := targets.Data.DroppedTargetCounts
+		if dropped == nil {
+			dropped = countedDropped
+		}
+		for pool, count := range dropped {
+			if scrapePool, ok := result[pool]; ok || len(pools) == 0 {
+				if !ok {
+					scrapePool = getPool(pool)
+				}
+				scrapePool.dropped = count
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// DroppedTargets checks the service discovery of the scrape pools: a pool without active targets results in zeroActiveState,
+// the warning and critical thresholds are applied on the number of dropped targets of every pool.
+func DroppedTargets(ctx context.Context, address *url.URL, pools []string, warning, critical string, zeroActiveState check_x.State, maxExamples int, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+	if address == nil {
+		err := fmt.Errorf("address to query is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if collection == nil {
+		err := fmt.Errorf("collection to store perf data is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	warnThreshold, err := check_x.NewThreshold(warning)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error creating warningThreshold from '%s' : %s", warning, err.Error()), err
+	}
+
+	critThreshold, err := check_x.NewThreshold(critical)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error creating critThreshold from '%s' : %s", critical, err.Error()), err
+	}
+
+	scrapePools, err := collectScrapePools(ctx, address, pools, maxExamples)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error getting targets out of address: %s : %s", address.String(), err.Error()), err
+	}
+
+	names := make([]string, 0, len(scrapePools))
+	for name := range scrapePools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	states := check_x.States{check_x.OK}
+	problems := []string{}
+	details := ""
+	active := 0
+	dropped := 0
+	for _, name := range names {
+		pool := scrapePools[name]
+		active += pool.active
+		dropped += pool.dropped
+
+		poolState := check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(float64(pool.dropped))
+		if poolState.Code != check_x.OK.Code {
+			problems = append(problems, fmt.Sprintf("%s has %d dropped targets", name, pool.dropped))
+		}
+		if pool.active == 0 && zeroActiveState.Code != check_x.OK.Code {
+			if worst, err := (check_x.States{poolState, zeroActiveState}).GetWorst(); err == nil {
+				poolState = *worst
+			}
+			problems = append(problems, fmt.Sprintf("%s has no active targets", name))
+		}
+		states = append(states, poolState)
+
+		details += fmt.Sprintf("[%s] Scrape Pool: %s, Active: %d, Dropped: %d\n", poolState.Name, name, pool.active, pool.dropped)
+		if poolState.Code != check_x.OK.Code {
+			for _, example := range pool.examples {
+				details += fmt.Sprintf("  dropped: %s\n", formatLabels(example))
+			}
+		}
+
+		collection.AddPerformanceDataFloat64(name+"_active", float64(pool.active))
+		collection.Min(name+"_active", 0)
+		collection.AddPerformanceDataFloat64(name+"_dropped", float64(pool.dropped))
+		collection.Warn(name+"_dropped", warnThreshold)
+		collection.Crit(name+"_dropped", critThreshold)
+		collection.Min(name+"_dropped", 0)
+	}
+
+	state, err := states.GetWorst()
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when picking the worst state out of many states: %s", err.Error()), err
+	}
+
+	msg := fmt.Sprintf("%d scrape pools with %d active and %d dropped targets", len(names), active, dropped)
+	if len(problems) > 0 {
+		msg += ", " + strings.Join(problems, ", ")
+	}
+	if details != "" {
+		msg += "\n" + strings.TrimSuffix(details, "\n")
+	}
+
+	return *state, msg, nil
+}
@@ -0,0 +1,43 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+func TestDroppedTargets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("state") != "any" {
+			t.Errorf("unexpected state parameter %q", r.URL.Query().Get("state"))
+		}
+		fmt.Fprint(w, `{"status":"success","data":{
+			"activeTargets":[{"labels":{"job":"node","instance":"db01"},"scrapePool":"node","health":"up"}],
+			"droppedTargets":[{"discoveredLabels":{"__address__":"10.0.0.1:8080","job":"kubernetes-pods"},"scrapePool":"kubernetes-pods"}],
+			"droppedTargetCounts":{"node":0,"kubernetes-pods":250}}}`)
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := DroppedTargets(context.Background(), address, nil, "", "100", check_x.Critical, 3, &collection)
+	if err != nil {
+		t.Fatalf("DroppedTargets returned error: %s", err)
+	}
+	if state.Code != check_x.Critical.Code {
+		t.Errorf("state = %s, want CRITICAL", state.Name)
+	}
+	expected := "2 scrape pools with 1 active and 250 dropped targets, kubernetes-pods has 250 dropped targets, kubernetes-pods has no active targets"
+	if firstLine := strings.Split(msg, "\n")[0]; firstLine != expected {
+		t.Errorf("message = %q, want %q", firstLine, expected)
+	}
+	if !strings.Contains(msg, `dropped: {__address__="10.0.0.1:8080", job="kubernetes-pods"}`) {
+		t.Errorf("message %q does not list the dropped example", msg)
+	}
+}
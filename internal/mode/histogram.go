@@ -0,0 +1,236 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/consol-monitoring/check_prometheus/internal/helper"
+
+	"github.com/consol-monitoring/check_x"
+	"github.com/prometheus/common/model"
+)
+
+// Histogram types the quantile query is built for, auto tries classic histograms first and falls back to native ones
+const (
+	HistogramAuto    = "auto"
+	HistogramClassic = "classic"
+	HistogramNative  = "native"
+	HistogramSummary = "summary"
+)
+
+// histogramQuery builds the quantile query for the histogram type, summaries are aggregated with max as their
+// quantiles can not be combined
+func histogramQuery(metric string, matchers []*helper.LabelMatcher, histogramType string, quantile float64, window time.Duration, groupBy []string) string {
+	selectors := []string{}
+	for _, matcher := range matchers {
+		selectors = append(selectors, matcher.String())
+	}
+	quantileString := strconv.FormatFloat(quantile, 'f', -1, 64)
+
+	switch histogramType {
+	case HistogramSummary:
+		selectors = append(selectors, fmt.Sprintf("quantile=%q", quantileString))
+		return fmt.Sprintf("max%s (%s{%s})", groupingClause(groupBy), metric, strings.Join(selectors, ", "))
+	case HistogramNative:
+		return fmt.Sprintf("histogram_quantile(%s, sum%s (rate(%s{%s}[%s])))",
+			quantileString, groupingClause(groupBy), metric, strings.Join(selectors, ", "), model.Duration(window))
+	default:
+		return fmt.Sprintf("histogram_quantile(%s, sum%s (rate(%s_bucket{%s}[%s])))",
+			quantileString, groupingClause(append([]string{"le"}, groupBy...)), metric, strings.Join(selectors, ", "), model.Duration(window))
+	}
+}
+
+func groupingClause(groupBy []string) string {
+	if len(groupBy) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" by (%s)", strings.Join(groupBy, ", "))
+}
+
+// quantileName returns the short name of a quantile, e.g. p99 for 0.99
+func quantileName(quantile float64) string {
+	return "p" + strconv.FormatFloat(quantile*100, 'f', -1, 64)
+}
+
+type histogramGroup struct {
+	metric model.Metric
+	values []float64
+}
+
+// Histogram calculates the quantiles of a histogram or summary per group and checks every quantile against the
+// thresholds. For classic and native histograms the quantiles are calculated out of the rate over the window.
+func Histogram(ctx context.Context, address *url.URL, metric string, matchers []string, histogramType string, quantiles []float64, window time.Duration, groupBy []string, warning, critical string, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+	if address == nil {
+		err := fmt.Errorf("address to query is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if collection == nil {
+		err := fmt.Errorf("collection to store perf data is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if metric == "" {
+		err := fmt.Errorf("metric name is empty")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if len(quantiles) == 0 {
+		err := fmt.Errorf("no quantile given")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+	for _, quantile := range quantiles {
+		if quantile < 0 || quantile > 1 {
+			err := fmt.Errorf("quantile %v is not between 0 and 1", quantile)
+			return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+		}
+	}
+
+	switch histogramType {
+	case "":
+		histogramType = HistogramAuto
+	case HistogramAuto, HistogramClassic, HistogramNative, HistogramSummary:
+	default:
+		err := fmt.Errorf("unknown histogram type '%s', available types are 'auto', 'classic', 'native' and 'summary'", histogramType)
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	warnThreshold, critThreshold, err := newThresholds(warning, critical)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	labelMatchers, err := helper.ParseLabelMatchers(matchers)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error parsing label matchers: %s", err.Error()), err
+	}
+
+	apiClient, err := helper.NewAPIClientV1(address)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error creating apiClient: %s", err.Error()), err
+	}
+
+	evalTime := time.Now()
+	queryQuantile := func(histogramType string, quantile float64) (model.Vector, error) {
+		query := histogramQuery(metric, labelMatchers, histogramType, quantile, window, groupBy)
+		result, _, err := apiClient.Query(ctx, query, evalTime)
+		if err != nil {
+			return nil, fmt.Errorf("query '%s' failed: %s", query, err.Error())
+		}
+		vector, ok := result.(model.Vector)
+		if !ok {
+			return nil, fmt.Errorf("query '%s' returned a %s instead of a vector", query, result.Type().String())
+		}
+		return vector, nil
+	}
+
+	groups := []*histogramGroup{}
+	groupsByKey := map[string]*histogramGroup{}
+	for i, quantile := range quantiles {
+		queryType := histogramType
+		if queryType == HistogramAuto {
+			queryType = HistogramClassic
+		}
+		vector, err := queryQuantile(queryType, quantile)
+		if err == nil && histogramType == HistogramAuto {
+			// Without _bucket series the histogram is probably a native one
+			if len(vector) == 0 {
+				queryType = HistogramNative
+				vector, err = queryQuantile(queryType, quantile)
+			}
+			if len(vector) > 0 {
+				histogramType = queryType
+			}
+		}
+		if err != nil {
+			return check_x.Unknown, fmt.Sprintf("Error when querying: %s", err.Error()), err
+		}
+
+		for _, sample := range vector {
+			if err := helper.CheckTimestampFreshness(sample.Timestamp); err != nil {
+				return check_x.Unknown, fmt.Sprintf("Error when checking sample timestamp freshness: %s", err.Error()), err
+			}
+			key := seriesKey(sample.Metric)
+			group, ok := groupsByKey[key]
+			if !ok {
+				group = &histogramGroup{metric: sample.Metric, values: make([]float64, len(quantiles))}
+				for j := range group.values {
+					group.values[j] = math.NaN()
+				}
+				groupsByKey[key] = group
+				groups = append(groups, group)
+			}
+			group.values[i] = float64(sample.Value)
+		}
+	}
+
+	if len(groups) == 0 {
+		return check_x.Unknown, fmt.Sprintf("Histogram '%s' returned no data", metric), nil
+	}
+
+	unit := metricUnit(metric)
+	states := check_x.States{check_x.OK}
+	problems := []string{}
+	details := ""
+	for _, group := range groups {
+		groupName := []string{}
+		for _, name := range groupBy {
+			groupName = append(groupName, string(group.metric[model.LabelName(name)]))
+		}
+
+		groupStates := check_x.States{check_x.OK}
+		values := []string{}
+		for i, quantile := range quantiles {
+			value := group.values[i]
+			if math.IsNaN(value) {
+				values = append(values, fmt.Sprintf("%s: no observations", quantileName(quantile)))
+				continue
+			}
+
+			perfLabel := strings.Join(append(groupName, quantileName(quantile)), "_")
+			collection.AddPerformanceDataFloat64(perfLabel, value)
+			if unit != "" {
+				collection.Unit(perfLabel, unit)
+			}
+			collection.Warn(perfLabel, warnThreshold)
+			collection.Crit(perfLabel, critThreshold)
+
+			valueState := check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(value)
+			if valueState.Code != check_x.OK.Code {
+				problems = append(problems, fmt.Sprintf("%s is %s", perfLabel, strconv.FormatFloat(value, 'g', 4, 64)+unit))
+			}
+			groupStates = append(groupStates, valueState)
+			values = append(values, fmt.Sprintf("%s: %s%s", quantileName(quantile), strconv.FormatFloat(value, 'g', 4, 64), unit))
+		}
+
+		groupState, err := groupStates.GetWorst()
+		if err != nil {
+			return check_x.Unknown, fmt.Sprintf("Error when picking the worst state out of many states: %s", err.Error()), err
+		}
+		states = append(states, *groupState)
+		if len(groupBy) > 0 {
+			details += fmt.Sprintf("[%s] %s %s\n", groupState.Name, model.LabelSet(group.metric).String(), strings.Join(values, ", "))
+		} else {
+			details += fmt.Sprintf("[%s] %s\n", groupState.Name, strings.Join(values, ", "))
+		}
+	}
+
+	state, err := states.GetWorst()
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when picking the worst state out of many states: %s", err.Error()), err
+	}
+
+	msg := fmt.Sprintf("Histogram '%s' (%s) has %d groups", metric, histogramType, len(groups))
+	if len(problems) > 0 {
+		msg += ", " + strings.Join(problems, ", ")
+	}
+	msg += "\n" + strings.TrimSuffix(details, "\n")
+
+	return *state, msg, nil
+}
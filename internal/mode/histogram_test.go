@@ -0,0 +1,118 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consol-monitoring/check_prometheus/internal/helper"
+	"github.com/consol-monitoring/check_x"
+)
+
+func TestHistogramQuery(t *testing.T) {
+	matchers, _ := helper.ParseLabelMatchers([]string{"job=api"})
+	tests := []struct {
+		histogramType string
+		expected      string
+	}{
+		{HistogramClassic, `histogram_quantile(0.99, sum by (le, handler) (rate(http_request_duration_seconds_bucket{job="api"}[5m])))`},
+		{HistogramNative, `histogram_quantile(0.99, sum by (handler) (rate(http_request_duration_seconds{job="api"}[5m])))`},
+		{HistogramSummary, `max by (handler) (http_request_duration_seconds{job="api", quantile="0.99"})`},
+	}
+	for _, tt := range tests {
+		query := histogramQuery("http_request_duration_seconds", matchers, tt.histogramType, 0.99, 5*time.Minute, []string{"handler"})
+		if query != tt.expected {
+			t.Errorf("%s query = %q, want %q", tt.histogramType, query, tt.expected)
+		}
+		if _, err := parseQuery(query); err != nil {
+			t.Errorf("%s query is invalid: %s", tt.histogramType, err)
+		}
+	}
+}
+
+func TestHistogramNativeFallback(t *testing.T) {
+	now := float64(time.Now().Unix())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %s", err)
+		}
+		query := r.Form.Get("query")
+		switch {
+		case strings.Contains(query, "_bucket"):
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		case strings.HasPrefix(query, "histogram_quantile(0.5,"):
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"job":"api"},"value":[%f,"0.02"]},
+				{"metric":{"job":"web"},"value":[%f,"NaN"]}]}}`, now, now)
+		default:
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"job":"api"},"value":[%f,"0.4"]},
+				{"metric":{"job":"web"},"value":[%f,"0.1"]}]}}`, now, now)
+		}
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := Histogram(context.Background(), address, "http_request_duration_seconds", nil, HistogramAuto, []float64{0.5, 0.99}, 5*time.Minute, []string{"job"}, "0.25", "1", &collection)
+	if err != nil {
+		t.Fatalf("Histogram returned error: %s", err)
+	}
+	if state.Code != check_x.Warning.Code {
+		t.Errorf("state = %s, want WARNING", state.Name)
+	}
+	expected := []string{
+		"Histogram 'http_request_duration_seconds' (native) has 2 groups, api_p99 is 0.4s",
+		`[WARNING] {job="api"} p50: 0.02s, p99: 0.4s`,
+		`[OK] {job="web"} p50: no observations, p99: 0.1s`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(msg, line) {
+			t.Errorf("message %q does not contain %q", msg, line)
+		}
+	}
+	perfdata := collection.PrintAllPerformanceData()
+	if !strings.Contains(perfdata, "'api_p99'=0.4s") || strings.Contains(perfdata, "web_p50") {
+		t.Errorf("unexpected perfdata %q", perfdata)
+	}
+}
+
+func TestQueryNativeHistogram(t *testing.T) {
+	now := float64(time.Now().Unix())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"__name__":"rpc_duration_seconds","job":"api"},"histogram":[%f,{"count":"120","sum":"3.5","buckets":[[0,"0.01","0.1","120"]]}]}]}}`, now)
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, _, err := Query(context.Background(), address, "rpc_duration_seconds", QueryOptions{Critical: "100"}, &collection)
+	if err != nil {
+		t.Fatalf("Query returned error: %s", err)
+	}
+	if state.Code != check_x.Critical.Code {
+		t.Errorf("state = %s, want CRITICAL", state.Name)
+	}
+	perfdata := collection.PrintAllPerformanceData()
+	for _, expected := range []string{`job:"api"}_count'=120`, `job:"api"}_sum'=3.5`} {
+		if !strings.Contains(perfdata, expected) {
+			t.Errorf("perfdata %q does not contain %q", perfdata, expected)
+		}
+	}
+
+	// The suffixes are part of the label which is truncated and made unique
+	collection = check_x.NewPerformanceDataCollection()
+	_, _, err = Query(context.Background(), address, "rpc_duration_seconds", QueryOptions{Perfdata: PerfdataOptions{Label: "{{.job}}", MaxLabelLength: 6}}, &collection)
+	if err != nil {
+		t.Fatalf("Query returned error: %s", err)
+	}
+	if perfdata := collection.PrintAllPerformanceData(); !strings.Contains(perfdata, "'api_su'=3.5") || !strings.Contains(perfdata, "'api_co'=120") {
+		t.Errorf("truncated perfdata = %q", perfdata)
+	}
+}
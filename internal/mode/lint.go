@@ -0,0 +1,248 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/consol-monitoring/check_prometheus/internal/helper"
+
+	"github.com/consol-monitoring/check_x"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// promqlParser accepts the experimental syntax too, the server decides whether it is enabled
+var promqlParser = parser.NewParser(parser.Options{
+	EnableExperimentalFunctions:  true,
+	ExperimentalDurationExpr:     true,
+	EnableExtendedRangeSelectors: true,
+	EnableBinopFillModifiers:     true,
+})
+
+var (
+	// templateActionRegex finds the text/template actions of an alias, aliasLabelRegex the labels used within them
+	templateActionRegex = regexp.MustCompile(`{{.*?}}`)
+	aliasLabelRegex     = regexp.MustCompile(`\.([a-zA-Z_][a-zA-Z0-9_]*)`)
+)
+
+// LintProblem is a finding of the PromQL linter, Position is the line:column of the finding within the query
+type LintProblem struct {
+	Position string
+	Message  string
+}
+
+func (p LintProblem) String() string {
+	return fmt.Sprintf("%s: %s", p.Position, p.Message)
+}
+
+// parseQuery parses the query with the PromQL parser of prometheus, syntax errors contain the line and column
+func parseQuery(query string) (parser.Expr, error) {
+	return promqlParser.ParseExpr(query)
+}
+
+// aliasLabels returns the labels used by the alias template, xvalue is not a label
+func aliasLabels(alias string) []string {
+	result := []string{}
+	for _, action := range templateActionRegex.FindAllString(alias, -1) {
+		for _, match := range aliasLabelRegex.FindAllStringSubmatch(action, -1) {
+			if match[1] != "xvalue" && !slices.Contains(result, match[1]) {
+				result = append(result, match[1])
+			}
+		}
+	}
+
+	return result
+}
+
+// outputAggregations returns the aggregations whose grouping decides the labels of the query result
+func outputAggregations(expr parser.Expr) []*parser.AggregateExpr {
+	switch e := expr.(type) {
+	case *parser.ParenExpr:
+		return outputAggregations(e.Expr)
+	case *parser.UnaryExpr:
+		return outputAggregations(e.Expr)
+	case *parser.BinaryExpr:
+		if e.VectorMatching != nil && e.VectorMatching.Card == parser.CardOneToMany {
+			return outputAggregations(e.RHS)
+		}
+		if e.LHS.Type() == parser.ValueTypeVector {
+			return outputAggregations(e.LHS)
+		}
+		return outputAggregations(e.RHS)
+	case *parser.Call:
+		// label_replace and label_join add labels, the grouping of their argument is not the end result
+		if e.Func.Name == "label_replace" || e.Func.Name == "label_join" {
+			return nil
+		}
+		for _, arg := range e.Args {
+			if arg.Type() == parser.ValueTypeVector {
+				return outputAggregations(arg)
+			}
+		}
+	case *parser.AggregateExpr:
+		switch e.Op {
+		case parser.TOPK, parser.BOTTOMK, parser.LIMITK, parser.LIMIT_RATIO:
+			// These select series and keep their labels
+			return outputAggregations(e.Expr)
+		}
+		return []*parser.AggregateExpr{e}
+	}
+
+	return nil
+}
+
+// droppedLabels returns the labels out of wanted which the aggregation removes from its result
+func droppedLabels(aggregation *parser.AggregateExpr, wanted []string) []string {
+	kept := slices.Clone(aggregation.Grouping)
+	if aggregation.Op == parser.COUNT_VALUES {
+		if label, ok := aggregation.Param.(*parser.StringLiteral); ok {
+			kept = append(kept, label.Val)
+		}
+	}
+
+	dropped := []string{}
+	for _, label := range wanted {
+		if label == labels.MetricName || slices.Contains(kept, label) == aggregation.Without {
+			dropped = append(dropped, label)
+		}
+	}
+
+	return dropped
+}
+
+// counterFunctionSelectors returns the selectors whose values are treated as counters, by their metric name
+func counterFunctionSelectors(expr parser.Expr) map[string][]*parser.Call {
+	selectors := map[string][]*parser.Call{}
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		call, ok := node.(*parser.Call)
+		if !ok || len(call.Args) == 0 {
+			return nil
+		}
+		switch call.Func.Name {
+		case "rate", "irate", "increase":
+		default:
+			return nil
+		}
+		matrix, ok := call.Args[0].(*parser.MatrixSelector)
+		if !ok {
+			return nil
+		}
+		selector, ok := matrix.VectorSelector.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+		name := selector.Name
+		for _, matcher := range selector.LabelMatchers {
+			if matcher.Name == labels.MetricName && matcher.Type == labels.MatchEqual {
+				name = matcher.Value
+			}
+		}
+		if name != "" {
+			selectors[name] = append(selectors[name], call)
+		}
+		return nil
+	})
+
+	return selectors
+}
+
+// lintQuery looks for common mistakes in the parsed query. Without apiClient the checks which need the metadata
+// of the metrics are skipped.
+func lintQuery(ctx context.Context, apiClient v1.API, query string, expr parser.Expr, alias string) ([]LintProblem, error) {
+	problems := []LintProblem{}
+	position := func(node parser.Node) string {
+		return node.PositionRange().StartPosInput(query, 0)
+	}
+
+	switch expr.Type() {
+	case parser.ValueTypeMatrix:
+		problems = append(problems, LintProblem{position(expr), "the query returns a range vector, its values are checked without perfdata and alias labels, use a function like last_over_time() or max_over_time() to get one value per series"})
+	case parser.ValueTypeString:
+		problems = append(problems, LintProblem{position(expr), "the query returns a string, which can not be checked"})
+	}
+
+	if wanted := aliasLabels(alias); len(wanted) > 0 {
+		for _, aggregation := range outputAggregations(expr) {
+			if dropped := droppedLabels(aggregation, wanted); len(dropped) > 0 {
+				problems = append(problems, LintProblem{position(aggregation), fmt.Sprintf("%s removes the labels %s used by the alias, add them with by (...)", aggregation.Op.String(), strings.Join(dropped, ", "))})
+			}
+		}
+	}
+
+	if apiClient != nil {
+		selectors := counterFunctionSelectors(expr)
+		names := make([]string, 0, len(selectors))
+		for name := range selectors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			metadata, err := apiClient.Metadata(ctx, name, "")
+			if err != nil {
+				return nil, fmt.Errorf("error when querying metadata of '%s': %s", name, err.Error())
+			}
+			entries := metadata[name]
+			if len(entries) == 0 || entries[0].Type != v1.MetricTypeGauge {
+				continue
+			}
+			for _, call := range selectors[name] {
+				problems = append(problems, LintProblem{position(call), fmt.Sprintf("%s() is used on the gauge %s, it only works on counters, use deriv() or delta() instead", call.Func.Name, name)})
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// Lint validates the query with the PromQL parser and warns about common mistakes, without executing it.
+// The address is optional, if it is set the metadata of the metrics is used to detect rate() on gauges.
+func Lint(ctx context.Context, address *url.URL, query, alias string, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+	if collection == nil {
+		err := fmt.Errorf("collection to store perf data is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if query == "" {
+		err := fmt.Errorf("query is empty")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	var apiClient v1.API
+	if address != nil {
+		var err error
+		apiClient, err = helper.NewAPIClientV1(address)
+		if err != nil {
+			return check_x.Unknown, fmt.Sprintf("Error creating apiClient: %s", err.Error()), err
+		}
+	}
+
+	expr, err := parseQuery(query)
+	if err != nil {
+		return check_x.Critical, fmt.Sprintf("Query: '%s' is invalid: %s", query, err.Error()), nil
+	}
+
+	problems, err := lintQuery(ctx, apiClient, query, expr, alias)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	collection.AddPerformanceDataFloat64("problems", float64(len(problems)))
+	collection.Min("problems", 0)
+
+	if len(problems) == 0 {
+		return check_x.OK, fmt.Sprintf("Query: '%s' is valid", query), nil
+	}
+
+	msg := fmt.Sprintf("Query: '%s' has %d problems", query, len(problems))
+	for _, problem := range problems {
+		msg += "\n" + problem.String()
+	}
+
+	return check_x.Warning, msg, nil
+}
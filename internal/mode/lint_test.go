@@ -0,0 +1,146 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+func TestLint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/metadata" {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+		switch r.URL.Query().Get("metric") {
+		case "node_load1":
+			fmt.Fprint(w, `{"status":"success","data":{"node_load1":[{"type":"gauge","help":"1m load average.","unit":""}]}}`)
+		default:
+			fmt.Fprint(w, `{"status":"success","data":{}}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	tests := []struct {
+		name     string
+		address  *url.URL
+		query    string
+		alias    string
+		state    check_x.State
+		expected []string
+	}{
+		{
+			name:     "valid",
+			query:    `sum by (instance) (rate(http_requests_total[5m]))`,
+			alias:    "{{.instance}}: {{.xvalue}}",
+			state:    check_x.OK,
+			expected: []string{"Query: 'sum by (instance) (rate(http_requests_total[5m]))' is valid"},
+		},
+		{
+			name:     "syntax error",
+			query:    `sum(rate(http_requests_total[5m])`,
+			state:    check_x.Critical,
+			expected: []string{"is invalid: 1:34: parse error: unclosed left parenthesis"},
+		},
+		{
+			name:     "range selector",
+			query:    `up[5m]`,
+			state:    check_x.Warning,
+			expected: []string{"1:1: the query returns a range vector"},
+		},
+		{
+			name:     "aggregation without by",
+			query:    `100 * sum(rate(errors_total[5m])) / on() group_left topk(3, requests)`,
+			alias:    "{{if gt .xvalue 1}}{{.job}}{{end}}",
+			state:    check_x.Warning,
+			expected: []string{"1:7: sum removes the labels job used by the alias"},
+		},
+		{
+			name:     "aggregation without",
+			query:    `max without (job) (up)`,
+			alias:    "{{.job}} {{.instance}}",
+			state:    check_x.Warning,
+			expected: []string{"1:1: max removes the labels job used by the alias"},
+		},
+		{
+			name:     "rate on gauge offline",
+			query:    `rate(node_load1[5m])`,
+			state:    check_x.OK,
+			expected: []string{"is valid"},
+		},
+		{
+			name:     "rate on gauge online",
+			address:  address,
+			query:    `sum(rate(node_load1[5m])) + sum(rate(http_requests_total[5m]))`,
+			state:    check_x.Warning,
+			expected: []string{"has 1 problems", "1:5: rate() is used on the gauge node_load1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collection := check_x.NewPerformanceDataCollection()
+			state, msg, err := Lint(context.Background(), tt.address, tt.query, tt.alias, &collection)
+			if err != nil {
+				t.Fatalf("Lint returned error: %s", err)
+			}
+			if state.Code != tt.state.Code {
+				t.Errorf("state = %s, want %s, message: %s", state.Name, tt.state.Name, msg)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(msg, expected) {
+					t.Errorf("message %q does not contain %q", msg, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestQuerySyntaxError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("query with a syntax error was sent to the server")
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := Query(context.Background(), address, "up{job=}", QueryOptions{Lint: true}, &collection)
+	if err == nil {
+		t.Fatalf("Query returned no error")
+	}
+	if state.Code != check_x.Unknown.Code {
+		t.Errorf("state = %s, want UNKNOWN", state.Name)
+	}
+	if !strings.HasPrefix(msg, "Error parsing query: 1:8: parse error") {
+		t.Errorf("message = %q", msg)
+	}
+}
+
+func TestQueryUnparsableWithoutLint(t *testing.T) {
+	now := time.Now().Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %s", err)
+		}
+		if query := r.Form.Get("query"); query != "up{job=}" {
+			t.Errorf("unexpected query %q", query)
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"job":"node"},"value":[%d,"1"]}]}}`, now)
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	// Other query engines accept queries the parser of prometheus rejects
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := Query(context.Background(), address, "up{job=}", QueryOptions{}, &collection)
+	if err != nil || state.Code != check_x.OK.Code {
+		t.Errorf("state = %s, message = %q, err = %v", state.Name, msg, err)
+	}
+}
@@ -0,0 +1,189 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/consol-monitoring/check_prometheus/internal/helper"
+
+	"github.com/consol-monitoring/check_x"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// seriesSelector builds a series selector for the metric, histograms and summaries also select their _bucket, _count and _sum series
+func seriesSelector(metric string, metricType v1.MetricType, matchers []*helper.LabelMatcher) string {
+	selectors := []string{}
+	switch metricType {
+	case v1.MetricTypeHistogram, v1.MetricTypeGaugeHistogram, v1.MetricTypeSummary:
+		selectors = append(selectors, fmt.Sprintf("__name__=~%q", regexp.QuoteMeta(metric)+"(_bucket|_count|_sum)?"))
+	default:
+		selectors = append(selectors, fmt.Sprintf("__name__=%q", metric))
+	}
+	for _, matcher := range matchers {
+		selectors = append(selectors, matcher.String())
+	}
+
+	return "{" + strings.Join(selectors, ", ") + "}"
+}
+
+// Metric asserts the existence of a metric: its metadata type and help text, its label names and the number of its series.
+// The warning and critical thresholds are applied on the number of series, labelWarning and labelCritical on the number
+// of distinct values of every countLabels label. Without thresholds a metric without series is critical.
+func Metric(ctx context.Context, address *url.URL, metric string, matchers []string, metricType, helpRegex string, labels, countLabels []string, warning, critical, labelWarning, labelCritical string, lookback time.Duration, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+	if address == nil {
+		err := fmt.Errorf("address to query is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if collection == nil {
+		err := fmt.Errorf("collection to store perf data is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if metric == "" {
+		err := fmt.Errorf("metric name is empty")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	warnThreshold, err := check_x.NewThreshold(warning)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error creating warningThreshold from '%s' : %s", warning, err.Error()), err
+	}
+
+	critThreshold, err := check_x.NewThreshold(critical)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error creating critThreshold from '%s' : %s", critical, err.Error()), err
+	}
+
+	labelWarnThreshold, err := check_x.NewThreshold(labelWarning)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error creating label warningThreshold from '%s' : %s", labelWarning, err.Error()), err
+	}
+
+	labelCritThreshold, err := check_x.NewThreshold(labelCritical)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error creating label critThreshold from '%s' : %s", labelCritical, err.Error()), err
+	}
+
+	var helpRe *regexp.Regexp
+	if helpRegex != "" {
+		helpRe, err = regexp.Compile(helpRegex)
+		if err != nil {
+			return check_x.Unknown, fmt.Sprintf("Error creating regex from '%s' : %s", helpRegex, err.Error()), err
+		}
+	}
+
+	labelMatchers, err := helper.ParseLabelMatchers(matchers)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error parsing label matchers: %s", err.Error()), err
+	}
+
+	apiClient, err := helper.NewAPIClientV1(address)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error creating apiClient: %s", err.Error()), err
+	}
+
+	states := check_x.States{check_x.OK}
+	problems := []string{}
+	details := ""
+
+	metadata, err := apiClient.Metadata(ctx, metric, "")
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when querying metadata: %s", err.Error()), err
+	}
+	var actualType v1.MetricType
+	if entries, ok := metadata[metric]; ok && len(entries) > 0 {
+		actualType = entries[0].Type
+		details += fmt.Sprintf("Type: %s, Help: %s\n", entries[0].Type, entries[0].Help)
+		if metricType != "" && !strings.EqualFold(string(actualType), metricType) {
+			states = append(states, check_x.Critical)
+			problems = append(problems, fmt.Sprintf("type is %s instead of %s", actualType, metricType))
+		}
+		if helpRe != nil && !helpRe.MatchString(entries[0].Help) {
+			states = append(states, check_x.Critical)
+			problems = append(problems, fmt.Sprintf("help text '%s' does not match '%s'", entries[0].Help, helpRegex))
+		}
+	} else if metricType != "" || helpRe != nil {
+		states = append(states, check_x.Critical)
+		problems = append(problems, "no metadata found")
+	}
+
+	selector := seriesSelector(metric, actualType, labelMatchers)
+	endTime := time.Now()
+	startTime := endTime.Add(-lookback)
+
+	series, _, err := apiClient.Series(ctx, []string{selector}, startTime, endTime)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when querying series: %s", err.Error()), err
+	}
+	seriesState := check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(float64(len(series)))
+	if warning == "" && critical == "" && len(series) == 0 {
+		seriesState = check_x.Critical
+	}
+	states = append(states, seriesState)
+	collection.AddPerformanceDataFloat64("series", float64(len(series)))
+	collection.Warn("series", warnThreshold)
+	collection.Crit("series", critThreshold)
+	collection.Min("series", 0)
+
+	if len(labels) > 0 {
+		labelNames, _, err := apiClient.LabelNames(ctx, []string{selector}, startTime, endTime)
+		if err != nil {
+			return check_x.Unknown, fmt.Sprintf("Error when querying label names: %s", err.Error()), err
+		}
+		present := map[string]bool{}
+		for _, name := range labelNames {
+			present[name] = true
+		}
+		missing := []string{}
+		for _, name := range labels {
+			if !present[name] {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			states = append(states, check_x.Critical)
+			problems = append(problems, fmt.Sprintf("labels missing: %s", strings.Join(missing, ", ")))
+		}
+		sort.Strings(labelNames)
+		details += fmt.Sprintf("Labels: %s\n", strings.Join(labelNames, ", "))
+	}
+
+	for _, name := range countLabels {
+		values, _, err := apiClient.LabelValues(ctx, name, []string{selector}, startTime, endTime)
+		if err != nil {
+			return check_x.Unknown, fmt.Sprintf("Error when querying values of label '%s': %s", name, err.Error()), err
+		}
+		labelState := check_x.Evaluator{Warning: labelWarnThreshold, Critical: labelCritThreshold}.Evaluate(float64(len(values)))
+		if labelState.Code != check_x.OK.Code {
+			problems = append(problems, fmt.Sprintf("label %s has %d distinct values", name, len(values)))
+		}
+		states = append(states, labelState)
+		details += fmt.Sprintf("[%s] Label: %s, Distinct Values: %d\n", labelState.Name, name, len(values))
+
+		collection.AddPerformanceDataFloat64(name+"_values", float64(len(values)))
+		collection.Warn(name+"_values", labelWarnThreshold)
+		collection.Crit(name+"_values", labelCritThreshold)
+		collection.Min(name+"_values", 0)
+	}
+
+	state, err := states.GetWorst()
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when picking the worst state out of many states: %s", err.Error()), err
+	}
+
+	msg := fmt.Sprintf("Metric '%s' has %d series", metric, len(series))
+	if len(problems) > 0 {
+		msg += ", " + strings.Join(problems, ", ")
+	}
+	if details != "" {
+		msg += "\n" + strings.TrimSuffix(details, "\n")
+	}
+
+	return *state, msg, nil
+}
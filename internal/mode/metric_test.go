@@ -0,0 +1,181 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consol-monitoring/check_prometheus/internal/helper"
+	"github.com/consol-monitoring/check_x"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+func TestSeriesSelector(t *testing.T) {
+	matchers, err := helper.ParseLabelMatchers([]string{"job=api", "instance=~db.*"})
+	if err != nil {
+		t.Fatalf("ParseLabelMatchers returned error: %s", err)
+	}
+
+	tests := []struct {
+		metric     string
+		metricType v1.MetricType
+		matchers   []*helper.LabelMatcher
+		expected   string
+	}{
+		{metric: "up", expected: `{__name__="up"}`},
+		{metric: "up", metricType: v1.MetricTypeGauge, matchers: matchers, expected: `{__name__="up", job="api", instance=~"db.*"}`},
+		{metric: "http_request_duration_seconds", metricType: v1.MetricTypeHistogram, expected: `{__name__=~"http_request_duration_seconds(_bucket|_count|_sum)?"}`},
+		{metric: "rpc_duration_seconds", metricType: v1.MetricTypeSummary, matchers: matchers[:1], expected: `{__name__=~"rpc_duration_seconds(_bucket|_count|_sum)?", job="api"}`},
+	}
+	for _, tt := range tests {
+		if got := seriesSelector(tt.metric, tt.metricType, tt.matchers); got != tt.expected {
+			t.Errorf("seriesSelector(%s, %s) = %s, want %s", tt.metric, tt.metricType, got, tt.expected)
+		}
+	}
+}
+
+// metricServer answers the metadata, series, label names and label values requests of the metric mode
+func metricServer(t *testing.T, series []map[string]string) *url.URL {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %s", err)
+		}
+		switch {
+		case r.URL.Path == "/api/v1/metadata":
+			fmt.Fprint(w, `{"status":"success","data":{"http_requests_total":[{"type":"counter","help":"Total number of HTTP requests.","unit":""}]}}`)
+		case r.URL.Path == "/api/v1/series":
+			if selector := r.Form.Get("match[]"); selector != `{__name__="http_requests_total", job="api"}` {
+				t.Errorf("unexpected selector %s", selector)
+			}
+			list := []string{}
+			for _, labels := range series {
+				pairs := []string{}
+				for name, value := range labels {
+					pairs = append(pairs, fmt.Sprintf("%q:%q", name, value))
+				}
+				list = append(list, "{"+strings.Join(pairs, ",")+"}")
+			}
+			fmt.Fprintf(w, `{"status":"success","data":[%s]}`, strings.Join(list, ","))
+		case r.URL.Path == "/api/v1/labels":
+			names := map[string]bool{}
+			for _, labels := range series {
+				for name := range labels {
+					names[name] = true
+				}
+			}
+			list := []string{}
+			for name := range names {
+				list = append(list, fmt.Sprintf("%q", name))
+			}
+			fmt.Fprintf(w, `{"status":"success","data":[%s]}`, strings.Join(list, ","))
+		case strings.HasPrefix(r.URL.Path, "/api/v1/label/"):
+			name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/label/"), "/values")
+			values := map[string]bool{}
+			for _, labels := range series {
+				if value, ok := labels[name]; ok {
+					values[value] = true
+				}
+			}
+			list := []string{}
+			for value := range values {
+				list = append(list, fmt.Sprintf("%q", value))
+			}
+			fmt.Fprintf(w, `{"status":"success","data":[%s]}`, strings.Join(list, ","))
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	return address
+}
+
+func TestMetricWithoutSeries(t *testing.T) {
+	address := metricServer(t, nil)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := Metric(context.Background(), address, "http_requests_total", []string{"job=api"}, "counter", "", nil, nil, "", "", "", "", time.Hour, &collection)
+	if err != nil {
+		t.Fatalf("Metric returned error: %s", err)
+	}
+	if state.Code != check_x.Critical.Code {
+		t.Errorf("state = %s, want CRITICAL", state.Name)
+	}
+	if !strings.HasPrefix(msg, "Metric 'http_requests_total' has 0 series\nType: counter") {
+		t.Errorf("message = %q", msg)
+	}
+	if perfdata := collection.PrintAllPerformanceData(); !strings.Contains(perfdata, "'series'=0;;;0;") {
+		t.Errorf("perfdata = %q", perfdata)
+	}
+}
+
+func TestMetricSeries(t *testing.T) {
+	address := metricServer(t, []map[string]string{
+		{"__name__": "http_requests_total", "job": "api", "instance": "api01", "code": "200"},
+		{"__name__": "http_requests_total", "job": "api", "instance": "api01", "code": "500"},
+		{"__name__": "http_requests_total", "job": "api", "instance": "api02", "code": "200"},
+	})
+
+	tests := []struct {
+		name          string
+		metricType    string
+		labels        []string
+		countLabels   []string
+		warning       string
+		labelCritical string
+		state         check_x.State
+		expected      []string
+	}{
+		{
+			name:          "counted",
+			metricType:    "counter",
+			labels:        []string{"code"},
+			countLabels:   []string{"instance"},
+			labelCritical: "2",
+			state:         check_x.OK,
+			expected:      []string{"Metric 'http_requests_total' has 3 series", "Labels: __name__, code, instance, job", "[OK] Label: instance, Distinct Values: 2"},
+		},
+		{
+			name:       "wrong type and missing label",
+			metricType: "gauge",
+			labels:     []string{"path"},
+			state:      check_x.Critical,
+			expected:   []string{"has 3 series, type is counter instead of gauge, labels missing: path"},
+		},
+		{
+			name:          "too many series and label values",
+			countLabels:   []string{"instance"},
+			warning:       "2",
+			labelCritical: "1",
+			state:         check_x.Critical,
+			expected:      []string{"has 3 series, label instance has 2 distinct values", "[CRITICAL] Label: instance"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collection := check_x.NewPerformanceDataCollection()
+			state, msg, err := Metric(context.Background(), address, "http_requests_total", []string{"job=api"}, tt.metricType, "", tt.labels, tt.countLabels, tt.warning, "", "", tt.labelCritical, time.Hour, &collection)
+			if err != nil {
+				t.Fatalf("Metric returned error: %s", err)
+			}
+			if state.Code != tt.state.Code {
+				t.Errorf("state = %s, want %s", state.Name, tt.state.Name)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(msg, expected) {
+					t.Errorf("message %q does not contain %q", msg, expected)
+				}
+			}
+			if perfdata := collection.PrintAllPerformanceData(); !strings.Contains(perfdata, "'series'=3;") {
+				t.Errorf("perfdata = %q", perfdata)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package mode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/consol-monitoring/check_prometheus/internal/helper"
+	"github.com/consol-monitoring/check_x"
+)
+
+// DefaultRingPath is the path of the ingester ring status page of Mimir
+const DefaultRingPath = "/ingester/ring"
+
+// mimirURL returns the address with the path appended
+func mimirURL(address *url.URL, urlPath string) (*url.URL, error) {
+	result, err := url.Parse(address.String())
+	if err != nil {
+		return nil, err
+	}
+	result.Path = path.Join(result.Path, urlPath)
+
+	return result, nil
+}
+
+// MimirReady checks the /ready endpoint of a Mimir component, every other status code than 200 is CRITICAL
+func MimirReady(ctx context.Context, address *url.URL, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+	if address == nil {
+		err := fmt.Errorf("address to query is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if collection == nil {
+		err := fmt.Errorf("collection to store perf data is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	readyURL, err := mimirURL(address, "/ready")
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	status, body, err := helper.DoHTTPRequest(ctx, readyURL, nil)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error getting the ready state out of address: %s : %s", address.String(), err.Error()), err
+	}
+
+	if status != http.StatusOK {
+		return check_x.Critical, fmt.Sprintf("Mimir is not ready, status %d: %s", status, strings.TrimSpace(string(body))), nil
+	}
+
+	return check_x.OK, "Mimir is ready", nil
+}
+
+type ringMember struct {
+	ID                  string    `json:"id"`
+	State               string    `json:"state"`
+	Address             string    `json:"address"`
+	HeartbeatTimestamp  time.Time `json:"timestamp"`
+	RegisteredTimestamp time.Time `json:"registered_timestamp"`
+	Zone                string    `json:"zone"`
+}
+
+type ringStatus struct {
+	Members []ringMember `json:"shards"`
+	Now     time.Time    `json:"now"`
+}
+
+// getRing fetches the json representation of a ring status page
+func getRing(ctx context.Context, address *url.URL, ringPath string) (*ringStatus, error) {
+	if ringPath == "" {
+		ringPath = DefaultRingPath
+	}
+	ringURL, err := mimirURL(address, ringPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without the accept header the ring is rendered as html page
+	status, body, err := helper.DoHTTPRequest(ctx, ringURL, http.Header{"Accept": {"application/json"}})
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", status, strings.TrimSpace(string(body)))
+	}
+
+	var ring ringStatus
+	if err := json.Unmarshal(body, &ring); err != nil {
+		return nil, err
+	}
+
+	return &ring, nil
+}
+
+// MimirRing checks the members of a hash ring like the one of the ingesters: members which are not ACTIVE or whose last
+// heartbeat is older than heartbeatTimeout are unhealthy. The warning and critical thresholds are applied on the
+// number of unhealthy members.
+func MimirRing(ctx context.Context, address *url.URL, ringPath string, heartbeatTimeout time.Duration, warning, critical string, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+	if address == nil {
+		err := fmt.Errorf("address to query is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if collection == nil {
+		err := fmt.Errorf("collection to store perf data is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	warnThreshold, critThreshold, err := newThresholds(warning, critical)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	ring, err := getRing(ctx, address, ringPath)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error getting the ring out of address: %s : %s", address.String(), err.Error()), err
+	}
+
+	// The heartbeats are compared to the time of the ring, to not depend on the clock of this host
+	now := ring.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	sort.Slice(ring.Members, func(i, j int) bool { return ring.Members[i].ID < ring.Members[j].ID })
+	perState := map[string]int{}
+	zones := map[string]bool{}
+	details := ""
+	unhealthy := 0
+	for _, member := range ring.Members {
+		perState[member.State]++
+		if member.Zone != "" {
+			zones[member.Zone] = true
+		}
+
+		heartbeatAge := now.Sub(member.HeartbeatTimestamp)
+		problems := []string{}
+		if member.State != "ACTIVE" {
+			problems = append(problems, member.State)
+		}
+		if heartbeatTimeout > 0 && heartbeatAge > heartbeatTimeout {
+			problems = append(problems, fmt.Sprintf("last heartbeat %s ago", heartbeatAge.Round(time.Second)))
+		}
+		if len(problems) == 0 {
+			continue
+		}
+		unhealthy++
+
+		location := member.Address
+		if member.Zone != "" {
+			location = member.Zone + ", " + location
+		}
+		details += fmt.Sprintf("  %s (%s): %s\n", member.ID, location, strings.Join(problems, ", "))
+	}
+
+	state := check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(float64(unhealthy))
+
+	collection.AddPerformanceDataFloat64("members", float64(len(ring.Members)))
+	collection.Min("members", 0)
+	collection.AddPerformanceDataFloat64("unhealthy", float64(unhealthy))
+	collection.Warn("unhealthy", warnThreshold)
+	collection.Crit("unhealthy", critThreshold)
+	collection.Min("unhealthy", 0)
+
+	states := make([]string, 0, len(perState))
+	for memberState := range perState {
+		states = append(states, memberState)
+	}
+	sort.Strings(states)
+	counts := make([]string, 0, len(states))
+	for _, memberState := range states {
+		counts = append(counts, fmt.Sprintf("%d %s", perState[memberState], memberState))
+	}
+
+	msg := fmt.Sprintf("Ring has %d members", len(ring.Members))
+	if len(zones) > 0 {
+		msg += fmt.Sprintf(" in %d zones", len(zones))
+	}
+	if len(counts) > 0 {
+		msg += " (" + strings.Join(counts, ", ") + ")"
+	}
+	msg += fmt.Sprintf(", %d unhealthy", unhealthy)
+	if details != "" {
+		msg += "\n" + strings.TrimSuffix(details, "\n")
+	}
+
+	return state, msg, nil
+}
+
+type mimirBuildInfo struct {
+	Application string `json:"application"`
+	Version     string `json:"version"`
+	Revision    string `json:"revision"`
+	Branch      string `json:"branch"`
+	GoVersion   string `json:"goVersion"`
+}
+
+// MimirBuildInfo reports the version out of the buildinfo endpoint, a version not matching the versionRegex is CRITICAL.
+// Mimir returns the build information next to the status, prometheus compatible servers inside of data.
+func MimirBuildInfo(ctx context.Context, address *url.URL, versionRegex string, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+	if address == nil {
+		err := fmt.Errorf("address to query is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if collection == nil {
+		err := fmt.Errorf("collection to store perf data is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	var versionRe *regexp.Regexp
+	if versionRegex != "" {
+		re, err := regexp.Compile(versionRegex)
+		if err != nil {
+			return check_x.Unknown, fmt.Sprintf("Error creating regex from '%s' : %s", versionRegex, err.Error()), err
+		}
+		versionRe = re
+	}
+
+	buildInfoURL, err := mimirURL(address, "/api/v1/status/buildinfo")
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+	jsonBytes, err := helper.DoAPIRequest(ctx, buildInfoURL)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error getting the build info out of address: %s : %s", address.String(), err.Error()), err
+	}
+
+	var response struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		mimirBuildInfo
+		Data *mimirBuildInfo `json:"data"`
+	}
+	if err := json.Unmarshal(jsonBytes, &response); err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error parsing the build info: %s", err.Error()), err
+	}
+	if response.Status != "success" {
+		err := fmt.Errorf("the API buildinfo return status was %s: %s", response.Status, response.Error)
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+	buildInfo := response.mimirBuildInfo
+	if response.Data != nil {
+		buildInfo = *response.Data
+	}
+	if buildInfo.Application == "" {
+		buildInfo.Application = "Version"
+	}
+
+	msg := fmt.Sprintf("%s %s, revision %s, branch %s, %s", buildInfo.Application, buildInfo.Version, buildInfo.Revision, buildInfo.Branch, buildInfo.GoVersion)
+	if versionRe != nil && !versionRe.MatchString(buildInfo.Version) {
+		return check_x.Critical, msg + fmt.Sprintf(", version does not match '%s'", versionRegex), nil
+	}
+
+	return check_x.OK, msg, nil
+}
@@ -0,0 +1,103 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+func TestMimirReady(t *testing.T) {
+	ready := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ready" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, "Ingester not ready: waiting for 15s after being ready")
+			return
+		}
+		fmt.Fprintln(w, "ready")
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := MimirReady(context.Background(), address, &collection)
+	if err != nil || state.Code != check_x.Critical.Code || msg != "Mimir is not ready, status 503: Ingester not ready: waiting for 15s after being ready" {
+		t.Errorf("not ready: state = %s, message = %q, err = %v", state.Name, msg, err)
+	}
+
+	ready = true
+	state, msg, err = MimirReady(context.Background(), address, &collection)
+	if err != nil || state.Code != check_x.OK.Code || msg != "Mimir is ready" {
+		t.Errorf("ready: state = %s, message = %q, err = %v", state.Name, msg, err)
+	}
+}
+
+func TestMimirRing(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != DefaultRingPath {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if r.Header.Get("Accept") != "application/json" {
+			t.Errorf("Accept = %q, want application/json", r.Header.Get("Accept"))
+		}
+		member := `{"id":"%s","state":"%s","address":"%s","timestamp":"%s","registered_timestamp":"2023-12-01T00:00:00Z","zone":"%s","tokens":[1,2]}`
+		fmt.Fprintf(w, `{"shards":[%s,%s,%s],"now":"%s"}`,
+			fmt.Sprintf(member, "ingester-1", "ACTIVE", "10.0.0.2:9095", now.Add(-5*time.Minute).Format(time.RFC3339), "zone-b"),
+			fmt.Sprintf(member, "ingester-0", "ACTIVE", "10.0.0.1:9095", now.Add(-5*time.Second).Format(time.RFC3339), "zone-a"),
+			fmt.Sprintf(member, "ingester-2", "LEAVING", "10.0.0.3:9095", now.Add(-5*time.Second).Format(time.RFC3339), "zone-a"),
+			now.Format(time.RFC3339))
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := MimirRing(context.Background(), address, "", time.Minute, "0", "1", &collection)
+	if err != nil {
+		t.Fatalf("MimirRing returned error: %s", err)
+	}
+	if state.Code != check_x.Critical.Code {
+		t.Errorf("state = %s, want CRITICAL", state.Name)
+	}
+	expected := "Ring has 3 members in 2 zones (2 ACTIVE, 1 LEAVING), 2 unhealthy\n" +
+		"  ingester-1 (zone-b, 10.0.0.2:9095): last heartbeat 5m0s ago\n" +
+		"  ingester-2 (zone-a, 10.0.0.3:9095): LEAVING"
+	if msg != expected {
+		t.Errorf("message = %q, want %q", msg, expected)
+	}
+	if perfdata := collection.PrintAllPerformanceData(); !strings.Contains(perfdata, "'unhealthy'=2;0;1;0;") {
+		t.Errorf("perfdata = %s, want unhealthy=2", perfdata)
+	}
+}
+
+func TestMimirBuildInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/prometheus/api/v1/status/buildinfo" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"status":"success","application":"Grafana Mimir","version":"2.10.0","revision":"b1a2c3","branch":"release-2.10","goVersion":"go1.21.1","features":{}}`)
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL + "/prometheus")
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := MimirBuildInfo(context.Background(), address, `^2\.10\.`, &collection)
+	if err != nil || state.Code != check_x.OK.Code || msg != "Grafana Mimir 2.10.0, revision b1a2c3, branch release-2.10, go1.21.1" {
+		t.Errorf("state = %s, message = %q, err = %v", state.Name, msg, err)
+	}
+
+	state, msg, err = MimirBuildInfo(context.Background(), address, `^3\.`, &collection)
+	if err != nil || state.Code != check_x.Critical.Code || !strings.HasSuffix(msg, `, version does not match '^3\.'`) {
+		t.Errorf("version mismatch: state = %s, message = %q, err = %v", state.Name, msg, err)
+	}
+}
@@ -0,0 +1,95 @@
+package mode
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+// NoDataStates are the states of results without usable data. Unset states of empty results fall back to the state
+// of an empty query and then to UNKNOWN, unset states of NaN and Inf values keep the threshold evaluation.
+type NoDataStates struct {
+	// ScalarNaN is the state of a scalar result which is NaN
+	ScalarNaN check_x.State
+	// EmptyMatrix is the state of a matrix without any value
+	EmptyMatrix check_x.State
+	// EmptySeries is the state of a series without values inside a matrix, unset series are skipped
+	EmptySeries check_x.State
+	// NaN and Inf are the states of sample values which are NaN or +/-Inf
+	NaN check_x.State
+	Inf check_x.State
+	// Strings map string results to states, like 'ok=running' for equality or 'critical=~^error' for a regex
+	Strings []string
+	// StringDefault is the state of strings which match none of the Strings, UNKNOWN if unset
+	StringDefault check_x.State
+}
+
+// stringState maps a string result to a state if it is equal to the value or matches the regex
+type stringState struct {
+	state check_x.State
+	value string
+	regex *regexp.Regexp
+}
+
+func (s stringState) matches(value string) bool {
+	if s.regex != nil {
+		return s.regex.MatchString(value)
+	}
+
+	return s.value == value
+}
+
+// parseStringStates parses the mappings of strings to states, '<state>=<value>' or '<state>=~<regex>'
+func parseStringStates(mappings []string) ([]stringState, error) {
+	stringStates := []stringState{}
+	for _, mapping := range mappings {
+		name, value, found := strings.Cut(mapping, "=")
+		if !found {
+			return nil, fmt.Errorf("string state '%s' is neither <state>=<value> nor <state>=~<regex>", mapping)
+		}
+		state := check_x.StateFromString(name)
+		if state.Code == check_x.Unknown.Code && !strings.EqualFold(name, check_x.Unknown.Name) && name != "3" {
+			return nil, fmt.Errorf("unknown state '%s' in string state '%s'", name, mapping)
+		}
+		if regex, isRegex := strings.CutPrefix(value, "~"); isRegex {
+			re, err := regexp.Compile(regex)
+			if err != nil {
+				return nil, fmt.Errorf("error creating regex from '%s' : %s", regex, err.Error())
+			}
+			stringStates = append(stringStates, stringState{state: state, regex: re})
+			continue
+		}
+		stringStates = append(stringStates, stringState{state: state, value: value})
+	}
+
+	return stringStates, nil
+}
+
+// stateOrDefault returns the state, or the default if it is unset
+func stateOrDefault(state, defaultState check_x.State) check_x.State {
+	if state.Name == "" {
+		return defaultState
+	}
+
+	return state
+}
+
+// emptyState returns the state of an empty result, the empty query state is used if no specific state is set
+func emptyState(state, emptyQueryStatus check_x.State) check_x.State {
+	return stateOrDefault(state, stateOrDefault(emptyQueryStatus, check_x.Unknown))
+}
+
+// valueState returns the state of a NaN or Inf value and true, or false if the thresholds have to be evaluated
+func (n NoDataStates) valueState(value float64) (check_x.State, bool) {
+	if math.IsNaN(value) && n.NaN.Name != "" {
+		return n.NaN, true
+	}
+	if math.IsInf(value, 0) && n.Inf.Name != "" {
+		return n.Inf, true
+	}
+
+	return check_x.OK, false
+}
@@ -0,0 +1,147 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+func TestQueryNoData(t *testing.T) {
+	now := time.Now().Unix()
+	tests := []struct {
+		name         string
+		query        string
+		result       string
+		noData       NoDataStates
+		emptyStatus  check_x.State
+		emptyMessage string
+		state        check_x.State
+		msg          string
+	}{
+		{
+			name:   "empty vector",
+			result: `{"resultType":"vector","result":[]}`,
+			state:  check_x.Unknown,
+			msg:    "Query 'q' returned no data.",
+		},
+		{
+			name:         "empty vector with eqs",
+			result:       `{"resultType":"vector","result":[]}`,
+			emptyStatus:  check_x.OK,
+			emptyMessage: "All OK",
+			state:        check_x.OK,
+			msg:          "All OK",
+		},
+		{
+			name:        "empty matrix falls back to eqs",
+			result:      `{"resultType":"matrix","result":[]}`,
+			emptyStatus: check_x.Warning,
+			state:       check_x.Warning,
+			msg:         "Query 'q' returned no data.",
+		},
+		{
+			name:        "matrix of empty series",
+			result:      `{"resultType":"matrix","result":[{"metric":{"job":"a"},"values":[]}]}`,
+			noData:      NoDataStates{EmptyMatrix: check_x.Critical, EmptySeries: check_x.Warning},
+			emptyStatus: check_x.OK,
+			state:       check_x.Critical,
+			msg:         "Query 'q' returned no data.",
+		},
+		{
+			name:   "empty series",
+			result: fmt.Sprintf(`{"resultType":"matrix","result":[{"metric":{"job":"a"},"values":[[%d,"1"]]},{"metric":{"job":"b"},"values":[]}]}`, now),
+			noData: NoDataStates{EmptySeries: check_x.Warning},
+			state:  check_x.Warning,
+			msg:    "Query: 'q'\n[WARNING] {job=\"b\"} has no values",
+		},
+		{
+			name:   "scalar NaN",
+			result: fmt.Sprintf(`{"resultType":"scalar","result":[%d,"NaN"]}`, now),
+			noData: NoDataStates{ScalarNaN: check_x.Critical},
+			state:  check_x.Critical,
+			msg:    "Query 'q' returned no data.",
+		},
+		{
+			name:   "NaN and Inf samples",
+			result: fmt.Sprintf(`{"resultType":"vector","result":[{"metric":{"job":"a"},"value":[%d,"NaN"]},{"metric":{"job":"b"},"value":[%d,"+Inf"]}]}`, now, now),
+			noData: NoDataStates{NaN: check_x.Warning, Inf: check_x.Critical},
+			state:  check_x.Critical,
+			msg:    "Query: 'q'",
+		},
+		{
+			name:   "string by equality",
+			query:  `"s"`,
+			result: fmt.Sprintf(`{"resultType":"string","result":[%d,"running"]}`, now),
+			noData: NoDataStates{Strings: []string{"critical=~^(failed|error)", "ok=running"}},
+			state:  check_x.OK,
+			msg:    "Query: '\"s\"' returned: 'running'",
+		},
+		{
+			name:   "string by regex",
+			query:  `"s"`,
+			result: fmt.Sprintf(`{"resultType":"string","result":[%d,"error: disk full"]}`, now),
+			noData: NoDataStates{Strings: []string{"critical=~^(failed|error)", "ok=running"}},
+			state:  check_x.Critical,
+			msg:    "Query: '\"s\"' returned: 'error: disk full'",
+		},
+		{
+			name:   "string without match",
+			query:  `"s"`,
+			result: fmt.Sprintf(`{"resultType":"string","result":[%d,"starting"]}`, now),
+			noData: NoDataStates{Strings: []string{"ok=running"}, StringDefault: check_x.Warning},
+			state:  check_x.Warning,
+			msg:    "Query: '\"s\"' returned: 'starting'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `{"status":"success","data":%s}`, tt.result)
+			}))
+			t.Cleanup(server.Close)
+			address, _ := url.Parse(server.URL)
+
+			query := tt.query
+			if query == "" {
+				query = "q"
+			}
+			collection := check_x.NewPerformanceDataCollection()
+			state, msg, err := Query(context.Background(), address, query, QueryOptions{EmptyQueryMessage: tt.emptyMessage, EmptyQueryStatus: tt.emptyStatus, NoData: tt.noData}, &collection)
+			if err != nil {
+				t.Fatalf("Query returned error: %s", err)
+			}
+			if state.Code != tt.state.Code {
+				t.Errorf("state = %s, want %s", state.Name, tt.state.Name)
+			}
+			if msg != tt.msg {
+				t.Errorf("message = %q, want %q", msg, tt.msg)
+			}
+		})
+	}
+}
+
+func TestParseStringStates(t *testing.T) {
+	for _, mapping := range []string{"running", "fine=running", "ok=~(", "=ok"} {
+		if _, err := parseStringStates([]string{mapping}); err == nil {
+			t.Errorf("parseStringStates(%q) returned no error", mapping)
+		}
+	}
+
+	stringStates, err := parseStringStates([]string{"warning=a=b", "unknown=~^x"})
+	if err != nil {
+		t.Fatalf("parseStringStates returned error: %s", err)
+	}
+	if !stringStates[0].matches("a=b") || stringStates[0].state.Code != check_x.Warning.Code {
+		t.Errorf("'warning=a=b' does not map 'a=b' to WARNING")
+	}
+	if !stringStates[1].matches("xyz") || strings.Contains(stringStates[1].state.Name, "OK") {
+		t.Errorf("'unknown=~^x' does not map 'xyz' to UNKNOWN")
+	}
+}
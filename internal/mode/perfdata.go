@@ -0,0 +1,160 @@
+package mode
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/consol-monitoring/check_x"
+	"github.com/prometheus/common/model"
+)
+
+// PerfdataAuto derives the unit, min or max out of the base unit suffix of the metric name
+const PerfdataAuto = "auto"
+
+// PerfdataOptions describe the perfdata of every series
+type PerfdataOptions struct {
+	// Unit, Min and Max are added to every perfdata, auto derives them from the metric name
+	Unit string
+	Min  string
+	Max  string
+	// Label is a go text/template rendering the label out of the labels of the series, like the alias
+	Label string
+	// MaxLabelLength truncates the labels, 0 keeps their length
+	MaxLabelLength int
+}
+
+// validate checks that min and max are either numbers or auto
+func (o PerfdataOptions) validate() error {
+	for name, value := range map[string]string{"min": o.Min, "max": o.Max} {
+		if value == "" || value == PerfdataAuto {
+			continue
+		}
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("perfdata %s '%s' is neither a number nor '%s'", name, value, PerfdataAuto)
+		}
+	}
+
+	return nil
+}
+
+// apply adds the unit, min and max to the perfdata of the metric. The derived ones are transformed like the values.
+func (o PerfdataOptions) apply(collection *check_x.PerformanceDataCollection, label, metric string, transform ValueTransform) {
+	unit, minValue, maxValue := o.Unit, o.Min, o.Max
+	_, derivedMin, derivedMax := derivedPerfdata(metric)
+	if transform.enabled() {
+		derivedMin, derivedMax = transformLimits(derivedMin, derivedMax, metric, transform)
+	}
+	if unit == PerfdataAuto {
+		unit = transform.perfdataUnit(metric)
+	}
+	if minValue == PerfdataAuto {
+		minValue = derivedMin
+	}
+	if maxValue == PerfdataAuto {
+		maxValue = derivedMax
+	}
+
+	if unit != "" {
+		collection.Unit(label, unit)
+	}
+	if value, err := strconv.ParseFloat(minValue, 64); err == nil {
+		collection.Min(label, value)
+	}
+	if value, err := strconv.ParseFloat(maxValue, 64); err == nil {
+		collection.Max(label, value)
+	}
+}
+
+// transformLimits transforms the derived min and max, inverting swaps them
+func transformLimits(minValue, maxValue, metric string, transform ValueTransform) (string, string) {
+	limits := []string{minValue, maxValue}
+	for i, limit := range limits {
+		value, err := strconv.ParseFloat(limit, 64)
+		if err != nil {
+			continue
+		}
+		if value, err = transform.apply(value, metric); err == nil {
+			limits[i] = strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+	if transform.Invert {
+		return limits[1], limits[0]
+	}
+
+	return limits[0], limits[1]
+}
+
+// metricUnit returns the perfdata unit out of the base unit suffix of the metric name
+func metricUnit(metric string) string {
+	unit, _, _ := derivedPerfdata(metric)
+
+	return unit
+}
+
+// derivedPerfdata returns the unit, min and max of the base unit suffix of the metric name, empty if there is none
+func derivedPerfdata(metric string) (string, string, string) {
+	switch {
+	case strings.HasSuffix(metric, "_seconds"):
+		return "s", "", ""
+	case strings.HasSuffix(metric, "_bytes"):
+		return "B", "0", ""
+	case strings.HasSuffix(metric, "_ratio"):
+		return "", "0", "1"
+	}
+
+	return "", "", ""
+}
+
+// perfdataLabels makes the perfdata labels of a check spec compliant and unique
+type perfdataLabels struct {
+	maxLength int
+	used      map[string]bool
+}
+
+func newPerfdataLabels(maxLength int) *perfdataLabels {
+	return &perfdataLabels{maxLength: maxLength, used: map[string]bool{}}
+}
+
+// label replaces control characters and the '=' separating label and value, truncates the label if there is a
+// maximum length and adds a number if it was used before. Single quotes are escaped by doubling them, as the label
+// itself is quoted.
+func (p *perfdataLabels) label(label string) string {
+	label = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r):
+			return ' '
+		case r == '=':
+			return ':'
+		}
+		return r
+	}, label)
+
+	unique := p.truncate(label, 0)
+	for i := 2; p.used[unique]; i++ {
+		suffix := fmt.Sprintf("_%d", i)
+		unique = p.truncate(label, len(suffix)) + suffix
+	}
+	p.used[unique] = true
+
+	return strings.ReplaceAll(unique, "'", "''")
+}
+
+// truncate shortens the label to the maximum length minus the reserved characters, 0 keeps the length
+func (p *perfdataLabels) truncate(label string, reserved int) string {
+	if p.maxLength <= 0 {
+		return label
+	}
+	runes := []rune(label)
+	if length := max(p.maxLength-reserved, 1); len(runes) > length {
+		return string(runes[:length])
+	}
+
+	return label
+}
+
+// seriesMetric returns the metric name of the series, empty if a function dropped it
+func seriesMetric(metric model.Metric) string {
+	return string(metric[model.MetricNameLabel])
+}
@@ -0,0 +1,119 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+func TestPerfdataLabels(t *testing.T) {
+	labels := newPerfdataLabels(10)
+	tests := []struct {
+		label    string
+		expected string
+	}{
+		{label: "short", expected: "short"},
+		{label: "short", expected: "short_2"},
+		{label: "it's", expected: "it''s"},
+		{label: "line\nbreak", expected: "line break"},
+		{label: "a_very_long_label", expected: "a_very_lon"},
+		{label: "a_very_long_label_too", expected: "a_very_l_2"},
+		{label: "äöüäöüäöüäöü", expected: "äöüäöüäöüä"},
+	}
+	for _, tt := range tests {
+		if got := labels.label(tt.label); got != tt.expected {
+			t.Errorf("label(%q) = %q, want %q", tt.label, got, tt.expected)
+		}
+	}
+
+	// Without a maximum length the labels are still escaped and numbered
+	labels = newPerfdataLabels(0)
+	tests = []struct {
+		label    string
+		expected string
+	}{
+		{label: "a_very_long_label", expected: "a_very_long_label"},
+		{label: "a_very_long_label", expected: "a_very_long_label_2"},
+		{label: "it's", expected: "it''s"},
+		{label: `{job="node"}`, expected: `{job:"node"}`},
+	}
+	for _, tt := range tests {
+		if got := labels.label(tt.label); got != tt.expected {
+			t.Errorf("label(%q) = %q without maximum length, want %q", tt.label, got, tt.expected)
+		}
+	}
+}
+
+func TestDerivedPerfdata(t *testing.T) {
+	tests := []struct {
+		metric string
+		unit   string
+		min    string
+		max    string
+	}{
+		{metric: "http_request_duration_seconds", unit: "s"},
+		{metric: "node_filesystem_avail_bytes", unit: "B", min: "0"},
+		{metric: "cache_hit_ratio", min: "0", max: "1"},
+		{metric: "http_requests_total"},
+	}
+	for _, tt := range tests {
+		unit, minValue, maxValue := derivedPerfdata(tt.metric)
+		if unit != tt.unit || minValue != tt.min || maxValue != tt.max {
+			t.Errorf("derivedPerfdata(%s) = %q, %q, %q, want %q, %q, %q", tt.metric, unit, minValue, maxValue, tt.unit, tt.min, tt.max)
+		}
+	}
+}
+
+func TestQueryPerfdata(t *testing.T) {
+	now := float64(time.Now().Unix())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"__name__":"node_filesystem_avail_bytes","instance":"db01","mountpoint":"/"},"value":[%f,"2048"]},
+			{"metric":{"__name__":"node_filesystem_avail_bytes","instance":"db01","mountpoint":"/var","fstype":"ext4"},"value":[%f,"1024"]},
+			{"metric":{"__name__":"node_filesystem_avail_bytes","instance":"db01","mountpoint":"/var","fstype":"xfs"},"value":[%f,"512"]}]}}`, now, now, now)
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	tests := []struct {
+		name     string
+		perfdata PerfdataOptions
+		expected string
+	}{
+		{
+			name:     "default labels",
+			perfdata: PerfdataOptions{},
+			expected: `'{__name__:"node_filesystem_avail_bytes", instance:"db01", mountpoint:"/"}'=2048;;1:;;`,
+		},
+		{
+			name:     "label template and derived unit",
+			perfdata: PerfdataOptions{Label: "{{.instance}}_{{.mountpoint}}", Unit: PerfdataAuto, Min: PerfdataAuto, Max: "4096", MaxLabelLength: 100},
+			expected: `'db01_/'=2048B;;1:;0;4096 'db01_/var'=1024B;;1:;0;4096 'db01_/var_2'=512B;;1:;0;4096`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collection := check_x.NewPerformanceDataCollection()
+			_, _, err := Query(context.Background(), address, "node_filesystem_avail_bytes", QueryOptions{Critical: "1:", Perfdata: tt.perfdata}, &collection)
+			if err != nil {
+				t.Fatalf("Query returned error: %s", err)
+			}
+			if perfdata := collection.PrintAllPerformanceData(); !strings.HasPrefix(perfdata, tt.expected) {
+				t.Errorf("perfdata = %s, want prefix %s", perfdata, tt.expected)
+			}
+		})
+	}
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, _, err := Query(context.Background(), address, "node_filesystem_avail_bytes", QueryOptions{Perfdata: PerfdataOptions{Min: "zero"}}, &collection)
+	if err == nil || state.Code != check_x.Unknown.Code {
+		t.Errorf("invalid min: state = %s, err = %v, want UNKNOWN", state.Name, err)
+	}
+}
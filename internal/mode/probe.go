@@ -0,0 +1,281 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/consol-monitoring/check_prometheus/internal/helper"
+	"github.com/consol-monitoring/check_x"
+	"github.com/prometheus/common/model"
+)
+
+// DefaultProbeModule is the module of the blackbox exporter used for direct probes
+const DefaultProbeModule = "http_2xx"
+
+// ProbeThresholds contains the warning and critical thresholds of every value checked of a probe, the durations are
+// in seconds and the certificate expiry in days
+type ProbeThresholds struct {
+	DurationWarning    string
+	DurationCritical   string
+	DNSWarning         string
+	DNSCritical        string
+	ConnectWarning     string
+	ConnectCritical    string
+	TLSWarning         string
+	TLSCritical        string
+	ProcessingWarning  string
+	ProcessingCritical string
+	TransferWarning    string
+	TransferCritical   string
+	StatusWarning      string
+	StatusCritical     string
+	CertWarning        string
+	CertCritical       string
+}
+
+// probeMetrics are the series of the blackbox exporter the probe mode reads
+var probeMetrics = []string{
+	"probe_success",
+	"probe_duration_seconds",
+	"probe_http_status_code",
+	"probe_ssl_earliest_cert_expiry",
+	"probe_http_duration_seconds",
+	"probe_dns_lookup_time_seconds",
+}
+
+// probePhases maps the phases of probe_http_duration_seconds to their perfdata labels
+var probePhases = []struct {
+	phase string
+	label string
+}{
+	{"resolve", "dns"},
+	{"connect", "connect"},
+	{"tls", "tls"},
+	{"processing", "processing"},
+	{"transfer", "transfer"},
+}
+
+type probeValue struct {
+	label    string
+	unit     string
+	value    float64
+	warning  *check_x.Threshold
+	critical *check_x.Threshold
+	// summarized values are part of the first line anyway and are not repeated as problem
+	summarized bool
+}
+
+// scrapeProbe lets the blackbox exporter probe the target with the module and returns the resulting metrics
+func scrapeProbe(ctx context.Context, address *url.URL, target, module string) (*helper.Exposition, error) {
+	probeURL, err := url.Parse(address.String())
+	if err != nil {
+		return nil, err
+	}
+	probeURL.Path = path.Join(probeURL.Path, "/probe")
+	probeURL.RawQuery = url.Values{"module": {module}, "target": {target}}.Encode()
+
+	return helper.ScrapeMetrics(ctx, probeURL)
+}
+
+// queryProbe queries the stored probe series of the target and converts them into an exposition, the matchers have to
+// select a single probe
+func queryProbe(ctx context.Context, address *url.URL, target string, matcherDefs []string) (*helper.Exposition, error) {
+	matchers, err := helper.ParseLabelMatchers(matcherDefs)
+	if err != nil {
+		return nil, err
+	}
+	selectors := []string{fmt.Sprintf("__name__=~%q", strings.Join(probeMetrics, "|")), fmt.Sprintf("instance=%q", target)}
+	for _, matcher := range matchers {
+		selectors = append(selectors, matcher.String())
+	}
+	selector := "{" + strings.Join(selectors, ", ") + "}"
+
+	apiClient, err := helper.NewAPIClientV1(address)
+	if err != nil {
+		return nil, err
+	}
+	result, _, err := apiClient.Query(ctx, selector, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	vector, ok := result.(model.Vector)
+	if !ok {
+		return nil, fmt.Errorf("query '%s' returned a %s instead of a vector", selector, result.Type().String())
+	}
+	helper.Debugf(helper.DebugResults, "Query '%s' returned %d series", selector, len(vector))
+
+	exposition := &helper.Exposition{}
+	for _, sample := range vector {
+		labels := map[string]string{}
+		for name, value := range sample.Metric {
+			if name != model.MetricNameLabel {
+				labels[string(name)] = string(value)
+			}
+		}
+		exposition.Samples = append(exposition.Samples, helper.Sample{
+			Name:      string(sample.Metric[model.MetricNameLabel]),
+			Labels:    labels,
+			Value:     float64(sample.Value),
+			Timestamp: int64(sample.Timestamp),
+		})
+	}
+
+	success := exposition.Select("probe_success", nil)
+	if len(success) == 0 {
+		return nil, fmt.Errorf("no probe_success series found with %s", selector)
+	}
+	if len(success) > 1 {
+		probes := make([]string, 0, len(success))
+		for _, sample := range success {
+			probes = append(probes, formatLabels(sample.Labels))
+		}
+		return nil, fmt.Errorf("%d probes match %s, select one with --match: %s", len(success), selector, strings.Join(probes, ", "))
+	}
+
+	return exposition, nil
+}
+
+// Probe checks a blackbox exporter probe of the target, either out of the series stored in prometheus or by calling the
+// /probe endpoint of the exporter directly with the module. A failed probe is CRITICAL, the total duration, the
+// duration of every phase, the http status code and the days until the certificate expires are checked by the thresholds.
+func Probe(ctx context.Context, address *url.URL, target, module string, direct bool, matchers []string, thresholds ProbeThresholds, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+	if address == nil {
+		err := fmt.Errorf("address to query is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if collection == nil {
+		err := fmt.Errorf("collection to store perf data is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if target == "" {
+		err := fmt.Errorf("no target to probe given")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	type thresholdPair struct {
+		warning  **check_x.Threshold
+		critical **check_x.Threshold
+		warnDef  string
+		critDef  string
+	}
+	var durationWarn, durationCrit, statusWarn, statusCrit, certWarn, certCrit *check_x.Threshold
+	phaseWarn := make([]*check_x.Threshold, len(probePhases))
+	phaseCrit := make([]*check_x.Threshold, len(probePhases))
+	for _, pair := range []thresholdPair{
+		{&durationWarn, &durationCrit, thresholds.DurationWarning, thresholds.DurationCritical},
+		{&phaseWarn[0], &phaseCrit[0], thresholds.DNSWarning, thresholds.DNSCritical},
+		{&phaseWarn[1], &phaseCrit[1], thresholds.ConnectWarning, thresholds.ConnectCritical},
+		{&phaseWarn[2], &phaseCrit[2], thresholds.TLSWarning, thresholds.TLSCritical},
+		{&phaseWarn[3], &phaseCrit[3], thresholds.ProcessingWarning, thresholds.ProcessingCritical},
+		{&phaseWarn[4], &phaseCrit[4], thresholds.TransferWarning, thresholds.TransferCritical},
+		{&statusWarn, &statusCrit, thresholds.StatusWarning, thresholds.StatusCritical},
+		{&certWarn, &certCrit, thresholds.CertWarning, thresholds.CertCritical},
+	} {
+		warn, crit, err := newThresholds(pair.warnDef, pair.critDef)
+		if err != nil {
+			return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+		}
+		*pair.warning = warn
+		*pair.critical = crit
+	}
+
+	var exposition *helper.Exposition
+	var err error
+	if direct {
+		if module == "" {
+			module = DefaultProbeModule
+		}
+		exposition, err = scrapeProbe(ctx, address, target, module)
+	} else {
+		exposition, err = queryProbe(ctx, address, target, matchers)
+	}
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error getting the probe of %s out of address: %s : %s", target, address.String(), err.Error()), err
+	}
+
+	success := exposition.Select("probe_success", nil)
+	if len(success) == 0 {
+		err := fmt.Errorf("no probe_success metric found, is %s a blackbox exporter?", address.String())
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	states := check_x.States{check_x.OK}
+	problems := []string{}
+	msg := fmt.Sprintf("Probe of %s succeeded", target)
+	if success[0].Value != 1 {
+		states = append(states, check_x.Critical)
+		msg = fmt.Sprintf("Probe of %s failed", target)
+	}
+	collection.AddPerformanceDataFloat64("success", success[0].Value)
+	collection.Min("success", 0)
+	collection.Max("success", 1)
+
+	values := []probeValue{}
+	if samples := exposition.Select("probe_duration_seconds", nil); len(samples) > 0 {
+		values = append(values, probeValue{label: "duration", unit: "s", value: samples[0].Value, warning: durationWarn, critical: durationCrit, summarized: true})
+		msg += fmt.Sprintf(" after %.3fs", samples[0].Value)
+	}
+	if samples := exposition.Select("probe_http_status_code", nil); len(samples) > 0 {
+		values = append(values, probeValue{label: "status_code", value: samples[0].Value, warning: statusWarn, critical: statusCrit, summarized: true})
+		msg += fmt.Sprintf(", status %.0f", samples[0].Value)
+	}
+	if samples := exposition.Select("probe_ssl_earliest_cert_expiry", nil); len(samples) > 0 {
+		days := math.Floor(time.Until(time.Unix(int64(samples[0].Value), 0)).Hours() / 24)
+		values = append(values, probeValue{label: "cert_expiry_days", value: days, warning: certWarn, critical: certCrit, summarized: true})
+		msg += fmt.Sprintf(", certificate expires in %.0f days", days)
+	}
+
+	details := ""
+	for i, phase := range probePhases {
+		samples := exposition.Select("probe_http_duration_seconds", []*helper.LabelMatcher{{Name: "phase", Operator: "=", Value: phase.phase}})
+		if len(samples) == 0 && phase.label == "dns" {
+			samples = exposition.Select("probe_dns_lookup_time_seconds", nil)
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		value := probeValue{label: phase.label, unit: "s", value: samples[0].Value, warning: phaseWarn[i], critical: phaseCrit[i]}
+		values = append(values, value)
+		phaseState := check_x.Evaluator{Warning: value.warning, Critical: value.critical}.Evaluate(value.value)
+		details += fmt.Sprintf("[%s] %s: %.3fs\n", phaseState.Name, phase.label, value.value)
+	}
+
+	for _, value := range values {
+		valueState := check_x.Evaluator{Warning: value.warning, Critical: value.critical}.Evaluate(value.value)
+		if valueState.Code != check_x.OK.Code && !value.summarized {
+			problems = append(problems, fmt.Sprintf("%s took %.3fs", value.label, value.value))
+		}
+		states = append(states, valueState)
+
+		collection.AddPerformanceDataFloat64(value.label, value.value)
+		if value.unit != "" {
+			collection.Unit(value.label, value.unit)
+		}
+		collection.Warn(value.label, value.warning)
+		collection.Crit(value.label, value.critical)
+		if value.label != "cert_expiry_days" {
+			collection.Min(value.label, 0)
+		}
+	}
+
+	state, err := states.GetWorst()
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when picking the worst state out of many states: %s", err.Error()), err
+	}
+
+	if len(problems) > 0 {
+		msg += ", " + strings.Join(problems, ", ")
+	}
+	if details != "" {
+		msg += "\n" + strings.TrimSuffix(details, "\n")
+	}
+
+	return *state, msg, nil
+}
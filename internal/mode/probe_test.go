@@ -0,0 +1,97 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+func TestProbeDirect(t *testing.T) {
+	expiry := time.Now().Add(45*24*time.Hour + time.Hour).Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/probe" || r.URL.Query().Get("module") != "http_2xx" || r.URL.Query().Get("target") != "https://example.com" {
+			t.Errorf("unexpected request %q", r.URL.String())
+		}
+		fmt.Fprintln(w, "probe_success 1")
+		fmt.Fprintln(w, "probe_duration_seconds 0.234")
+		fmt.Fprintln(w, "probe_http_status_code 200")
+		fmt.Fprintf(w, "probe_ssl_earliest_cert_expiry %d\n", expiry)
+		for phase, value := range map[string]string{"resolve": "0.004", "connect": "0.012", "tls": "0.051", "processing": "1.6", "transfer": "0.002"} {
+			fmt.Fprintf(w, "probe_http_duration_seconds{phase=%q} %s\n", phase, value)
+		}
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	thresholds := ProbeThresholds{DurationCritical: "1", ProcessingWarning: "1", CertWarning: "60:", StatusCritical: "200:399"}
+	state, msg, err := Probe(context.Background(), address, "https://example.com", "", true, nil, thresholds, &collection)
+	if err != nil {
+		t.Fatalf("Probe returned error: %s", err)
+	}
+	if state.Code != check_x.Warning.Code {
+		t.Errorf("state = %s, want WARNING", state.Name)
+	}
+	expected := strings.Join([]string{
+		"Probe of https://example.com succeeded after 0.234s, status 200, certificate expires in 45 days, processing took 1.600s",
+		"[OK] dns: 0.004s",
+		"[OK] connect: 0.012s",
+		"[OK] tls: 0.051s",
+		"[WARNING] processing: 1.600s",
+		"[OK] transfer: 0.002s",
+	}, "\n")
+	if msg != expected {
+		t.Errorf("message = %q, want %q", msg, expected)
+	}
+	perfdata := collection.PrintAllPerformanceData()
+	for _, want := range []string{"'success'=1;;;0;1", "'duration'=0.234s;;1;0;", "'status_code'=200;;200:399;0;", "'cert_expiry_days'=45;60:;;;", "'dns'=0.004s;;;0;"} {
+		if !strings.Contains(perfdata, want) {
+			t.Errorf("perfdata = %s, want %s", perfdata, want)
+		}
+	}
+}
+
+func TestProbeStored(t *testing.T) {
+	probes := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %s", err)
+		}
+		if query := r.Form.Get("query"); !strings.Contains(query, `instance="example.com:443"`) || !strings.Contains(query, `job="blackbox"`) {
+			t.Errorf("unexpected query %q", query)
+		}
+		now := time.Now().Unix()
+		result := []string{
+			fmt.Sprintf(`{"metric":{"__name__":"probe_duration_seconds","instance":"example.com:443","job":"blackbox"},"value":[%d,"3.1"]}`, now),
+			fmt.Sprintf(`{"metric":{"__name__":"probe_dns_lookup_time_seconds","instance":"example.com:443","job":"blackbox"},"value":[%d,"3"]}`, now),
+		}
+		for i := 0; i < probes; i++ {
+			result = append(result, fmt.Sprintf(`{"metric":{"__name__":"probe_success","instance":"example.com:443","job":"blackbox","region":"r%d"},"value":[%d,"0"]}`, i, now))
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[%s]}}`, strings.Join(result, ","))
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := Probe(context.Background(), address, "example.com:443", "", false, []string{"job=blackbox"}, ProbeThresholds{DNSWarning: "1"}, &collection)
+	if err != nil {
+		t.Fatalf("Probe returned error: %s", err)
+	}
+	if state.Code != check_x.Critical.Code || msg != "Probe of example.com:443 failed after 3.100s, dns took 3.000s\n[WARNING] dns: 3.000s" {
+		t.Errorf("state = %s, message = %q", state.Name, msg)
+	}
+
+	probes = 2
+	state, msg, err = Probe(context.Background(), address, "example.com:443", "", false, []string{"job=blackbox"}, ProbeThresholds{}, &collection)
+	if err == nil || state.Code != check_x.Unknown.Code || !strings.Contains(msg, "2 probes match") {
+		t.Errorf("ambiguous probe: state = %s, message = %q, err = %v", state.Name, msg, err)
+	}
+}
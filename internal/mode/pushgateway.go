@@ -0,0 +1,251 @@
+package mode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/consol-monitoring/check_prometheus/internal/helper"
+	"github.com/consol-monitoring/check_x"
+	"github.com/prometheus/common/model"
+)
+
+// pushMetricFamily is a metric family of a push group, the values are strings
+type pushMetricFamily struct {
+	Metrics []struct {
+		Labels map[string]string `json:"labels"`
+		Value  string            `json:"value"`
+	} `json:"metrics"`
+}
+
+// value returns the value of the first metric of the family
+func (f *pushMetricFamily) value() (float64, bool) {
+	if f == nil || len(f.Metrics) == 0 {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(f.Metrics[0].Value, 64)
+
+	return value, err == nil
+}
+
+// pushGroup is a group of metrics pushed together, identified by the job and the grouping labels
+type pushGroup struct {
+	Labels             map[string]string `json:"labels"`
+	LastPushSuccessful *bool             `json:"last_push_successful"`
+	PushTime           *pushMetricFamily `json:"push_time_seconds"`
+	PushFailureTime    *pushMetricFamily `json:"push_failure_time_seconds"`
+}
+
+// getPushGroups fetches all push groups of a pushgateway
+func getPushGroups(ctx context.Context, address *url.URL) ([]pushGroup, error) {
+	metricsURL, err := url.Parse(address.String())
+	if err != nil {
+		return nil, err
+	}
+	metricsURL.Path = path.Join(metricsURL.Path, "/api/v1/metrics")
+	jsonBytes, err := helper.DoAPIRequest(ctx, metricsURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Status string      `json:"status"`
+		Error  string      `json:"error"`
+		Data   []pushGroup `json:"data"`
+	}
+	if err := json.Unmarshal(jsonBytes, &response); err != nil {
+		return nil, err
+	}
+	if response.Status != "success" {
+		return nil, fmt.Errorf("the API metrics return status was %s: %s", response.Status, response.Error)
+	}
+
+	return response.Data, nil
+}
+
+// parseMaxAges parses a list of 'D' and 'job=D' entries with prometheus durations like '26h' or '1d'. 'D' applies to
+// every job without own entry.
+func parseMaxAges(maxAges []string) (time.Duration, map[string]time.Duration, error) {
+	defaultAge := time.Duration(0)
+	perJob := map[string]time.Duration{}
+	for _, entry := range maxAges {
+		job, value, found := strings.Cut(entry, "=")
+		if !found {
+			value = job
+		}
+		age, err := model.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return 0, nil, fmt.Errorf("maximum age '%s' is not in the form 'duration' or 'job=duration'", entry)
+		}
+		if found {
+			perJob[strings.TrimSpace(job)] = time.Duration(age)
+		} else {
+			defaultAge = time.Duration(age)
+		}
+	}
+
+	return defaultAge, perJob, nil
+}
+
+// Pushgateway checks the push groups of a pushgateway: groups whose last successful push is older than the maximum
+// age of their job result in staleState, groups whose last push failed in failureState. maxAges are 'duration' or
+// 'job=duration' entries, every given job has to have pushed at least once.
+func Pushgateway(ctx context.Context, address *url.URL, jobs, maxAges []string, staleState, failureState check_x.State, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+	if address == nil {
+		err := fmt.Errorf("address to query is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if collection == nil {
+		err := fmt.Errorf("collection to store perf data is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	defaultAge, agePerJob, err := parseMaxAges(maxAges)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	groups, err := getPushGroups(ctx, address)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error getting push groups out of address: %s : %s", address.String(), err.Error()), err
+	}
+
+	wantedJobs := map[string]bool{}
+	for _, job := range jobs {
+		wantedJobs[job] = true
+	}
+	for job := range agePerJob {
+		wantedJobs[job] = true
+	}
+
+	selected := []pushGroup{}
+	for _, group := range groups {
+		if len(jobs) == 0 || wantedJobs[group.Labels["job"]] {
+			selected = append(selected, group)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return formatLabels(selected[i].Labels) < formatLabels(selected[j].Labels)
+	})
+
+	now := time.Now()
+	states := check_x.States{check_x.OK}
+	details := ""
+	stale := 0
+	failed := 0
+	seenJobs := map[string]bool{}
+	jobAges := map[string]time.Duration{}
+	for _, group := range selected {
+		job := group.Labels["job"]
+		seenJobs[job] = true
+		maxAge, ok := agePerJob[job]
+		if !ok {
+			maxAge = defaultAge
+		}
+
+		groupState := check_x.OK
+		info := ""
+		pushTime, _ := group.PushTime.value()
+		if pushTime > 0 {
+			age := now.Sub(time.UnixMilli(int64(pushTime * 1000)))
+			jobAges[job] = max(jobAges[job], age)
+			info = fmt.Sprintf("last push %s ago", age.Round(time.Second))
+			if maxAge > 0 && age > maxAge {
+				groupState = staleState
+				info += fmt.Sprintf(", max age %s", maxAge)
+				stale++
+			}
+		} else {
+			// push_time_seconds is 0 or missing if the group only had failed pushes
+			info = "never pushed successfully"
+			groupState = staleState
+			stale++
+		}
+
+		failureTime, hasFailureTime := group.PushFailureTime.value()
+		lastPushFailed := hasFailureTime && failureTime > pushTime
+		if !hasFailureTime && group.LastPushSuccessful != nil {
+			lastPushFailed = !*group.LastPushSuccessful
+		}
+		if lastPushFailed {
+			if hasFailureTime {
+				info += fmt.Sprintf(", last push failed %s ago", now.Sub(time.UnixMilli(int64(failureTime*1000))).Round(time.Second))
+			} else {
+				info += ", last push failed"
+			}
+			if worst, err := (check_x.States{groupState, failureState}).GetWorst(); err == nil {
+				groupState = *worst
+			}
+			failed++
+		}
+
+		states = append(states, groupState)
+		details += fmt.Sprintf("[%s] %s %s\n", groupState.Name, formatLabels(group.Labels), info)
+	}
+
+	missing := []string{}
+	for job := range wantedJobs {
+		if !seenJobs[job] {
+			missing = append(missing, job)
+		}
+	}
+	sort.Strings(missing)
+	for _, job := range missing {
+		states = append(states, staleState)
+		details += fmt.Sprintf("[%s] job %s has no push group\n", staleState.Name, job)
+	}
+
+	jobNames := make([]string, 0, len(jobAges))
+	for job := range jobAges {
+		jobNames = append(jobNames, job)
+	}
+	sort.Strings(jobNames)
+	for _, job := range jobNames {
+		label := job + "_age"
+		collection.AddPerformanceDataFloat64(label, jobAges[job].Round(time.Second).Seconds())
+		collection.Unit(label, "s")
+		collection.Min(label, 0)
+		maxAge, ok := agePerJob[job]
+		if !ok {
+			maxAge = defaultAge
+		}
+		if maxAge > 0 {
+			threshold, err := check_x.NewThreshold(strconv.FormatFloat(maxAge.Seconds(), 'f', -1, 64))
+			if err == nil {
+				if staleState.Code == check_x.Warning.Code {
+					collection.Warn(label, threshold)
+				} else {
+					collection.Crit(label, threshold)
+				}
+			}
+		}
+	}
+	collection.AddPerformanceDataFloat64("groups", float64(len(selected)))
+	collection.Min("groups", 0)
+	collection.AddPerformanceDataFloat64("stale", float64(stale))
+	collection.Min("stale", 0)
+	collection.AddPerformanceDataFloat64("failed", float64(failed))
+	collection.Min("failed", 0)
+
+	state, err := states.GetWorst()
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when picking the worst state out of many states: %s", err.Error()), err
+	}
+
+	msg := fmt.Sprintf("%d push groups of %d jobs, %d stale, %d failed", len(selected), len(seenJobs), stale, failed)
+	if len(missing) > 0 {
+		msg += fmt.Sprintf(", no push group of job %s", strings.Join(missing, ", "))
+	}
+	if details != "" {
+		msg += "\n" + strings.TrimSuffix(details, "\n")
+	}
+
+	return *state, msg, nil
+}
@@ -0,0 +1,82 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+func TestPushgateway(t *testing.T) {
+	now := time.Now()
+	pushGroup := func(labels string, pushed, failed time.Duration) string {
+		pushTime := "0"
+		if pushed > 0 {
+			pushTime = fmt.Sprintf("%.3f", float64(now.Add(-pushed).UnixMilli())/1000)
+		}
+		failureTime := "0"
+		if failed > 0 {
+			failureTime = fmt.Sprintf("%.3f", float64(now.Add(-failed).UnixMilli())/1000)
+		}
+		return fmt.Sprintf(`{"labels":%s,"last_push_successful":%t,
+			"push_time_seconds":{"type":"GAUGE","metrics":[{"labels":%s,"value":"%s"}]},
+			"push_failure_time_seconds":{"type":"GAUGE","metrics":[{"labels":%s,"value":"%s"}]},
+			"backup_size_bytes":{"type":"GAUGE","metrics":[{"labels":%s,"value":"1e+09"}]}}`,
+			labels, failed == 0 || failed > pushed, labels, pushTime, labels, failureTime, labels)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/metrics" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		fmt.Fprintf(w, `{"status":"success","data":[%s,%s,%s,%s]}`,
+			pushGroup(`{"job":"backup","instance":"db2"}`, 2*time.Hour, 0),
+			pushGroup(`{"job":"backup","instance":"db1"}`, 30*time.Hour, 0),
+			pushGroup(`{"job":"cleanup"}`, 10*time.Minute, 5*time.Minute),
+			pushGroup(`{"job":"import"}`, 0, time.Hour))
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := Pushgateway(context.Background(), address, nil, []string{"1h", "backup=26h", "report=1d"}, check_x.Critical, check_x.Warning, &collection)
+	if err != nil {
+		t.Fatalf("Pushgateway returned error: %s", err)
+	}
+	if state.Code != check_x.Critical.Code {
+		t.Errorf("state = %s, want CRITICAL", state.Name)
+	}
+	expected := strings.Join([]string{
+		"4 push groups of 3 jobs, 2 stale, 2 failed, no push group of job report",
+		`[CRITICAL] {instance="db1", job="backup"} last push 30h0m0s ago, max age 26h0m0s`,
+		`[OK] {instance="db2", job="backup"} last push 2h0m0s ago`,
+		`[WARNING] {job="cleanup"} last push 10m0s ago, last push failed 5m0s ago`,
+		`[CRITICAL] {job="import"} never pushed successfully, last push failed 1h0m0s ago`,
+		`[CRITICAL] job report has no push group`,
+	}, "\n")
+	if msg != expected {
+		t.Errorf("message = %q, want %q", msg, expected)
+	}
+	perfdata := collection.PrintAllPerformanceData()
+	for _, want := range []string{"'backup_age'=108000s;;93600;0;", "'cleanup_age'=600s;;3600;0;", "'stale'=2;;;0;", "'failed'=2;;;0;"} {
+		if !strings.Contains(perfdata, want) {
+			t.Errorf("perfdata = %s, want %s", perfdata, want)
+		}
+	}
+
+	// Only the given jobs are checked
+	collection = check_x.NewPerformanceDataCollection()
+	state, msg, err = Pushgateway(context.Background(), address, []string{"cleanup"}, []string{"1h"}, check_x.Critical, check_x.OK, &collection)
+	if err != nil || state.Code != check_x.OK.Code || !strings.HasPrefix(msg, "1 push groups of 1 jobs, 0 stale, 1 failed\n") {
+		t.Errorf("job filter: state = %s, message = %q, err = %v", state.Name, msg, err)
+	}
+
+	if _, _, err := Pushgateway(context.Background(), address, nil, []string{"backup=often"}, check_x.Critical, check_x.Critical, &collection); err == nil {
+		t.Error("Pushgateway accepted an invalid maximum age")
+	}
+}
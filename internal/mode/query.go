@@ -1,23 +1,65 @@
 package mode
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"math"
 	"net/url"
+	"path"
 	"regexp"
 	"strconv"
-	"text/template"
+	"strings"
 	"time"
 
 	"github.com/consol-monitoring/check_prometheus/internal/helper"
 
 	"github.com/consol-monitoring/check_x"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
 )
 
-// Query allows the user to test data in the prometheus server
-func Query(ctx context.Context, address *url.URL, query, warning, critical, alias, search, replace, emptyQueryMessage string, emptyQueryStatus check_x.State, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+// QueryOptions configure how the result of a query is checked and printed
+type QueryOptions struct {
+	// Warning and Critical are the thresholds applied on every value
+	Warning  string
+	Critical string
+	// Templates render the alias, the summary and the long output
+	Templates OutputTemplates
+	// Perfdata sets the labels, units, min and max of the perfdata
+	Perfdata PerfdataOptions
+	// Transform changes the values before they are checked
+	Transform ValueTransform
+	// Aggregation evaluates the state out of all series of a vector instead of the worst series
+	Aggregation Aggregation
+	// Stats checks the number of samples the query processed
+	Stats QueryStatsThresholds
+	// Thanos parameters are added to every request, they are only understood by Thanos queriers
+	Thanos ThanosParameters
+	// Search and Replace rewrite the perfdata labels with a regex
+	Search  string
+	Replace string
+	// EmptyQueryMessage and EmptyQueryStatus are returned if the query returns no data, the status defaults to UNKNOWN
+	EmptyQueryMessage string
+	EmptyQueryStatus  check_x.State
+	// NoData sets the states of NaN, Inf, empty and string results
+	NoData NoDataStates
+	// MaxSeriesAge gives series whose last sample is older the StaleState, which defaults to UNKNOWN. The last samples
+	// are looked up for every selector of the query, aggregated series are as old as their newest input series.
+	MaxSeriesAge time.Duration
+	StaleState   check_x.State
+	// Lint returns UNKNOWN for queries the PromQL parser of prometheus rejects instead of sending them
+	Lint bool
+}
+
+// Query runs an instant query and checks its vector, scalar, matrix or string result against the options.
+// Every value is transformed and then evaluated against the thresholds, native histograms by their number of
+// observations. The state of a vector is the worst state of its series unless the aggregation evaluates all series
+// together, series older than the maximum age get the stale state and results without data get the no data states.
+// The output is rendered by the templates, the perfdata labels are escaped and made unique, and truncated if
+// Perfdata.MaxLabelLength is set.
+func Query(ctx context.Context, address *url.URL, query string, options QueryOptions, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
 	if address == nil {
 		err := fmt.Errorf("address to query is null")
 		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
@@ -28,123 +70,415 @@ func Query(ctx context.Context, address *url.URL, query, warning, critical, alia
 		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
 	}
 
-	warnThreshold, err := check_x.NewThreshold(warning)
+	warnThreshold, err := check_x.NewThreshold(options.Warning)
 	if err != nil {
-		return check_x.Unknown, fmt.Sprintf("Error creating warningThreshold from '%s' : %s", warning, err.Error()), err
+		return check_x.Unknown, fmt.Sprintf("Error creating warningThreshold from '%s' : %s", options.Warning, err.Error()), err
 	}
 
-	critThreshold, err := check_x.NewThreshold(critical)
+	critThreshold, err := check_x.NewThreshold(options.Critical)
 	if err != nil {
-		return check_x.Unknown, fmt.Sprintf("Error creating critThreshold from '%s' : %s", critical, err.Error()), err
+		return check_x.Unknown, fmt.Sprintf("Error creating critThreshold from '%s' : %s", options.Critical, err.Error()), err
 	}
 
 	var re *regexp.Regexp
-	if search != "" {
-		re, err = regexp.Compile(search)
+	if options.Search != "" {
+		re, err = regexp.Compile(options.Search)
 		if err != nil {
-			return check_x.Unknown, fmt.Sprintf("Error creating regex from '%s' : %s", search, err.Error()), err
+			return check_x.Unknown, fmt.Sprintf("Error creating regex from '%s' : %s", options.Search, err.Error()), err
 		}
 	}
 
-	apiClient, err := helper.NewAPIClientV1(address)
+	if err := options.Perfdata.validate(); err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if err := options.Transform.validate(); err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	aggregateWarning, aggregateCritical, err := options.Aggregation.thresholds()
 	if err != nil {
-		return check_x.Unknown, fmt.Sprintf("Error creating apiClient: %s", err.Error()), err
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
 	}
 
-	result, _, err := apiClient.Query(ctx, query, time.Now())
+	statsThresholds, err := options.Stats.thresholds()
 	if err != nil {
-		return check_x.Unknown, fmt.Sprintf("Error when querying: %s", err.Error()), err
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
 	}
 
-	switch result.Type() {
-	case model.ValScalar:
-		scalar := result.(*model.Scalar)
-		scalarValue := float64(scalar.Value)
-		if err := helper.CheckTimestampFreshness(scalar.Timestamp); err != nil {
-			return check_x.Unknown, fmt.Sprintf("Error when checking scalar timestamp freshness: %s", err.Error()), err
-		}
+	stringStates, err := parseStringStates(options.NoData.Strings)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	thanosValues, err := options.Thanos.values()
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+	if len(thanosValues) > 0 {
+		ctx = helper.WithQueryParameters(ctx, thanosValues)
+	}
 
-		collection.AddPerformanceDataFloat64(replaceLabel("scalar", re, replace), scalarValue)
-		collection.Warn("scalar", warnThreshold)
-		collection.Crit("scalar", critThreshold)
-		state := check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(scalarValue)
+	staleState := stateOrDefault(options.StaleState, check_x.Unknown)
+	noDataMessage := options.EmptyQueryMessage
+	if noDataMessage == "" {
+		noDataMessage = fmt.Sprintf("Query '%s' returned no data.", query)
+	}
 
-		resultAsString := strconv.FormatFloat(scalarValue, 'f', -1, 64)
-		if alias == "" {
-			return state, fmt.Sprintf("Query: '%s' returned: '%s'", query, resultAsString), nil
-		} else {
-			return state, fmt.Sprintf("Alias: '%s' returned: '%s'", alias, resultAsString), nil
-		}
-	case model.ValVector:
-		vector := result.(model.Vector)
-		states := check_x.States{}
-		var output string
-		if len(vector) == 0 && emptyQueryMessage != "" {
-			output = emptyQueryMessage
-		} else if len(vector) == 0 {
-			output = fmt.Sprintf("Query '%s' returned no data.", query)
-		}
-		if output != "" {
-			return emptyQueryStatus, output, nil
+	// The server may understand more than the parser of prometheus, like the extensions of other query engines, so
+	// parse errors only fail the check if linting is enabled
+	expr, err := parseQuery(query)
+	if err != nil {
+		if options.Lint {
+			return check_x.Unknown, fmt.Sprintf("Error parsing query: %s", err.Error()), err
 		}
-		for _, sample := range vector {
-			if err := helper.CheckTimestampFreshness(sample.Timestamp); err != nil {
-				return check_x.Unknown, fmt.Sprintf("Error when checking sample timestamp freshness: %s", err.Error()), err
+		helper.Debugf(helper.DebugRequests, "Warning: query '%s' could not be parsed, sending it anyway: %s", query, err.Error())
+	}
+
+	apiClient, err := helper.NewAPIClientV1(address)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error creating apiClient: %s", err.Error()), err
+	}
+
+	var queryStats *helper.QueryStats
+	queryOptions := []v1.Option{}
+	if options.Stats.Enabled {
+		ctx, queryStats = helper.WithQueryStats(ctx)
+		queryOptions = append(queryOptions, v1.WithStats(v1.AllStatsValue))
+	}
+
+	evalTime := time.Now()
+	var result model.Value
+	if expr != nil && expr.Type() == parser.ValueTypeString {
+		// The api client rejects string results
+		result, err = queryString(ctx, address, query, evalTime)
+	} else {
+		result, _, err = apiClient.Query(ctx, query, evalTime, queryOptions...)
+	}
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when querying: %s", err.Error()), err
+	}
+	helper.Debugf(helper.DebugResults, "Query '%s' returned a %s: %s", query, result.Type().String(), result.String())
+	perfdataLabels := newPerfdataLabels(options.Perfdata.MaxLabelLength)
+
+	evalResult := func() (check_x.State, string, error) {
+		switch result.Type() {
+		case model.ValScalar:
+			scalar := result.(*model.Scalar)
+			if math.IsNaN(float64(scalar.Value)) {
+				return emptyState(options.NoData.ScalarNaN, options.EmptyQueryStatus), noDataMessage, nil
+			}
+			scalarValue, err := options.Transform.apply(float64(scalar.Value), "")
+			if err != nil {
+				return check_x.Unknown, fmt.Sprintf("Error transforming the value: %s", err.Error()), err
 			}
 
-			sampleValue := float64(sample.Value)
-			label := replaceLabel(model.LabelSet(sample.Metric).String(), re, replace)
-			collection.AddPerformanceDataFloat64(label, sampleValue)
+			rawLabel := replaceLabel("scalar", re, options.Replace)
+			label := perfdataLabels.label(rawLabel)
+			collection.AddPerformanceDataFloat64(label, scalarValue)
 			collection.Warn(label, warnThreshold)
 			collection.Crit(label, critThreshold)
-			states = append(states, check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(sampleValue))
-			output += expandAlias(alias, sample.Metric, sampleValue)
-		}
+			options.Perfdata.apply(collection, label, "", options.Transform)
+			if options.Transform.KeepOriginal {
+				originalLabel := perfdataLabels.label(rawLabel + "_original")
+				collection.AddPerformanceDataFloat64(originalLabel, float64(scalar.Value))
+				options.Perfdata.apply(collection, originalLabel, "", ValueTransform{})
+			}
+			state, ok := options.NoData.valueState(float64(scalar.Value))
+			if !ok {
+				state = check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(scalarValue)
+			}
+
+			resultAsString := strconv.FormatFloat(scalarValue, 'f', -1, 64)
+			if options.Templates.Alias == "" {
+				return state, fmt.Sprintf("Query: '%s' returned: '%s'", query, resultAsString), nil
+			} else {
+				return state, fmt.Sprintf("Alias: '%s' returned: '%s'", options.Templates.Alias, resultAsString), nil
+			}
+		case model.ValVector:
+			vector := result.(model.Vector)
+			states := check_x.States{}
+			var output string
+			if countState, problem := options.Aggregation.checkSeriesCount(len(vector)); len(vector) == 0 && problem != "" {
+				return countState, fmt.Sprintf("Query '%s' %s", query, problem), nil
+			}
+			if len(vector) == 0 {
+				return emptyState(check_x.State{}, options.EmptyQueryStatus), noDataMessage, nil
+			}
 
-		return evalStates(states, output, query)
-	case model.ValMatrix:
-		matrix := result.(model.Matrix)
-		states := check_x.States{}
-		for _, sampleStream := range matrix {
-			for _, value := range sampleStream.Values {
-				if err := helper.CheckTimestampFreshness(value.Timestamp); err != nil {
-					return check_x.Unknown, fmt.Sprintf("Error when checking value timestamp freshness: %s", err.Error()), err
+			var sampleTimes *seriesTimes
+			if options.MaxSeriesAge > 0 {
+				if expr == nil {
+					err := fmt.Errorf("the age of the series can only be looked up for queries the parser of prometheus understands")
+					return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+				}
+				sampleTimes, err = lastSampleTimes(ctx, apiClient, expr, options.MaxSeriesAge, evalTime)
+				if err != nil {
+					return check_x.Unknown, fmt.Sprintf("Error when querying the sample timestamps: %s", err.Error()), err
 				}
-				states = append(states, check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(float64(value.Value)))
 			}
-		}
 
-		return evalStates(states, alias, query)
-	default:
+			staleSeries := ""
+			series := []aliasSeries{}
+			var templateErr error
+			for _, sample := range vector {
+				if err := helper.CheckTimestampFreshness(sample.Timestamp); err != nil {
+					return check_x.Unknown, fmt.Sprintf("Error when checking sample timestamp freshness: %s", err.Error()), err
+				}
 
-		err = fmt.Errorf("query did not return a supported type(scalar, vector, matrix), instead: '%s'. Query: '%s'", result.Type().String(), query)
+				sampleValue := float64(sample.Value)
+				label := model.LabelSet(sample.Metric).String()
+				if options.Perfdata.Label != "" {
+					rendered, err := expandAlias(options.Perfdata.Label, aliasSeries{Labels: sample.Metric, Value: sampleValue, Warning: options.Warning, Critical: options.Critical})
+					if err != nil && templateErr == nil {
+						templateErr = err
+					}
+					if err == nil {
+						label = rendered
+					}
+				}
+				rawLabel := replaceLabel(label, re, options.Replace)
+				if sample.Histogram != nil {
+					// Native histograms have no single value, the thresholds are applied on the number of observations
+					sampleValue = float64(sample.Histogram.Count)
+					sumLabel := perfdataLabels.label(rawLabel + "_sum")
+					collection.AddPerformanceDataFloat64(sumLabel, float64(sample.Histogram.Sum))
+					options.Perfdata.apply(collection, sumLabel, seriesMetric(sample.Metric), ValueTransform{})
+					label = perfdataLabels.label(rawLabel + "_count")
+				} else {
+					label = perfdataLabels.label(rawLabel)
+					sampleValue, err = options.Transform.apply(sampleValue, seriesMetric(sample.Metric))
+					if err != nil {
+						return check_x.Unknown, fmt.Sprintf("Error transforming the value: %s", err.Error()), err
+					}
+				}
+				collection.AddPerformanceDataFloat64(label, sampleValue)
+				collection.Warn(label, warnThreshold)
+				collection.Crit(label, critThreshold)
+				if sample.Histogram == nil {
+					options.Perfdata.apply(collection, label, seriesMetric(sample.Metric), options.Transform)
+					if options.Transform.KeepOriginal {
+						originalLabel := perfdataLabels.label(rawLabel + "_original")
+						collection.AddPerformanceDataFloat64(originalLabel, float64(sample.Value))
+						options.Perfdata.apply(collection, originalLabel, seriesMetric(sample.Metric), ValueTransform{})
+					}
+				}
 
-		return check_x.Unknown, fmt.Sprintf("Error when querying prometheus: %s", err.Error()), err
+				sampleState, ok := options.NoData.valueState(float64(sample.Value))
+				if !ok {
+					sampleState = check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(sampleValue)
+				}
+				if sampleTimes != nil {
+					sampleTime, ok := sampleTimes.lastSample(sample.Metric)
+					switch {
+					case ok && evalTime.Sub(sampleTime.Time()) > options.MaxSeriesAge:
+						sampleState = staleState
+						staleSeries += fmt.Sprintf("\n[%s] %s last sample is %s old", staleState.Name, model.LabelSet(sample.Metric).String(), evalTime.Sub(sampleTime.Time()).Truncate(time.Second))
+					case !ok && sampleTimes.direct:
+						sampleState = staleState
+						staleSeries += fmt.Sprintf("\n[%s] %s has no sample within %s", staleState.Name, model.LabelSet(sample.Metric).String(), model.Duration(sampleTimes.window))
+					case !ok:
+						staleSeries += fmt.Sprintf("\n%s the age is unknown, no selected series has its labels", model.LabelSet(sample.Metric).String())
+					}
+				}
+				states = append(states, sampleState)
+
+				aliasData := aliasSeries{Labels: sample.Metric, Value: sampleValue, State: sampleState, Warning: options.Warning, Critical: options.Critical}
+				rendered, err := expandAlias(options.Templates.Alias, aliasData)
+				if err != nil && templateErr == nil {
+					templateErr = err
+				}
+				output += rendered
+				aliasData.Alias = rendered
+				series = append(series, aliasData)
+			}
+
+			summary, details := "", ""
+			if options.Aggregation.enabled() {
+				var aggregateState check_x.State
+				aggregateState, summary, details = options.Aggregation.evaluate(series, aggregateWarning, aggregateCritical, perfdataLabels, collection)
+				states = check_x.States{aggregateState}
+			}
+			if countState, problem := options.Aggregation.checkSeriesCount(len(vector)); problem != "" {
+				states = append(states, countState)
+				summary += ", " + problem
+			}
+
+			return evalSeriesStates(states, output, query, summary, details+staleSeries, options.Templates, series, templateErr)
+		case model.ValMatrix:
+			matrix := result.(model.Matrix)
+			states := check_x.States{}
+			emptySeries := ""
+			values := 0
+			for _, sampleStream := range matrix {
+				if len(sampleStream.Values) == 0 && len(sampleStream.Histograms) == 0 {
+					if options.NoData.EmptySeries.Name != "" {
+						states = append(states, options.NoData.EmptySeries)
+						emptySeries += fmt.Sprintf("\n[%s] %s has no values", options.NoData.EmptySeries.Name, model.LabelSet(sampleStream.Metric).String())
+					}
+					continue
+				}
+				values += len(sampleStream.Values) + len(sampleStream.Histograms)
+
+				for _, value := range sampleStream.Values {
+					transformed, err := options.Transform.apply(float64(value.Value), seriesMetric(sampleStream.Metric))
+					if err != nil {
+						return check_x.Unknown, fmt.Sprintf("Error transforming the value: %s", err.Error()), err
+					}
+					if valueState, ok := options.NoData.valueState(float64(value.Value)); ok {
+						states = append(states, valueState)
+						continue
+					}
+					states = append(states, check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(transformed))
+				}
+				for _, value := range sampleStream.Histograms {
+					states = append(states, check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(float64(value.Histogram.Count)))
+				}
+			}
+			if values == 0 {
+				// Without a single value there is no data, no matter how many series the matrix has
+				return emptyState(options.NoData.EmptyMatrix, options.EmptyQueryStatus), noDataMessage, nil
+			}
+
+			state, msg, err := evalStates(states, options.Templates.Alias, query)
+			return state, msg + emptySeries, err
+		case model.ValString:
+			value := result.(*model.String)
+			state := stateOrDefault(options.NoData.StringDefault, check_x.Unknown)
+			for _, stringState := range stringStates {
+				if stringState.matches(value.Value) {
+					state = stringState.state
+					break
+				}
+			}
+			if options.Templates.Alias == "" {
+				return state, fmt.Sprintf("Query: '%s' returned: '%s'", query, value.Value), nil
+			} else {
+				return state, fmt.Sprintf("Alias: '%s' returned: '%s'", options.Templates.Alias, value.Value), nil
+			}
+		default:
+
+			err = fmt.Errorf("query did not return a supported type(scalar, vector, matrix, string), instead: '%s'. Query: '%s'", result.Type().String(), query)
+
+			return check_x.Unknown, fmt.Sprintf("Error when querying prometheus: %s", err.Error()), err
+		}
+	}
+
+	state, msg, err := evalResult()
+	if err != nil || !options.Stats.Enabled {
+		return state, msg, err
 	}
+
+	return evalQueryStats(state, msg, queryStats, statsThresholds, collection)
+}
+
+// QueryStatsThresholds request the query stats and check the number of samples the query processed and the peak
+// number of samples it held in memory, to find checks which put too much load on the server
+type QueryStatsThresholds struct {
+	Enabled             bool
+	SamplesWarning      string
+	SamplesCritical     string
+	PeakSamplesWarning  string
+	PeakSamplesCritical string
 }
 
-func expandAlias(alias string, labels model.Metric, value float64) string {
-	tmpl, err := template.New("Output").Parse(alias)
-	var output string
+// queryStatsThresholds are the parsed thresholds of the samples and the peak samples
+type queryStatsThresholds struct {
+	samplesWarning, samplesCritical         *check_x.Threshold
+	peakSamplesWarning, peakSamplesCritical *check_x.Threshold
+}
+
+func (t QueryStatsThresholds) thresholds() (queryStatsThresholds, error) {
+	var thresholds queryStatsThresholds
+	var err error
+	thresholds.samplesWarning, thresholds.samplesCritical, err = newThresholds(t.SamplesWarning, t.SamplesCritical)
 	if err != nil {
-		output = alias
-	} else {
-		labelMap := make(map[string]string)
-		for label, value := range labels {
-			var l = fmt.Sprintf("%v", label)
-			var v = fmt.Sprintf("%v", value)
-			labelMap[l] = v
-		}
-		labelMap["xvalue"] = fmt.Sprintf("%v", value)
-		var rendered bytes.Buffer
-		if err := tmpl.Execute(&rendered, labelMap); err != nil {
-			output = alias
-		} else {
-			output = rendered.String()
+		return thresholds, err
+	}
+	thresholds.peakSamplesWarning, thresholds.peakSamplesCritical, err = newThresholds(t.PeakSamplesWarning, t.PeakSamplesCritical)
+
+	return thresholds, err
+}
+
+// evalQueryStats adds the query stats as perfdata and appends the problems to the first line of the message
+func evalQueryStats(state check_x.State, msg string, stats *helper.QueryStats, thresholds queryStatsThresholds, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+	states := check_x.States{state}
+	problems := ""
+	for _, stat := range []struct {
+		label    string
+		value    int64
+		warning  *check_x.Threshold
+		critical *check_x.Threshold
+	}{
+		{"samples", stats.Samples.TotalQueryableSamples, thresholds.samplesWarning, thresholds.samplesCritical},
+		{"peak_samples", stats.Samples.PeakSamples, thresholds.peakSamplesWarning, thresholds.peakSamplesCritical},
+	} {
+		collection.AddPerformanceDataFloat64(stat.label, float64(stat.value))
+		collection.Warn(stat.label, stat.warning)
+		collection.Crit(stat.label, stat.critical)
+		collection.Min(stat.label, 0)
+		statState := check_x.Evaluator{Warning: stat.warning, Critical: stat.critical}.Evaluate(float64(stat.value))
+		if statState.Code != check_x.OK.Code {
+			problems += fmt.Sprintf(", %s %d", strings.ReplaceAll(stat.label, "_", " "), stat.value)
 		}
+		states = append(states, statState)
+	}
+	collection.AddPerformanceDataFloat64("eval_time", stats.Timings.EvalTotalTime)
+	collection.Unit("eval_time", "s")
+	collection.Min("eval_time", 0)
+
+	worst, err := states.GetWorst()
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when picking the worst state out of many states: %s", err.Error()), err
 	}
+	firstLine, longOutput, _ := strings.Cut(msg, "\n")
+	if longOutput != "" {
+		longOutput = "\n" + longOutput
+	}
+
+	return *worst, firstLine + problems + longOutput, nil
+}
+
+// queryString runs a query returning a string with a plain api request
+func queryString(ctx context.Context, address *url.URL, query string, evalTime time.Time) (*model.String, error) {
+	queryURL, err := url.Parse(address.String())
+	if err != nil {
+		return nil, err
+	}
+	queryURL.Path = path.Join(queryURL.Path, "/api/v1/query")
+	queryURL.RawQuery = url.Values{"query": {query}, "time": {strconv.FormatFloat(float64(evalTime.UnixMilli())/1000, 'f', -1, 64)}}.Encode()
+	jsonBytes, err := helper.DoAPIRequest(ctx, queryURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string       `json:"resultType"`
+			Result     model.String `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(jsonBytes, &response); err != nil {
+		return nil, err
+	}
+	if response.Status != "success" {
+		return nil, fmt.Errorf("%s", response.Error)
+	}
+	if response.Data.ResultType != model.ValString.String() {
+		return nil, fmt.Errorf("query returned a %s instead of a string", response.Data.ResultType)
+	}
+
+	return &response.Data.Result, nil
+}
+
+// seriesKey identifies a series without its metric name, which is dropped by most functions
+func seriesKey(metric model.Metric) string {
+	labels := model.LabelSet(metric).Clone()
+	delete(labels, model.MetricNameLabel)
 
-	return output
+	return labels.String()
 }
 
 func replaceLabel(label string, re *regexp.Regexp, replace string) string {
@@ -1,8 +1,17 @@
 package mode
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/consol-monitoring/check_prometheus/internal/helper"
+	"github.com/consol-monitoring/check_x"
 	"github.com/prometheus/common/model"
 )
 
@@ -13,6 +22,7 @@ func TestExpandAlias(t *testing.T) {
 		labels   model.Metric
 		value    float64
 		expected string
+		wantErr  bool
 	}{
 		{
 			name:     "simple template with label",
@@ -55,6 +65,7 @@ func TestExpandAlias(t *testing.T) {
 			labels:   model.Metric{"hostname": "server01"},
 			value:    42.0,
 			expected: "{{invalid template",
+			wantErr:  true,
 		},
 		{
 			name:     "empty alias",
@@ -67,11 +78,160 @@ func TestExpandAlias(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := expandAlias(tt.alias, tt.labels, tt.value)
+			result, err := expandAlias(tt.alias, aliasSeries{Labels: tt.labels, Value: tt.value})
 			if result != tt.expected {
 				t.Errorf("expandAlias(%q, ...) = %q, want %q", tt.alias, result, tt.expected)
 			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expandAlias(%q, ...) error = %v, wantErr %v", tt.alias, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// seriesAgeServer answers instant queries with the result series and the range lookups of the selectors with the
+// samples of the selected series
+func seriesAgeServer(t *testing.T, now time.Time, result string, selected map[string]string) *url.URL {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		query := r.Form.Get("query")
+		if series, ok := selected[query]; ok {
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[%s]}}`, series)
+			return
+		}
+		if strings.HasSuffix(query, "]") {
+			t.Errorf("unexpected range lookup %s", query)
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[%s]}}`, strings.ReplaceAll(result, "NOW", fmt.Sprintf("%d", now.Unix())))
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	return address
+}
+
+func TestQuerySeriesAge(t *testing.T) {
+	now := time.Now()
+	ago := func(age time.Duration) int64 { return now.Add(-age).Unix() }
+	metrics := fmt.Sprintf(`{"metric":{"__name__":"node_time_seconds","instance":"db01"},"values":[[%d,"1"]]},
+		{"metric":{"__name__":"node_time_seconds","instance":"db02"},"values":[[%d,"1"],[%d,"1"]]},
+		{"metric":{"__name__":"node_boot_time_seconds","instance":"db02"},"values":[[%d,"1"]]}`, ago(20*time.Minute), ago(time.Minute), ago(15*time.Second), ago(9*time.Minute))
+
+	tests := []struct {
+		name     string
+		query    string
+		result   string
+		selected map[string]string
+		state    check_x.State
+		stale    []string
+		fresh    []string
+	}{
+		{
+			name:     "selector",
+			query:    "node_time_seconds",
+			result:   `{"metric":{"__name__":"node_time_seconds","instance":"db01"},"value":[NOW,"1"]},{"metric":{"__name__":"node_time_seconds","instance":"db02"},"value":[NOW,"1"]},{"metric":{"__name__":"node_time_seconds","instance":"db03"},"value":[NOW,"1"]}`,
+			selected: map[string]string{"node_time_seconds[10m]": metrics},
+			state:    check_x.Critical,
+			stale:    []string{`[CRITICAL] {__name__="node_time_seconds", instance="db01"} last sample is 20m0s old`, `[CRITICAL] {__name__="node_time_seconds", instance="db03"} has no sample within 10m`},
+			fresh:    []string{"db02"},
+		},
+		{
+			name:     "series of several metrics with the same labels",
+			query:    `{__name__=~"node_time_seconds|node_boot_time_seconds"}`,
+			result:   `{"metric":{"__name__":"node_time_seconds","instance":"db02"},"value":[NOW,"1"]},{"metric":{"__name__":"node_boot_time_seconds","instance":"db02"},"value":[NOW,"1"]}`,
+			selected: map[string]string{`{__name__=~"node_time_seconds|node_boot_time_seconds"}[10m]`: metrics},
+			state:    check_x.Critical,
+			stale:    []string{`[CRITICAL] {__name__="node_boot_time_seconds", instance="db02"} last sample is 9m0s old`},
+			fresh:    []string{`{__name__="node_time_seconds", instance="db02"} last`},
+		},
+		{
+			name:     "aggregation",
+			query:    "sum by (instance) (rate(node_time_seconds[5m]))",
+			result:   `{"metric":{"instance":"db01"},"value":[NOW,"1"]},{"metric":{"instance":"db02"},"value":[NOW,"1"]}`,
+			selected: map[string]string{"node_time_seconds[10m]": metrics},
+			state:    check_x.Critical,
+			stale:    []string{`[CRITICAL] {instance="db01"} last sample is 20m0s old`},
+			fresh:    []string{`{instance="db02"}`},
+		},
+		{
+			name:     "labels which are not selected",
+			query:    `label_replace(node_time_seconds, "host", "$1", "instance", "(.*)")`,
+			result:   `{"metric":{"host":"db02","instance":"db02"},"value":[NOW,"1"]},{"metric":{"host":"db01","instance":"db01"},"value":[NOW,"1"]}`,
+			selected: map[string]string{"node_time_seconds[10m]": metrics},
+			state:    check_x.OK,
+			stale:    []string{`{host="db01", instance="db01"} the age is unknown, no selected series has its labels`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := seriesAgeServer(t, now, tt.result, tt.selected)
+			collection := check_x.NewPerformanceDataCollection()
+			state, msg, err := Query(context.Background(), address, tt.query, QueryOptions{MaxSeriesAge: 5 * time.Minute, StaleState: check_x.Critical}, &collection)
+			if err != nil {
+				t.Fatalf("Query returned error: %s", err)
+			}
+			if state.Code != tt.state.Code {
+				t.Errorf("state = %s, want %s", state.Name, tt.state.Name)
+			}
+			for _, stale := range tt.stale {
+				if !strings.Contains(msg, stale) {
+					t.Errorf("message %q does not contain %q", msg, stale)
+				}
+			}
+			for _, fresh := range tt.fresh {
+				if strings.Contains(msg, fresh) {
+					t.Errorf("message %q reports the fresh series %s", msg, fresh)
+				}
+			}
 		})
 	}
 }
 
+func TestQueryDataAgeOnlyChecksVectors(t *testing.T) {
+	oldTimestampFreshness := helper.TimestampFreshness
+	t.Cleanup(func() { helper.TimestampFreshness = oldTimestampFreshness })
+	helper.TimestampFreshness = 300
+
+	old := float64(time.Now().Add(-time.Hour).Unix())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"job":"node"},"values":[[%f,"1"],[%f,"2"]]}]}}`, old-60, old)
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := Query(context.Background(), address, "up[1h]", QueryOptions{Critical: "3"}, &collection)
+	if err != nil || state.Code != check_x.OK.Code {
+		t.Errorf("old matrix: state = %s, message = %q, err = %v", state.Name, msg, err)
+	}
+}
+
+func TestQueryStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[%d,"12.3"]}],
+			"stats":{"timings":{"evalTotalTime":1.03},"samples":{"totalQueryableSamples":4213780,"peakSamples":8231}}}}`, time.Now().Unix())
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	stats := QueryStatsThresholds{Enabled: true, SamplesCritical: "1000000", PeakSamplesWarning: "10000"}
+	state, msg, err := Query(context.Background(), address, "sum(rate(http_requests_total[1d]))", QueryOptions{Stats: stats}, &collection)
+	if err != nil {
+		t.Fatalf("Query returned error: %s", err)
+	}
+	if state.Code != check_x.Critical.Code {
+		t.Errorf("state = %s, want CRITICAL", state.Name)
+	}
+	if expected := "Query: 'sum(rate(http_requests_total[1d]))', samples 4213780"; msg != expected {
+		t.Errorf("message = %q, want %q", msg, expected)
+	}
+	expected := `'samples'=4213780;;1000000;0; 'peak_samples'=8231;10000;;0; 'eval_time'=1.03s;;;0;`
+	if perfdata := collection.PrintAllPerformanceData(); !strings.Contains(perfdata, expected) {
+		t.Errorf("perfdata = %s, want %s", perfdata, expected)
+	}
+}
@@ -0,0 +1,279 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/consol-monitoring/check_prometheus/internal/helper"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+const (
+	remoteStoragePrefix = "prometheus_remote_storage_"
+	// DefaultMetricsPath is the path prometheus exposes its own metrics on
+	DefaultMetricsPath = "/metrics"
+)
+
+// RemoteWriteThresholds contains the warning and critical thresholds of every value checked per remote write queue
+type RemoteWriteThresholds struct {
+	LagWarning      string
+	LagCritical     string
+	PendingWarning  string
+	PendingCritical string
+	FailedWarning   string
+	FailedCritical  string
+	RetriedWarning  string
+	RetriedCritical string
+	ShardsWarning   string
+	ShardsCritical  string
+}
+
+type remoteWriteQueue struct {
+	name          string
+	url           string
+	highestSent   float64
+	pending       float64
+	sent          float64
+	failed        float64
+	retried       float64
+	shards        float64
+	shardsDesired float64
+	shardsMax     float64
+}
+
+type remoteWriteValue struct {
+	label    string
+	unit     string
+	value    float64
+	warning  *check_x.Threshold
+	critical *check_x.Threshold
+}
+
+// firstMetric returns the value of the first metric name with a sample for the queue, older prometheus versions use other names
+func firstMetric(exposition *helper.Exposition, queueURL string, names ...string) float64 {
+	matchers := []*helper.LabelMatcher{{Name: "url", Operator: "=", Value: queueURL}}
+	for _, name := range names {
+		if samples := exposition.Select(remoteStoragePrefix+name, matchers); len(samples) > 0 {
+			return samples[0].Value
+		}
+	}
+
+	return 0
+}
+
+func newThresholds(warning, critical string) (*check_x.Threshold, *check_x.Threshold, error) {
+	warnThreshold, err := check_x.NewThreshold(warning)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating warningThreshold from '%s' : %s", warning, err.Error())
+	}
+
+	critThreshold, err := check_x.NewThreshold(critical)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating critThreshold from '%s' : %s", critical, err.Error())
+	}
+
+	return warnThreshold, critThreshold, nil
+}
+
+// RemoteWrite scrapes the metrics endpoint of a prometheus server, also in agent mode, and checks every remote write queue:
+// the lag between the newest appended and the newest sent sample, the pending samples, the failed and retried samples
+// per second and the number of shards. The rates are calculated against the values stored in the stateFile by the last run.
+func RemoteWrite(ctx context.Context, address *url.URL, metricsPath string, urls []string, thresholds RemoteWriteThresholds, stateFile string, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+	if address == nil {
+		err := fmt.Errorf("address to query is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if collection == nil {
+		err := fmt.Errorf("collection to store perf data is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	type thresholdPair struct {
+		warning  **check_x.Threshold
+		critical **check_x.Threshold
+		warnDef  string
+		critDef  string
+	}
+	var lagWarn, lagCrit, pendingWarn, pendingCrit, failedWarn, failedCrit, retriedWarn, retriedCrit, shardsWarn, shardsCrit *check_x.Threshold
+	for _, pair := range []thresholdPair{
+		{&lagWarn, &lagCrit, thresholds.LagWarning, thresholds.LagCritical},
+		{&pendingWarn, &pendingCrit, thresholds.PendingWarning, thresholds.PendingCritical},
+		{&failedWarn, &failedCrit, thresholds.FailedWarning, thresholds.FailedCritical},
+		{&retriedWarn, &retriedCrit, thresholds.RetriedWarning, thresholds.RetriedCritical},
+		{&shardsWarn, &shardsCrit, thresholds.ShardsWarning, thresholds.ShardsCritical},
+	} {
+		warn, crit, err := newThresholds(pair.warnDef, pair.critDef)
+		if err != nil {
+			return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+		}
+		*pair.warning = warn
+		*pair.critical = crit
+	}
+
+	if stateFile == "" {
+		var err error
+		stateFile, err = helper.DefaultStateFile("remote_write", address.String())
+		if err != nil {
+			return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+		}
+	}
+	state, err := helper.LoadCounterState(stateFile, time.Now())
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error loading state file: %s", err.Error()), err
+	}
+
+	metricsURL, err := url.Parse(address.String())
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+	if metricsPath == "" {
+		metricsPath = DefaultMetricsPath
+	}
+	metricsURL.Path = path.Join(metricsURL.Path, metricsPath)
+
+	exposition, err := helper.ScrapeMetrics(ctx, metricsURL)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error scraping metrics from %s : %s", metricsURL.Redacted(), err.Error()), err
+	}
+
+	highestTimestamp := 0.0
+	if samples := exposition.Select(remoteStoragePrefix+"highest_timestamp_in_seconds", nil); len(samples) > 0 {
+		highestTimestamp = samples[0].Value
+	}
+
+	queues := map[string]*remoteWriteQueue{}
+	for _, sample := range exposition.Select(remoteStoragePrefix+"shards", nil) {
+		queueURL := sample.Labels["url"]
+		queues[queueURL] = &remoteWriteQueue{name: queueName(sample.Labels["remote_name"], queueURL), url: queueURL}
+	}
+
+	states := check_x.States{check_x.OK}
+	problems := []string{}
+
+	queueURLs := urls
+	if len(queueURLs) == 0 {
+		for queueURL := range queues {
+			queueURLs = append(queueURLs, queueURL)
+		}
+		sort.Strings(queueURLs)
+	}
+	if len(queueURLs) == 0 {
+		states = append(states, check_x.Critical)
+		problems = append(problems, "no remote write queue found")
+	}
+
+	details := ""
+	for _, queueURL := range queueURLs {
+		queue, ok := queues[queueURL]
+		if !ok {
+			states = append(states, check_x.Critical)
+			problems = append(problems, fmt.Sprintf("remote write queue %s not found", queueURL))
+			continue
+		}
+
+		queue.highestSent = firstMetric(exposition, queueURL, "queue_highest_sent_timestamp_seconds")
+		queue.pending = firstMetric(exposition, queueURL, "samples_pending", "pending_samples")
+		queue.sent = firstMetric(exposition, queueURL, "samples_total", "succeeded_samples_total")
+		queue.failed = firstMetric(exposition, queueURL, "samples_failed_total", "failed_samples_total")
+		queue.retried = firstMetric(exposition, queueURL, "samples_retried_total", "retried_samples_total")
+		queue.shards = firstMetric(exposition, queueURL, "shards")
+		queue.shardsDesired = firstMetric(exposition, queueURL, "shards_desired")
+		queue.shardsMax = firstMetric(exposition, queueURL, "shards_max")
+
+		lag := highestTimestamp - queue.highestSent
+		if lag < 0 {
+			lag = 0
+		}
+
+		values := []remoteWriteValue{
+			{label: "lag", unit: "s", value: lag, warning: lagWarn, critical: lagCrit},
+			{label: "pending", value: queue.pending, warning: pendingWarn, critical: pendingCrit},
+			{label: "shards", value: queue.shards, warning: shardsWarn, critical: shardsCrit},
+		}
+		rates := ""
+		sentRate, hasRates := state.Rate(queueURL+"_sent", queue.sent)
+		failedRate, _ := state.Rate(queueURL+"_failed", queue.failed)
+		retriedRate, _ := state.Rate(queueURL+"_retried", queue.retried)
+		if hasRates {
+			values = append(values,
+				remoteWriteValue{label: "sent_rate", value: sentRate},
+				remoteWriteValue{label: "failed_rate", value: failedRate, warning: failedWarn, critical: failedCrit},
+				remoteWriteValue{label: "retried_rate", value: retriedRate, warning: retriedWarn, critical: retriedCrit},
+			)
+			rates = fmt.Sprintf(", Sent: %.2f/s, Failed: %.2f/s, Retried: %.2f/s", sentRate, failedRate, retriedRate)
+		} else {
+			rates = ", no rates until the next run"
+		}
+
+		queueStates := check_x.States{check_x.OK}
+		for _, value := range values {
+			valueState := check_x.Evaluator{Warning: value.warning, Critical: value.critical}.Evaluate(value.value)
+			if valueState.Code != check_x.OK.Code {
+				problems = append(problems, fmt.Sprintf("%s %s is %.2f%s", queue.name, value.label, value.value, value.unit))
+			}
+			queueStates = append(queueStates, valueState)
+
+			perfLabel := queue.name + "_" + value.label
+			collection.AddPerformanceDataFloat64(perfLabel, value.value)
+			if value.unit != "" {
+				collection.Unit(perfLabel, value.unit)
+			}
+			collection.Warn(perfLabel, value.warning)
+			collection.Crit(perfLabel, value.critical)
+			collection.Min(perfLabel, 0)
+			if value.label == "shards" && queue.shardsMax > 0 {
+				collection.Max(perfLabel, queue.shardsMax)
+			}
+		}
+		collection.AddPerformanceDataFloat64(queue.name+"_shards_desired", queue.shardsDesired)
+		collection.Min(queue.name+"_shards_desired", 0)
+
+		queueState, err := queueStates.GetWorst()
+		if err != nil {
+			return check_x.Unknown, fmt.Sprintf("Error when picking the worst state out of many states: %s", err.Error()), err
+		}
+		states = append(states, *queueState)
+		details += fmt.Sprintf("[%s] Queue: %s, URL: %s, Lag: %.2fs, Pending: %.0f, Shards: %.0f (desired %.2f, max %.0f)%s\n",
+			queueState.Name, queue.name, queue.url, lag, queue.pending, queue.shards, queue.shardsDesired, queue.shardsMax, rates)
+	}
+
+	if err := state.Save(); err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error saving state file: %s", err.Error()), err
+	}
+
+	worst, err := states.GetWorst()
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when picking the worst state out of many states: %s", err.Error()), err
+	}
+
+	msg := fmt.Sprintf("%d remote write queues", len(queueURLs))
+	if len(problems) > 0 {
+		msg += ", " + strings.Join(problems, ", ")
+	}
+	if details != "" {
+		msg += "\n" + strings.TrimSuffix(details, "\n")
+	}
+
+	return *worst, msg, nil
+}
+
+// queueName returns the remote_name of the queue, unnamed queues are named by the host and path of their url so
+// their perfdata labels don't collide
+func queueName(remoteName, queueURL string) string {
+	if remoteName != "" {
+		return remoteName
+	}
+	parsed, err := url.Parse(queueURL)
+	if err != nil || parsed.Host == "" {
+		return queueURL
+	}
+
+	return parsed.Host + parsed.Path
+}
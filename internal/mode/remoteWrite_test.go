@@ -0,0 +1,103 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+func TestRemoteWrite(t *testing.T) {
+	failed := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		queue := `remote_name="5dc8e1",url="https://aps.example/api/v1/remote_write"`
+		fmt.Fprintf(w, "prometheus_remote_storage_highest_timestamp_in_seconds 1700000400\n")
+		fmt.Fprintf(w, "prometheus_remote_storage_queue_highest_sent_timestamp_seconds{%s} 1700000000\n", queue)
+		fmt.Fprintf(w, "prometheus_remote_storage_samples_pending{%s} 1500\n", queue)
+		fmt.Fprintf(w, "prometheus_remote_storage_samples_total{%s} 100000\n", queue)
+		fmt.Fprintf(w, "prometheus_remote_storage_samples_failed_total{%s} %d\n", queue, failed)
+		fmt.Fprintf(w, "prometheus_remote_storage_samples_retried_total{%s} 0\n", queue)
+		fmt.Fprintf(w, "prometheus_remote_storage_shards{%s} 4\n", queue)
+		fmt.Fprintf(w, "prometheus_remote_storage_shards_desired{%s} 3.5\n", queue)
+		fmt.Fprintf(w, "prometheus_remote_storage_shards_max{%s} 50\n", queue)
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	thresholds := RemoteWriteThresholds{LagWarning: "120", LagCritical: "600", FailedCritical: "0"}
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := RemoteWrite(context.Background(), address, "", nil, thresholds, stateFile, &collection)
+	if err != nil {
+		t.Fatalf("RemoteWrite returned error: %s", err)
+	}
+	if state.Code != check_x.Warning.Code {
+		t.Errorf("state = %s, want WARNING", state.Name)
+	}
+	if !strings.HasPrefix(msg, "1 remote write queues, 5dc8e1 lag is 400.00s\n") || !strings.Contains(msg, "no rates until the next run") {
+		t.Errorf("unexpected message %q", msg)
+	}
+
+	// The second run calculates the rates against the first one
+	failed = 10
+	collection = check_x.NewPerformanceDataCollection()
+	state, msg, err = RemoteWrite(context.Background(), address, "", nil, thresholds, stateFile, &collection)
+	if err != nil {
+		t.Fatalf("RemoteWrite returned error: %s", err)
+	}
+	if state.Code != check_x.Critical.Code {
+		t.Errorf("state = %s, want CRITICAL", state.Name)
+	}
+	if !strings.Contains(msg, "5dc8e1 failed_rate is") {
+		t.Errorf("message %q does not report the failed samples", msg)
+	}
+}
+
+func TestRemoteWriteUnnamedQueues(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, queue := range []string{`remote_name="",url="https://mimir.example/api/v1/push"`, `url="https://backup.example/api/v1/push"`} {
+			fmt.Fprintf(w, "prometheus_remote_storage_shards{%s} 4\n", queue)
+		}
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	_, _, err := RemoteWrite(context.Background(), address, "", nil, RemoteWriteThresholds{}, filepath.Join(t.TempDir(), "state.json"), &collection)
+	if err != nil {
+		t.Fatalf("RemoteWrite returned error: %s", err)
+	}
+	perfdata := collection.PrintAllPerformanceData()
+	for _, expected := range []string{"'mimir.example/api/v1/push_shards'=4", "'backup.example/api/v1/push_shards'=4"} {
+		if !strings.Contains(perfdata, expected) {
+			t.Errorf("perfdata %q does not contain %q", perfdata, expected)
+		}
+	}
+}
+
+func TestRemoteWriteErrorHidesPassword(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html>Internal Server Error</html>")
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+	address.User = url.UserPassword("monitoring", "secret")
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := RemoteWrite(context.Background(), address, "", nil, RemoteWriteThresholds{}, filepath.Join(t.TempDir(), "state.json"), &collection)
+	if err == nil || state.Code != check_x.Unknown.Code {
+		t.Fatalf("state = %s, err = %v, want UNKNOWN", state.Name, err)
+	}
+	if strings.Contains(msg, "secret") || !strings.Contains(msg, "monitoring:xxxxx@") {
+		t.Errorf("message = %q", msg)
+	}
+}
@@ -0,0 +1,69 @@
+package mode
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/consol-monitoring/check_prometheus/internal/helper"
+	"github.com/consol-monitoring/check_x"
+)
+
+// replayAddress serves the responses recorded with --record out of testdata/replay, nothing listens on it
+func replayAddress(t *testing.T) *url.URL {
+	t.Helper()
+	helper.ReplayDir = "testdata/replay"
+	t.Cleanup(func() { helper.ReplayDir = "" })
+	address, _ := url.Parse("http://prometheus.invalid:9090")
+
+	return address
+}
+
+func TestReplayPing(t *testing.T) {
+	address := replayAddress(t)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := Ping(context.Background(), address, &collection)
+	if err != nil {
+		t.Fatalf("Ping returned error: %s", err)
+	}
+	if state.Code != check_x.OK.Code || msg != "Version: 3.7.1, Instance localhost:9090" {
+		t.Errorf("state = %s, message = %q", state.Name, msg)
+	}
+}
+
+func TestReplayTargetsHealth(t *testing.T) {
+	address := replayAddress(t)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := TargetsHealth(context.Background(), address, "", "", "0.9:", "", "", nil, nil, nil, 0, &collection)
+	if err != nil {
+		t.Fatalf("TargetsHealth returned error: %s", err)
+	}
+	if state.Code != check_x.Critical.Code {
+		t.Errorf("state = %s, want CRITICAL", state.Name)
+	}
+	if !strings.HasPrefix(msg, "There are 2 healthy and 1 unhealthy targets") || !strings.Contains(msg, "Instance: db02:9100, Health: down, Last Error: context deadline exceeded") {
+		t.Errorf("message = %q", msg)
+	}
+}
+
+func TestReplayQuery(t *testing.T) {
+	address := replayAddress(t)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := Query(context.Background(), address, "up", QueryOptions{Warning: "1:"}, &collection)
+	if err != nil {
+		t.Fatalf("Query returned error: %s", err)
+	}
+	if state.Code != check_x.Warning.Code || !strings.HasPrefix(msg, "Query: 'up'") {
+		t.Errorf("state = %s, message = %q", state.Name, msg)
+	}
+
+	// Queries which were never recorded fail instead of reaching the network
+	state, _, err = Query(context.Background(), address, "down", QueryOptions{}, &collection)
+	if err == nil || state.Code != check_x.Unknown.Code || !strings.Contains(err.Error(), "no recorded response") {
+		t.Errorf("unrecorded query: state = %s, err = %v", state.Name, err)
+	}
+}
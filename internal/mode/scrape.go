@@ -0,0 +1,249 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/consol-monitoring/check_prometheus/internal/helper"
+
+	"github.com/consol-monitoring/check_x"
+	"github.com/prometheus/common/model"
+)
+
+// ScrapeExpression describes how the scraped samples are turned into the checked values
+type ScrapeExpression struct {
+	Metric   string
+	Matchers []string
+	// Rate converts the counters into per second rates against the values of the last run
+	Rate bool
+	// Sum adds all series up into a single value
+	Sum bool
+	// DivideBy is the metric the values are divided by, series are matched by their labels without the metric name
+	DivideBy         string
+	DivideByMatchers []string
+}
+
+// String returns the expression in a PromQL like syntax
+func (e *ScrapeExpression) String() string {
+	expression := selectorString(e.Metric, e.Matchers)
+	divisor := selectorString(e.DivideBy, e.DivideByMatchers)
+	if e.Rate {
+		expression = fmt.Sprintf("rate(%s)", expression)
+		divisor = fmt.Sprintf("rate(%s)", divisor)
+	}
+	if e.DivideBy != "" {
+		expression = fmt.Sprintf("%s / %s", expression, divisor)
+	}
+	if e.Sum {
+		expression = fmt.Sprintf("sum(%s)", expression)
+	}
+
+	return expression
+}
+
+func selectorString(metric string, matchers []string) string {
+	if len(matchers) == 0 {
+		return metric
+	}
+	return metric + "{" + strings.Join(matchers, ", ") + "}"
+}
+
+// scrapeValues selects the samples of the metric and converts them into rates if requested
+func scrapeValues(exposition *helper.Exposition, metric string, matcherDefs []string, rate bool, state *helper.CounterState) (model.Vector, bool, error) {
+	matchers, err := helper.ParseLabelMatchers(matcherDefs)
+	if err != nil {
+		return nil, false, err
+	}
+
+	vector := model.Vector{}
+	complete := true
+	for _, sample := range exposition.Select(metric, matchers) {
+		sampleMetric := model.Metric{model.MetricNameLabel: model.LabelValue(sample.Name)}
+		for name, value := range sample.Labels {
+			sampleMetric[model.LabelName(name)] = model.LabelValue(value)
+		}
+
+		value := sample.Value
+		// Counters which are NaN or infinite have no rate, they keep their value instead of waiting for another run
+		if rate && !math.IsNaN(value) && !math.IsInf(value, 0) {
+			var ok bool
+			value, ok = state.Rate(helper.LabelsKey(sample.Name, sample.Labels), sample.Value)
+			if !ok {
+				complete = false
+				continue
+			}
+		}
+		vector = append(vector, &model.Sample{Metric: sampleMetric, Value: model.SampleValue(value)})
+	}
+
+	return vector, complete, nil
+}
+
+// evaluateScrapeExpression applies the division and sum of the expression on the scraped samples.
+// False is returned if the rates can not be calculated before the next run.
+func evaluateScrapeExpression(exposition *helper.Exposition, expression *ScrapeExpression, state *helper.CounterState) (model.Vector, bool, error) {
+	vector, complete, err := scrapeValues(exposition, expression.Metric, expression.Matchers, expression.Rate, state)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if expression.DivideBy != "" {
+		divisors, divisorsComplete, err := scrapeValues(exposition, expression.DivideBy, expression.DivideByMatchers, expression.Rate, state)
+		if err != nil {
+			return nil, false, err
+		}
+		complete = complete && divisorsComplete
+
+		if expression.Sum {
+			return model.Vector{&model.Sample{
+				Metric: model.Metric{},
+				Value:  model.SampleValue(float64(sumVector(vector)) / float64(sumVector(divisors))),
+			}}, complete, nil
+		}
+
+		divisorByKey := map[string]model.SampleValue{}
+		for _, divisor := range divisors {
+			divisorByKey[seriesKey(divisor.Metric)] = divisor.Value
+		}
+		ratios := model.Vector{}
+		for _, sample := range vector {
+			divisor, ok := divisorByKey[seriesKey(sample.Metric)]
+			if !ok {
+				continue
+			}
+			metric := sample.Metric.Clone()
+			delete(metric, model.MetricNameLabel)
+			ratios = append(ratios, &model.Sample{Metric: metric, Value: sample.Value / divisor})
+		}
+		vector = ratios
+	}
+
+	if expression.Sum {
+		return model.Vector{&model.Sample{Metric: model.Metric{}, Value: sumVector(vector)}}, complete, nil
+	}
+
+	return vector, complete, nil
+}
+
+func sumVector(vector model.Vector) model.SampleValue {
+	var sum model.SampleValue
+	for _, sample := range vector {
+		sum += sample.Value
+	}
+
+	return sum
+}
+
+// Scrape fetches the metrics endpoint of an exporter directly, without a prometheus server, evaluates the expression
+// and checks the resulting values like the query mode does with a vector. The perfdata labels are escaped and made
+// unique, and truncated if perfdataLabelLength is set.
+func Scrape(ctx context.Context, address *url.URL, metricsPath string, expression *ScrapeExpression, warning, critical string, templates OutputTemplates, search, replace string, perfdataLabelLength int, emptyQueryMessage string, emptyQueryStatus check_x.State, stateFile string, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+	if address == nil {
+		err := fmt.Errorf("address to query is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if collection == nil {
+		err := fmt.Errorf("collection to store perf data is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if expression == nil || expression.Metric == "" {
+		err := fmt.Errorf("metric to scrape is empty")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	warnThreshold, critThreshold, err := newThresholds(warning, critical)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	var re *regexp.Regexp
+	if search != "" {
+		re, err = regexp.Compile(search)
+		if err != nil {
+			return check_x.Unknown, fmt.Sprintf("Error creating regex from '%s' : %s", search, err.Error()), err
+		}
+	}
+
+	if stateFile == "" {
+		stateFile, err = helper.DefaultStateFile("scrape", address.String()+expression.String())
+		if err != nil {
+			return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+		}
+	}
+	state, err := helper.LoadCounterState(stateFile, time.Now())
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error loading state file: %s", err.Error()), err
+	}
+
+	metricsURL, err := url.Parse(address.String())
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+	if metricsPath == "" {
+		metricsPath = DefaultMetricsPath
+	}
+	metricsURL.Path = path.Join(metricsURL.Path, metricsPath)
+
+	exposition, err := helper.ScrapeMetrics(ctx, metricsURL)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error scraping metrics from %s : %s", metricsURL.Redacted(), err.Error()), err
+	}
+
+	vector, complete, err := evaluateScrapeExpression(exposition, expression, state)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error evaluating '%s': %s", expression.String(), err.Error()), err
+	}
+
+	if expression.Rate {
+		if err := state.Save(); err != nil {
+			return check_x.Unknown, fmt.Sprintf("Error saving state file: %s", err.Error()), err
+		}
+		if !complete {
+			return check_x.Unknown, fmt.Sprintf("Scrape: '%s' needs a second run to calculate the rates", expression.String()), nil
+		}
+	}
+
+	if len(vector) == 0 {
+		if emptyQueryMessage != "" {
+			return emptyState(check_x.State{}, emptyQueryStatus), emptyQueryMessage, nil
+		}
+		return emptyState(check_x.State{}, emptyQueryStatus), fmt.Sprintf("Scrape: '%s' returned no data.", expression.String()), nil
+	}
+
+	states := check_x.States{}
+	output := ""
+	series := []aliasSeries{}
+	var templateErr error
+	perfdataLabels := newPerfdataLabels(perfdataLabelLength)
+	for _, sample := range vector {
+		sampleValue := float64(sample.Value)
+		label := model.LabelSet(sample.Metric).String()
+		if len(sample.Metric) == 0 {
+			label = expression.String()
+		}
+		label = perfdataLabels.label(replaceLabel(label, re, replace))
+		collection.AddPerformanceDataFloat64(label, sampleValue)
+		collection.Warn(label, warnThreshold)
+		collection.Crit(label, critThreshold)
+		sampleState := check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(sampleValue)
+		states = append(states, sampleState)
+		aliasData := aliasSeries{Labels: sample.Metric, Value: sampleValue, State: sampleState, Warning: warning, Critical: critical}
+		rendered, err := expandAlias(templates.Alias, aliasData)
+		if err != nil && templateErr == nil {
+			templateErr = err
+		}
+		output += rendered
+		aliasData.Alias = rendered
+		series = append(series, aliasData)
+	}
+
+	return evalSeriesStates(states, output, expression.String(), "", "", templates, series, templateErr)
+}
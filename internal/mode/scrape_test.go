@@ -0,0 +1,109 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+func TestScrape(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `# TYPE node_filesystem_avail_bytes gauge
+node_filesystem_avail_bytes{mountpoint="/",fstype="ext4"} 50
+node_filesystem_avail_bytes{mountpoint="/var",fstype="ext4"} 5
+node_filesystem_avail_bytes{mountpoint="/run",fstype="tmpfs"} 1
+# TYPE node_filesystem_size_bytes gauge
+node_filesystem_size_bytes{mountpoint="/",fstype="ext4"} 100
+node_filesystem_size_bytes{mountpoint="/var",fstype="ext4"} 100
+node_filesystem_size_bytes{mountpoint="/run",fstype="tmpfs"} 100
+`)
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	tests := []struct {
+		name       string
+		expression ScrapeExpression
+		state      check_x.State
+		perfdata   []string
+	}{
+		{
+			name:       "ratio per series",
+			expression: ScrapeExpression{Metric: "node_filesystem_avail_bytes", Matchers: []string{"fstype!=tmpfs"}, DivideBy: "node_filesystem_size_bytes"},
+			state:      check_x.Critical,
+			perfdata:   []string{`'{fstype:"ext4", mountpoint:"/"}'=0.5`, `'{fstype:"ext4", mountpoint:"/var"}'=0.05`},
+		},
+		{
+			name:       "ratio of sums",
+			expression: ScrapeExpression{Metric: "node_filesystem_avail_bytes", Matchers: []string{"fstype=ext4"}, DivideBy: "node_filesystem_size_bytes", DivideByMatchers: []string{"fstype=ext4"}, Sum: true},
+			state:      check_x.OK,
+			perfdata:   []string{`'sum(node_filesystem_avail_bytes{fstype:ext4} / node_filesystem_size_bytes{fstype:ext4})'=0.275`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collection := check_x.NewPerformanceDataCollection()
+			state, _, err := Scrape(context.Background(), address, "", &tt.expression, "", "0.1:", OutputTemplates{}, "", "", 0, "", check_x.Unknown, filepath.Join(t.TempDir(), "state.json"), &collection)
+			if err != nil {
+				t.Fatalf("Scrape returned error: %s", err)
+			}
+			if state.Code != tt.state.Code {
+				t.Errorf("state = %s, want %s", state.Name, tt.state.Name)
+			}
+			perfdata := collection.PrintAllPerformanceData()
+			for _, expected := range tt.perfdata {
+				if !strings.Contains(perfdata, expected) {
+					t.Errorf("perfdata %q does not contain %q", perfdata, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestScrapePerfdataLabels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `# TYPE node_filesystem_avail_bytes gauge
+node_filesystem_avail_bytes{mountpoint="/var/lib/docker"} 50
+node_filesystem_avail_bytes{mountpoint="/var/lib/kubelet"} 5
+`)
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	expression := ScrapeExpression{Metric: "node_filesystem_avail_bytes"}
+	_, _, err := Scrape(context.Background(), address, "", &expression, "", "", OutputTemplates{}, "", "", 20, "", check_x.Unknown, filepath.Join(t.TempDir(), "state.json"), &collection)
+	if err != nil {
+		t.Fatalf("Scrape returned error: %s", err)
+	}
+	if perfdata := collection.PrintAllPerformanceData(); !strings.Contains(perfdata, `'{__name__:"node_file'=50`) || !strings.Contains(perfdata, `'{__name__:"node_fi_2'=5`) {
+		t.Errorf("perfdata = %q", perfdata)
+	}
+}
+
+func TestScrapeErrorHidesPassword(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html>Internal Server Error</html>")
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+	address.User = url.UserPassword("monitoring", "secret")
+
+	collection := check_x.NewPerformanceDataCollection()
+	expression := ScrapeExpression{Metric: "up"}
+	state, msg, err := Scrape(context.Background(), address, "", &expression, "", "", OutputTemplates{}, "", "", 0, "", check_x.Unknown, filepath.Join(t.TempDir(), "state.json"), &collection)
+	if err == nil || state.Code != check_x.Unknown.Code {
+		t.Fatalf("state = %s, err = %v, want UNKNOWN", state.Name, err)
+	}
+	if strings.Contains(msg, "secret") || !strings.Contains(msg, "monitoring:xxxxx@") {
+		t.Errorf("message = %q", msg)
+	}
+}
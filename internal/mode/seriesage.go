@@ -0,0 +1,121 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// defaultLookbackDelta is the default lookback of prometheus, every series of an instant query result has a sample
+// within it
+const defaultLookbackDelta = 5 * time.Minute
+
+// selectedSeries is a series selected by a vector selector of a query and the time of its last sample
+type selectedSeries struct {
+	metric     model.Metric
+	lastSample model.Time
+}
+
+// seriesTimes knows the time of the last sample of the series a query selects
+type seriesTimes struct {
+	// direct is set if the query is a single vector selector, its result series are the selected series
+	direct bool
+	window time.Duration
+	series []selectedSeries
+}
+
+// lastSampleTimes looks up the time of the last sample of the series of every vector selector of the query. Instant
+// queries return the evaluation time as timestamp and timestamp() only works on selectors, so every selector is
+// queried as range over the maximum age plus the lookback, which returns the raw samples with all their labels.
+func lastSampleTimes(ctx context.Context, apiClient v1.API, expr parser.Expr, maxAge time.Duration, evalTime time.Time) (*seriesTimes, error) {
+	times := &seriesTimes{window: maxAge + defaultLookbackDelta}
+	unwrapped := expr
+	for {
+		paren, ok := unwrapped.(*parser.ParenExpr)
+		if !ok {
+			break
+		}
+		unwrapped = paren.Expr
+	}
+	_, times.direct = unwrapped.(*parser.VectorSelector)
+
+	selectors := []string{}
+	seen := map[string]bool{}
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		selector, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+		// The samples of now are looked up, not the ones of the offset or @ modifier
+		plain := &parser.VectorSelector{Name: selector.Name, LabelMatchers: selector.LabelMatchers}
+		if text := plain.String(); !seen[text] {
+			seen[text] = true
+			selectors = append(selectors, text)
+		}
+		return nil
+	})
+	if len(selectors) == 0 {
+		return nil, fmt.Errorf("the query selects no series")
+	}
+
+	for _, selector := range selectors {
+		result, _, err := apiClient.Query(ctx, fmt.Sprintf("%s[%s]", selector, model.Duration(times.window)), evalTime)
+		if err != nil {
+			return nil, err
+		}
+		matrix, ok := result.(model.Matrix)
+		if !ok {
+			return nil, fmt.Errorf("range lookup of '%s' returned a %s instead of a matrix", selector, result.Type().String())
+		}
+		for _, stream := range matrix {
+			var last model.Time
+			if len(stream.Values) > 0 {
+				last = stream.Values[len(stream.Values)-1].Timestamp
+			}
+			if len(stream.Histograms) > 0 && stream.Histograms[len(stream.Histograms)-1].Timestamp > last {
+				last = stream.Histograms[len(stream.Histograms)-1].Timestamp
+			}
+			times.series = append(times.series, selectedSeries{metric: stream.Metric, lastSample: last})
+		}
+	}
+
+	return times, nil
+}
+
+// lastSample returns the time of the last sample of a result series. The series of a single selector are matched
+// by all their labels including the metric name. Otherwise the newest of all selected series which carry the labels
+// of the result series is taken, e.g. an aggregation is stale if all of its input series are.
+func (t *seriesTimes) lastSample(metric model.Metric) (model.Time, bool) {
+	var newest model.Time
+	found := false
+	for _, selected := range t.series {
+		if t.direct {
+			if selected.metric.Equal(metric) {
+				return selected.lastSample, true
+			}
+			continue
+		}
+		if carriesLabels(selected.metric, metric) && (!found || selected.lastSample > newest) {
+			newest = selected.lastSample
+			found = true
+		}
+	}
+
+	return newest, found
+}
+
+// carriesLabels checks if the selected series has every label of the result series, a metric name the functions of
+// the query dropped doesn't matter
+func carriesLabels(selected, result model.Metric) bool {
+	for name, value := range result {
+		if selected[name] != value {
+			return false
+		}
+	}
+
+	return true
+}
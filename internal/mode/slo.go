@@ -0,0 +1,238 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/consol-monitoring/check_prometheus/internal/helper"
+
+	"github.com/consol-monitoring/check_x"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// BurnRateWindow is an alert of the multiwindow, multi-burn-rate approach: it fires with State if the burn rate
+// over the long and the short window exceed the factor
+type BurnRateWindow struct {
+	Long   time.Duration
+	Short  time.Duration
+	Factor float64
+	State  check_x.State
+}
+
+// DefaultBurnRateWindows returns the window pairs of the SRE workbook, two fast burning pages and a slow burning ticket.
+// The factors are applied in the given order, missing ones keep the default.
+func DefaultBurnRateWindows(factors []float64) []BurnRateWindow {
+	windows := []BurnRateWindow{
+		{Long: time.Hour, Short: 5 * time.Minute, Factor: 14.4, State: check_x.Critical},
+		{Long: 6 * time.Hour, Short: 30 * time.Minute, Factor: 6, State: check_x.Critical},
+		{Long: 3 * 24 * time.Hour, Short: 6 * time.Hour, Factor: 1, State: check_x.Warning},
+	}
+	for i := range windows {
+		if i < len(factors) {
+			windows[i].Factor = factors[i]
+		}
+	}
+
+	return windows
+}
+
+// errorRatioQuery returns the query of the share of failed requests over the window, out of either the good or the
+// error selector. Missing good or error series count as none, so the result is only empty without total series.
+func errorRatioQuery(goodSelector, errorSelector, totalSelector string, window time.Duration) string {
+	duration := formatWindow(window)
+	if errorSelector != "" {
+		return fmt.Sprintf("(sum(rate(%s[%s])) or vector(0)) / sum(rate(%s[%s]))", errorSelector, duration, totalSelector, duration)
+	}
+
+	return fmt.Sprintf("1 - (sum(rate(%s[%s])) or vector(0)) / sum(rate(%s[%s]))", goodSelector, duration, totalSelector, duration)
+}
+
+// validateSelector makes sure the selector is a plain series selector, the range is appended to it
+func validateSelector(selector string) error {
+	expr, err := parseQuery(selector)
+	if err != nil {
+		return err
+	}
+	if _, ok := expr.(*parser.VectorSelector); !ok {
+		return fmt.Errorf("'%s' is no series selector", selector)
+	}
+
+	return nil
+}
+
+// formatWindow returns the window in the PromQL duration syntax, e.g. 3d
+func formatWindow(window time.Duration) string {
+	return model.Duration(window).String()
+}
+
+// SLO checks a service level objective with multiwindow, multi-burn-rate alerts. The error ratio is calculated out
+// of either the good or the error selector against the total selector. The objective is a ratio like 0.999, values
+// above 1 are taken as percentage. The warning and critical thresholds are applied on the remaining error budget of
+// the period in percent. All windows are queried concurrently. Without total series the result is UNKNOWN, a total of
+// 0 requests has no errors.
+func SLO(ctx context.Context, address *url.URL, goodSelector, errorSelector, totalSelector string, objective float64, period time.Duration, windows []BurnRateWindow, warning, critical string, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+	if address == nil {
+		err := fmt.Errorf("address to query is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if collection == nil {
+		err := fmt.Errorf("collection to store perf data is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if (goodSelector == "") == (errorSelector == "") || totalSelector == "" {
+		err := fmt.Errorf("either the good or the error selector and the total selector are required")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+	for _, selector := range []string{goodSelector, errorSelector, totalSelector} {
+		if selector == "" {
+			continue
+		}
+		if err := validateSelector(selector); err != nil {
+			return check_x.Unknown, fmt.Sprintf("Error parsing selector: %s", err.Error()), err
+		}
+	}
+
+	if objective > 1 {
+		objective /= 100
+	}
+	if objective <= 0 || objective >= 1 {
+		err := fmt.Errorf("objective has to be between 0 and 1 or 0 and 100 percent")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+	// Objectives have few decimals, rounding avoids burn rates like 14.999999999999986 out of 1 - 0.99
+	errorBudget := math.Round((1-objective)*1e12) / 1e12
+
+	warnThreshold, critThreshold, err := newThresholds(warning, critical)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	apiClient, err := helper.NewAPIClientV1(address)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error creating apiClient: %s", err.Error()), err
+	}
+
+	windowDurations := []time.Duration{}
+	for _, window := range windows {
+		for _, duration := range []time.Duration{window.Long, window.Short} {
+			if !slices.Contains(windowDurations, duration) {
+				windowDurations = append(windowDurations, duration)
+			}
+		}
+	}
+	durations := windowDurations
+	if !slices.Contains(durations, period) {
+		durations = append(slices.Clone(durations), period)
+	}
+
+	// Every window is queried at the same time, so they are all based on the same data
+	evalTime := time.Now()
+	errorRatios := make(map[time.Duration]float64, len(durations))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var queryErr error
+	for _, duration := range durations {
+		wg.Add(1)
+		go func(duration time.Duration) {
+			defer wg.Done()
+			query := errorRatioQuery(goodSelector, errorSelector, totalSelector, duration)
+			result, _, err := apiClient.Query(ctx, query, evalTime)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				if queryErr == nil {
+					queryErr = fmt.Errorf("query '%s' failed: %s", query, err.Error())
+				}
+				return
+			}
+			vector, ok := result.(model.Vector)
+			if !ok || len(vector) == 0 {
+				// A typo in the selector or a dead exporter must not look like a service without errors
+				if queryErr == nil {
+					queryErr = fmt.Errorf("the total selector '%s' returned no series over %s", totalSelector, formatWindow(duration))
+				}
+				return
+			}
+			errorRatios[duration] = float64(vector[0].Value)
+		}(duration)
+	}
+	wg.Wait()
+	if queryErr != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when querying: %s", queryErr.Error()), queryErr
+	}
+
+	// A total of 0 requests results in NaN, without requests there are no errors either
+	burnRate := func(duration time.Duration) float64 {
+		ratio := errorRatios[duration]
+		if math.IsNaN(ratio) {
+			return 0
+		}
+		return ratio / errorBudget
+	}
+
+	states := check_x.States{check_x.OK}
+	problems := []string{}
+	details := ""
+	for _, window := range windows {
+		long, short := burnRate(window.Long), burnRate(window.Short)
+		windowState := check_x.OK
+		if long > window.Factor && short > window.Factor {
+			windowState = window.State
+			problems = append(problems, fmt.Sprintf("burning %.1fx over %s", long, formatWindow(window.Long)))
+		}
+		states = append(states, windowState)
+		details += fmt.Sprintf("[%s] %s/%s burn rate %.2f/%.2f, alerting above %s\n", windowState.Name, formatWindow(window.Long), formatWindow(window.Short),
+			long, short, strconv.FormatFloat(window.Factor, 'f', -1, 64))
+	}
+	for _, duration := range windowDurations {
+		perfLabel := "burn_rate_" + formatWindow(duration)
+		collection.AddPerformanceDataFloat64(perfLabel, burnRate(duration))
+		collection.Min(perfLabel, 0)
+	}
+
+	periodRatio := errorRatios[period]
+	// No requests over the whole period, the budget is untouched
+	if math.IsNaN(periodRatio) {
+		periodRatio = 0
+	}
+	budgetRemaining := (1 - periodRatio/errorBudget) * 100
+	budgetState := check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(budgetRemaining)
+	if budgetState.Code != check_x.OK.Code {
+		problems = append(problems, fmt.Sprintf("error budget remaining is %.2f%%", budgetRemaining))
+	}
+	states = append(states, budgetState)
+	collection.AddPerformanceDataFloat64("error_budget_remaining", budgetRemaining)
+	collection.Unit("error_budget_remaining", "%")
+	collection.Warn("error_budget_remaining", warnThreshold)
+	collection.Crit("error_budget_remaining", critThreshold)
+	collection.Max("error_budget_remaining", 100)
+	collection.AddPerformanceDataFloat64("availability", (1-periodRatio)*100)
+	collection.Unit("availability", "%")
+	collection.Min("availability", 0)
+	collection.Max("availability", 100)
+
+	state, err := states.GetWorst()
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when picking the worst state out of many states: %s", err.Error()), err
+	}
+
+	msg := fmt.Sprintf("SLO %s%% over %s: availability %.3f%%, error budget remaining %.2f%%",
+		strconv.FormatFloat(objective*100, 'f', -1, 64), formatWindow(period), (1-periodRatio)*100, budgetRemaining)
+	if len(problems) > 0 {
+		msg += ", " + strings.Join(problems, ", ")
+	}
+	msg += "\n" + strings.TrimSuffix(details, "\n")
+
+	return *state, msg, nil
+}
@@ -0,0 +1,100 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+func TestSLO(t *testing.T) {
+	now := float64(time.Now().Unix())
+	// Error ratios per window, the objective of 99% has an error budget of 1%
+	ratios := map[string]string{"5m": "0.2", "1h": "0.15", "30m": "0.05", "6h": "0.02", "3d": "0.012", "30d": "0.008"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %s", err)
+		}
+		query := r.Form.Get("query")
+		for window, ratio := range ratios {
+			if strings.HasSuffix(query, fmt.Sprintf(`sum(rate(http_requests_total{job="api"}[%s]))`, window)) {
+				fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[%f,"%s"]}]}}`, now, ratio)
+				return
+			}
+		}
+		t.Errorf("unexpected query %q", query)
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := SLO(context.Background(), address, "", `http_requests_total{job="api", code=~"5.."}`, `http_requests_total{job="api"}`,
+		99, 30*24*time.Hour, DefaultBurnRateWindows(nil), "25:", "10:", &collection)
+	if err != nil {
+		t.Fatalf("SLO returned error: %s", err)
+	}
+	if state.Code != check_x.Critical.Code {
+		t.Errorf("state = %s, want CRITICAL", state.Name)
+	}
+	expected := []string{
+		"SLO 99% over 30d: availability 99.200%, error budget remaining 20.00%, burning 15.0x over 1h, burning 1.2x over 3d, error budget remaining is 20.00%",
+		"[CRITICAL] 1h/5m burn rate 15.00/20.00, alerting above 14.4",
+		"[OK] 6h/30m burn rate 2.00/5.00, alerting above 6",
+		"[WARNING] 3d/6h burn rate 1.20/2.00, alerting above 1",
+	}
+	for _, line := range expected {
+		if !strings.Contains(msg, line) {
+			t.Errorf("message %q does not contain %q", msg, line)
+		}
+	}
+	perfdata := collection.PrintAllPerformanceData()
+	for _, expected := range []string{"'burn_rate_1h'=15", "'burn_rate_3d'=1.2", "%;25:;10:;;100"} {
+		if !strings.Contains(perfdata, expected) {
+			t.Errorf("perfdata %q does not contain %q", perfdata, expected)
+		}
+	}
+}
+
+func TestSLOWithoutTotalSeries(t *testing.T) {
+	now := float64(time.Now().Unix())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %s", err)
+		}
+		// The total selector has a typo, only the requests without any errors return a ratio of NaN out of 0 / 0
+		if strings.Contains(r.Form.Get("query"), "http_request_total") {
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[%f,"NaN"]}]}}`, now)
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := SLO(context.Background(), address, "", `http_requests_total{code=~"5.."}`, `http_request_total`, 99, 30*24*time.Hour, DefaultBurnRateWindows(nil), "25:", "10:", &collection)
+	if err == nil || state.Code != check_x.Unknown.Code || !strings.Contains(msg, "the total selector 'http_request_total' returned no series") {
+		t.Errorf("wrong selector: state = %s, message = %q, err = %v", state.Name, msg, err)
+	}
+
+	collection = check_x.NewPerformanceDataCollection()
+	state, msg, err = SLO(context.Background(), address, "", `http_requests_total{code=~"5.."}`, `http_requests_total`, 99, 30*24*time.Hour, DefaultBurnRateWindows(nil), "25:", "10:", &collection)
+	if err != nil || state.Code != check_x.OK.Code || !strings.HasPrefix(msg, "SLO 99% over 30d: availability 100.000%, error budget remaining 100.00%") {
+		t.Errorf("no requests: state = %s, message = %q, err = %v", state.Name, msg, err)
+	}
+}
+
+func TestSLOSelectorValidation(t *testing.T) {
+	address, _ := url.Parse("http://localhost:9090")
+	collection := check_x.NewPerformanceDataCollection()
+	state, _, err := SLO(context.Background(), address, "", "rate(errors_total[5m])", "requests_total", 0.999, time.Hour, DefaultBurnRateWindows(nil), "", "", &collection)
+	if err == nil || state.Code != check_x.Unknown.Code {
+		t.Errorf("expected UNKNOWN for a selector with a function, got %s, %v", state.Name, err)
+	}
+}
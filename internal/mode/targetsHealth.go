@@ -6,11 +6,15 @@ import (
 	"fmt"
 	"net/url"
 	"path"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/consol-monitoring/check_prometheus/internal/helper"
 
 	"github.com/consol-monitoring/check_x"
+	"github.com/prometheus/common/model"
 )
 
 const (
@@ -18,31 +22,63 @@ const (
 	DefaultLabel = "instance"
 )
 
+type activeTarget struct {
+	DiscoveredLabels struct {
+		Address     string `json:"__address__"`
+		MetricsPath string `json:"__metrics_path__"`
+		Scheme      string `json:"__scheme__"`
+		Job         string `json:"job"`
+	} `json:"discoveredLabels"`
+	Labels             map[string]string `json:"labels"`
+	ScrapePool         string            `json:"scrapePool"`
+	ScrapeURL          string            `json:"scrapeUrl"`
+	LastError          string            `json:"lastError"`
+	LastScrape         time.Time         `json:"lastScrape"`
+	LastScrapeDuration float64           `json:"lastScrapeDuration"`
+	Health             string            `json:"health"`
+	ScrapeInterval     string            `json:"scrapeInterval"`
+	ScrapeTimeout      string            `json:"scrapeTimeout"`
+}
+
+type droppedTarget struct {
+	DiscoveredLabels map[string]string `json:"discoveredLabels"`
+	ScrapePool       string            `json:"scrapePool"`
+}
+
 type targets struct {
 	Status string `json:"status"`
 	Data   struct {
-		ActiveTargets []struct {
-			DiscoveredLabels struct {
-				Address     string `json:"__address__"`
-				MetricsPath string `json:"__metrics_path__"`
-				Scheme      string `json:"__scheme__"`
-				Job         string `json:"job"`
-			} `json:"discoveredLabels"`
-			Labels     map[string]string `json:"labels"`
-			ScrapeURL  string            `json:"scrapeUrl"`
-			LastError  string            `json:"lastError"`
-			LastScrape time.Time         `json:"lastScrape"`
-			Health     string            `json:"health"`
-		} `json:"activeTargets"`
+		ActiveTargets       []activeTarget  `json:"activeTargets"`
+		DroppedTargets      []droppedTarget `json:"droppedTargets"`
+		DroppedTargetCounts map[string]int  `json:"droppedTargetCounts"`
 	} `json:"data"`
 }
 
-func getTargets(ctx context.Context, address *url.URL) (*targets, error) {
+type jobHealth struct {
+	name      string
+	healthy   int
+	unhealthy int
+	stale     int
+}
+
+func (j *jobHealth) targets() int {
+	return j.healthy + j.unhealthy
+}
+
+func (j *jobHealth) healthRate() float64 {
+	if j.targets() == 0 {
+		return 0
+	}
+	return float64(j.healthy) / float64(j.targets())
+}
+
+func getTargets(ctx context.Context, address *url.URL, params url.Values) (*targets, error) {
 	url, err := url.Parse(address.String())
 	if err != nil {
 		return nil, err
 	}
 	url.Path = path.Join(url.Path, "/api/v1/targets")
+	url.RawQuery = params.Encode()
 	jsonBytes, err := helper.DoAPIRequest(ctx, url)
 	if err != nil {
 		return nil, err
@@ -55,8 +91,49 @@ func getTargets(ctx context.Context, address *url.URL) (*targets, error) {
 	return &dat, nil
 }
 
-// TargetsHealth tests the health of the targets
-func TargetsHealth(ctx context.Context, address *url.URL, label, warning, critical string, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+// parseMinTargets parses a list of 'N' and 'job=N' entries. 'N' applies to every job without own entry.
+func parseMinTargets(minTargets []string) (int, map[string]int, error) {
+	defaultMin := 0
+	perJob := map[string]int{}
+	for _, entry := range minTargets {
+		job, value, found := strings.Cut(entry, "=")
+		if !found {
+			value = job
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || count < 0 {
+			return 0, nil, fmt.Errorf("minimum target count '%s' is not in the form 'N' or 'job=N'", entry)
+		}
+		if found {
+			perJob[strings.TrimSpace(job)] = count
+		} else {
+			defaultMin = count
+		}
+	}
+
+	return defaultMin, perJob, nil
+}
+
+// isStale tests if the last scrape of the target is older than factor times its scrape interval
+func isStale(target *activeTarget, factor float64, now time.Time) bool {
+	if factor <= 0 || target.ScrapeInterval == "" {
+		return false
+	}
+	interval, err := model.ParseDuration(target.ScrapeInterval)
+	if err != nil || interval <= 0 {
+		return false
+	}
+	if target.LastScrape.IsZero() {
+		return true
+	}
+
+	return now.Sub(target.LastScrape) > time.Duration(factor*float64(interval))
+}
+
+// TargetsHealth tests the health of the targets. The targets can be filtered by jobs and label matchers,
+// the health rate is evaluated globally with warning/critical and per job with jobWarning/jobCritical.
+// Targets whose last scrape is older than scrapeAgeFactor times their scrape interval are treated as unhealthy.
+func TargetsHealth(ctx context.Context, address *url.URL, label, warning, critical, jobWarning, jobCritical string, jobs, matchers, minTargets []string, scrapeAgeFactor float64, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
 	if address == nil {
 		err := fmt.Errorf("address to query is null")
 		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
@@ -77,7 +154,27 @@ func TargetsHealth(ctx context.Context, address *url.URL, label, warning, critic
 		return check_x.Unknown, fmt.Sprintf("Error creating critThreshold from '%s' : %s", critical, err.Error()), err
 	}
 
-	targets, err := getTargets(ctx, address)
+	jobWarnThreshold, err := check_x.NewThreshold(jobWarning)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error creating job warningThreshold from '%s' : %s", jobWarning, err.Error()), err
+	}
+
+	jobCritThreshold, err := check_x.NewThreshold(jobCritical)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error creating job critThreshold from '%s' : %s", jobCritical, err.Error()), err
+	}
+
+	labelMatchers, err := helper.ParseLabelMatchers(matchers)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error parsing label matchers: %s", err.Error()), err
+	}
+
+	defaultMinTargets, jobMinTargets, err := parseMinTargets(minTargets)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error parsing minimum target counts: %s", err.Error()), err
+	}
+
+	targets, err := getTargets(ctx, address, url.Values{"state": []string{"active"}})
 	if err != nil {
 		return check_x.Unknown, fmt.Sprintf("Error getting targets out of address: %s : %s", address.String(), err.Error()), err
 	}
@@ -86,30 +183,108 @@ func TargetsHealth(ctx context.Context, address *url.URL, label, warning, critic
 		err := fmt.Errorf("the API target return status was %s", (*targets).Status)
 		return check_x.Unknown, err.Error(), err
 	}
-	msg := ""
-	healthy := 0
-	unhealthy := 0
-	for _, target := range (*targets).Data.ActiveTargets {
-		msg += fmt.Sprintf("Job: %s, Instance: %s, Health: %s, Last Error: %s\n", target.Labels["job"], target.Labels["instance"], target.Health, target.LastError)
+
+	// Jobs given explicitly are always reported, even if they have no target at all
+	jobFilter := map[string]bool{}
+	perJob := map[string]*jobHealth{}
+	for _, job := range jobs {
+		jobFilter[job] = true
+		perJob[job] = &jobHealth{name: job}
+	}
+
+	now := time.Now()
+	total := jobHealth{}
+	perfdataLabels := newPerfdataLabels(0)
+	details := ""
+	for i := range (*targets).Data.ActiveTargets {
+		target := &(*targets).Data.ActiveTargets[i]
+		job := target.Labels["job"]
+		if len(jobFilter) > 0 && !jobFilter[job] {
+			continue
+		}
+		if !helper.MatchesAll(labelMatchers, target.Labels) {
+			continue
+		}
+		if _, ok := perJob[job]; !ok {
+			perJob[job] = &jobHealth{name: job}
+		}
+
+		stale := isStale(target, scrapeAgeFactor, now)
 		health := 0.0
-		if target.Health != "up" {
+		switch {
+		case target.Health != "up":
 			health = 1
-			unhealthy += 1
-		} else {
-			healthy += 1
+			perJob[job].unhealthy++
+			total.unhealthy++
+			details += fmt.Sprintf("Job: %s, Instance: %s, Health: %s, Last Error: %s\n", job, target.Labels["instance"], target.Health, target.LastError)
+		case stale:
+			health = 1
+			perJob[job].unhealthy++
+			perJob[job].stale++
+			total.unhealthy++
+			total.stale++
+			details += fmt.Sprintf("Job: %s, Instance: %s, Health: stale, Last Scrape: %s ago, Scrape Interval: %s\n", job, target.Labels["instance"], now.Sub(target.LastScrape).Truncate(time.Second), target.ScrapeInterval)
+		default:
+			perJob[job].healthy++
+			total.healthy++
 		}
+
+		// The same instance may be scraped by several jobs, so the label is prefixed by the job and numbered if it is
+		// still not unique
+		perfLabel := target.Labels[DefaultLabel]
 		if val, ok := target.Labels[label]; ok {
-			collection.AddPerformanceDataFloat64(val, health)
-		} else {
-			collection.AddPerformanceDataFloat64(target.Labels[DefaultLabel], health)
+			perfLabel = val
+		}
+		if label != "job" {
+			perfLabel = job + "_" + perfLabel
 		}
+		perfLabel = perfdataLabels.label(perfLabel)
+		collection.AddPerformanceDataFloat64(perfLabel, health)
+		collection.AddPerformanceDataFloat64(perfLabel+"_scrape_duration", target.LastScrapeDuration)
+		collection.Unit(perfLabel+"_scrape_duration", "s")
+		collection.Min(perfLabel+"_scrape_duration", 0)
+		if interval, err := model.ParseDuration(target.ScrapeInterval); err == nil {
+			collection.AddPerformanceDataFloat64(perfLabel+"_scrape_interval", time.Duration(interval).Seconds())
+			collection.Unit(perfLabel+"_scrape_interval", "s")
+			collection.Min(perfLabel+"_scrape_interval", 0)
+		}
+	}
+
+	jobNames := make([]string, 0, len(perJob))
+	for job := range perJob {
+		jobNames = append(jobNames, job)
 	}
-	var healthRate float64
-	sumTargets := float64(len((*targets).Data.ActiveTargets))
-	if sumTargets == 0 {
-		healthRate = 0
-	} else {
-		healthRate = float64(healthy) / sumTargets
+	sort.Strings(jobNames)
+
+	healthRate := total.healthRate()
+	states := check_x.States{check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(healthRate)}
+	problems := []string{}
+	jobSummary := ""
+	for _, job := range jobNames {
+		jh := perJob[job]
+		jobState := check_x.Evaluator{Warning: jobWarnThreshold, Critical: jobCritThreshold}.Evaluate(jh.healthRate())
+
+		minTargets, ok := jobMinTargets[job]
+		if !ok {
+			minTargets = defaultMinTargets
+		}
+		if jh.targets() < minTargets {
+			jobState = check_x.Critical
+			problems = append(problems, fmt.Sprintf("job %s has %d of minimum %d targets", job, jh.targets(), minTargets))
+		} else if jobState.Code != check_x.OK.Code {
+			problems = append(problems, fmt.Sprintf("job %s health rate is %.2f", job, jh.healthRate()))
+		}
+		states = append(states, jobState)
+
+		jobSummary += fmt.Sprintf("[%s] Job: %s, Targets: %d, Healthy: %d, Unhealthy: %d, Stale: %d, Health Rate: %.2f\n", jobState.Name, job, jh.targets(), jh.healthy, jh.unhealthy, jh.stale, jh.healthRate())
+
+		collection.AddPerformanceDataFloat64(job+"_health_rate", jh.healthRate())
+		collection.Warn(job+"_health_rate", jobWarnThreshold)
+		collection.Crit(job+"_health_rate", jobCritThreshold)
+		collection.Min(job+"_health_rate", 0)
+		collection.Max(job+"_health_rate", 1)
+		collection.AddPerformanceDataFloat64(job+"_targets", float64(jh.targets()))
+		collection.Min(job+"_targets", 0)
 	}
 
 	collection.AddPerformanceDataFloat64("health_rate", healthRate)
@@ -117,10 +292,29 @@ func TargetsHealth(ctx context.Context, address *url.URL, label, warning, critic
 	collection.Crit("health_rate", critThreshold)
 	collection.Min("health_rate", 0)
 	collection.Max("health_rate", 1)
-	collection.AddPerformanceDataFloat64("targets", sumTargets)
+	collection.AddPerformanceDataFloat64("targets", float64(total.targets()))
 	collection.Min("targets", 0)
+	if scrapeAgeFactor > 0 {
+		collection.AddPerformanceDataFloat64("stale_targets", float64(total.stale))
+		collection.Min("stale_targets", 0)
+	}
+
+	state, err := states.GetWorst()
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when picking the worst state out of many states: %s", err.Error()), err
+	}
 
-	state := check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(healthRate)
+	msg := fmt.Sprintf("There are %d healthy and %d unhealthy targets", total.healthy, total.unhealthy)
+	if total.stale > 0 {
+		msg += fmt.Sprintf(" (%d stale)", total.stale)
+	}
+	if len(problems) > 0 {
+		msg += ", " + strings.Join(problems, ", ")
+	}
+	if len(jobNames) > 1 || total.unhealthy > 0 || len(problems) > 0 {
+		msg += "\n" + jobSummary + details
+		msg = strings.TrimSuffix(msg, "\n")
+	}
 
-	return state, fmt.Sprintf("There are %d healthy and %d unhealthy targets", healthy, unhealthy), nil
+	return *state, msg, nil
 }
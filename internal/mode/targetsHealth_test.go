@@ -0,0 +1,107 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+func TestTargetsHealth(t *testing.T) {
+	now := time.Now().UTC()
+	recent := now.Add(-10 * time.Second).Format(time.RFC3339)
+	old := now.Add(-10 * time.Minute).Format(time.RFC3339)
+	target := `{"labels":{"job":"%s","instance":"%s","env":"%s"},"health":"%s","lastScrape":"%s","lastScrapeDuration":0.25,"scrapeInterval":"30s"}`
+	activeTargets := []string{
+		fmt.Sprintf(target, "node", "db01", "prod", "up", recent),
+		fmt.Sprintf(target, "node", "db02", "prod", "up", old),
+		fmt.Sprintf(target, "node", "dev01", "dev", "down", recent),
+		fmt.Sprintf(target, "api", "web01", "prod", "up", recent),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status":"success","data":{"activeTargets":[%s]}}`, strings.Join(activeTargets, ","))
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	tests := []struct {
+		name        string
+		jobCritical string
+		jobs        []string
+		matchers    []string
+		minTargets  []string
+		ageFactor   float64
+		state       check_x.State
+		message     string
+	}{
+		{
+			name:     "dev targets filtered out",
+			matchers: []string{"env!=dev"},
+			state:    check_x.OK,
+			message:  "There are 3 healthy and 0 unhealthy targets",
+		},
+		{
+			name:        "stale target lowers job health rate",
+			jobCritical: "1:",
+			matchers:    []string{"env=prod"},
+			ageFactor:   3,
+			state:       check_x.Critical,
+			message:     "There are 2 healthy and 1 unhealthy targets (1 stale), job node health rate is 0.50",
+		},
+		{
+			name:       "missing job below minimum target count",
+			jobs:       []string{"api", "blackbox"},
+			minTargets: []string{"1"},
+			state:      check_x.Critical,
+			message:    "There are 1 healthy and 0 unhealthy targets, job blackbox has 0 of minimum 1 targets",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collection := check_x.NewPerformanceDataCollection()
+			state, msg, err := TargetsHealth(context.Background(), address, DefaultLabel, "", "", "", tt.jobCritical, tt.jobs, tt.matchers, tt.minTargets, tt.ageFactor, &collection)
+			if err != nil {
+				t.Fatalf("TargetsHealth returned error: %s", err)
+			}
+			if state.Code != tt.state.Code {
+				t.Errorf("state = %s, want %s", state.Name, tt.state.Name)
+			}
+			if firstLine := strings.Split(msg, "\n")[0]; firstLine != tt.message {
+				t.Errorf("message = %q, want %q", firstLine, tt.message)
+			}
+		})
+	}
+}
+
+func TestTargetsHealthPerfdataLabels(t *testing.T) {
+	target := `{"labels":{"job":"%s","instance":"%s"},"health":"up","lastScrapeDuration":0.25,"scrapeInterval":"30s"}`
+	activeTargets := []string{
+		fmt.Sprintf(target, "node", "db01:9100"),
+		fmt.Sprintf(target, "blackbox", "db01:9100"),
+		fmt.Sprintf(target, "blackbox", "db01:9100"),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status":"success","data":{"activeTargets":[%s]}}`, strings.Join(activeTargets, ","))
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	if _, _, err := TargetsHealth(context.Background(), address, DefaultLabel, "", "", "", "", nil, nil, nil, 0, &collection); err != nil {
+		t.Fatalf("TargetsHealth returned error: %s", err)
+	}
+	perfdata := collection.PrintAllPerformanceData()
+	for _, expected := range []string{"'node_db01:9100'=0", "'node_db01:9100_scrape_duration'=0.25s", "'blackbox_db01:9100'=0", "'blackbox_db01:9100_2_scrape_interval'=30s"} {
+		if !strings.Contains(perfdata, expected) {
+			t.Errorf("perfdata %q does not contain %q", perfdata, expected)
+		}
+	}
+}
@@ -0,0 +1,410 @@
+package mode
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/consol-monitoring/check_prometheus/internal/helper"
+	"github.com/consol-monitoring/check_x"
+	"github.com/prometheus/common/model"
+)
+
+// OutputTemplates are the go text/templates which render the output of the checked series
+type OutputTemplates struct {
+	// Alias is rendered for every series of a vector result and replaces the query in the output
+	Alias string
+	// Summary replaces the first line, OK, Warning, Critical and Unknown replace it if the check ends in their state
+	Summary  string
+	OK       string
+	Warning  string
+	Critical string
+	Unknown  string
+	// Series is rendered for every series as line of the long output
+	Series string
+	// Strict returns UNKNOWN if a template fails, otherwise the error is reported in the output and the raw template is used
+	Strict bool
+}
+
+// summaryTemplate returns the template of the first line for the state, empty if the default line is kept
+func (t OutputTemplates) summaryTemplate(state check_x.State) string {
+	stateTemplates := map[int]string{
+		check_x.OK.Code:       t.OK,
+		check_x.Warning.Code:  t.Warning,
+		check_x.Critical.Code: t.Critical,
+		check_x.Unknown.Code:  t.Unknown,
+	}
+	if stateTemplate := stateTemplates[state.Code]; stateTemplate != "" {
+		return stateTemplate
+	}
+
+	return t.Summary
+}
+
+// aliasSeries is everything the alias template can access of a single series
+type aliasSeries struct {
+	Labels   model.Metric
+	Value    float64
+	State    check_x.State
+	Warning  string
+	Critical string
+	// Alias is the rendered alias of the series, used by the summary templates
+	Alias string
+}
+
+// seriesSummary is a single series within the data of the summary templates
+type seriesSummary struct {
+	Labels   map[string]string
+	Value    float64
+	State    string
+	Alias    string
+	severity int
+}
+
+// summaryData is the data of the summary templates: the number of series per state, the series which are not OK
+// ordered by their severity and the worst series
+type summaryData struct {
+	Query    string
+	State    string
+	Total    int
+	OK       int
+	Warning  int
+	Critical int
+	Unknown  int
+	Worst    *seriesSummary
+	Problems []seriesSummary
+	Series   []seriesSummary
+}
+
+// stateSeverity orders the states from OK to CRITICAL, UNKNOWN is less severe than WARNING and CRITICAL
+func stateSeverity(state check_x.State) int {
+	switch state.Code {
+	case check_x.Critical.Code:
+		return 3
+	case check_x.Warning.Code:
+		return 2
+	case check_x.Unknown.Code:
+		return 1
+	}
+
+	return 0
+}
+
+// toFloat converts the template arguments into numbers, label values and xvalue are strings
+func toFloat(value any) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case model.SampleValue:
+		return float64(v), nil
+	case model.LabelValue:
+		return strconv.ParseFloat(string(v), 64)
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+
+	return 0, fmt.Errorf("can not convert %v of type %T into a number", value, value)
+}
+
+// compareFloats returns a template function comparing two arguments as numbers
+func compareFloats(compare func(a, b float64) bool) func(a, b any) (bool, error) {
+	return func(a, b any) (bool, error) {
+		x, err := toFloat(a)
+		if err != nil {
+			return false, err
+		}
+		y, err := toFloat(b)
+		if err != nil {
+			return false, err
+		}
+		return compare(x, y), nil
+	}
+}
+
+// humanizeUnits formats the value with the largest prefix it reaches, like the prometheus template functions
+func humanizeUnits(value any, base float64, prefixes []string) (string, error) {
+	v, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+	if v == 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Sprintf("%.4g", v), nil
+	}
+
+	prefix := ""
+	for _, p := range prefixes {
+		if math.Abs(v) < base {
+			break
+		}
+		prefix = p
+		v /= base
+	}
+
+	return fmt.Sprintf("%.4g%s", v, prefix), nil
+}
+
+func humanize(value any) (string, error) {
+	v, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+	if v != 0 && math.Abs(v) < 1 {
+		prefix := ""
+		for _, p := range []string{"m", "u", "n", "p", "f", "a", "z", "y"} {
+			if math.Abs(v) >= 1 {
+				break
+			}
+			prefix = p
+			v *= 1000
+		}
+		return fmt.Sprintf("%.4g%s", v, prefix), nil
+	}
+
+	return humanizeUnits(v, 1000, []string{"k", "M", "G", "T", "P", "E", "Z", "Y"})
+}
+
+func humanize1024(value any) (string, error) {
+	return humanizeUnits(value, 1024, []string{"Ki", "Mi", "Gi", "Ti", "Pi", "Ei", "Zi", "Yi"})
+}
+
+func humanizeBytes(value any) (string, error) {
+	humanized, err := humanize1024(value)
+	if err != nil {
+		return "", err
+	}
+
+	return humanized + "B", nil
+}
+
+// humanizeDuration formats seconds like 1d 2h 3m 4s, durations below a second in ms, us or ns
+func humanizeDuration(value any) (string, error) {
+	v, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Sprintf("%.4g", v), nil
+	}
+	if math.Abs(v) < 1 {
+		return time.Duration(v * float64(time.Second)).String(), nil
+	}
+
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	seconds := int64(v) % 60
+	minutes := int64(v) / 60 % 60
+	hours := int64(v) / 60 / 60 % 24
+	days := int64(v) / 60 / 60 / 24
+
+	parts := []string{}
+	if days > 0 {
+		parts = append(parts, fmt.Sprintf("%dd", days))
+	}
+	if hours > 0 {
+		parts = append(parts, fmt.Sprintf("%dh", hours))
+	}
+	if minutes > 0 {
+		parts = append(parts, fmt.Sprintf("%dm", minutes))
+	}
+	if seconds > 0 || len(parts) == 0 {
+		parts = append(parts, fmt.Sprintf("%ds", seconds))
+	}
+
+	return sign + strings.Join(parts, " "), nil
+}
+
+func humanizePercentage(value any) (string, error) {
+	v, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%.4g%%", v*100), nil
+}
+
+func round(value any, decimals int) (float64, error) {
+	v, err := toFloat(value)
+	if err != nil {
+		return 0, err
+	}
+	factor := math.Pow(10, float64(decimals))
+
+	return math.Round(v*factor) / factor, nil
+}
+
+func reReplaceAll(pattern, replacement string, text any) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	return re.ReplaceAllString(fmt.Sprint(text), replacement), nil
+}
+
+// templateFuncs returns the functions of the output templates, value, state, warning and critical return the
+// properties of the rendered series
+func templateFuncs(series aliasSeries) template.FuncMap {
+	return template.FuncMap{
+		"value":              func() float64 { return series.Value },
+		"state":              func() string { return series.State.Name },
+		"warning":            func() string { return series.Warning },
+		"critical":           func() string { return series.Critical },
+		"toFloat":            toFloat,
+		"round":              round,
+		"humanize":           humanize,
+		"humanize1024":       humanize1024,
+		"humanizeBytes":      humanizeBytes,
+		"humanizeDuration":   humanizeDuration,
+		"humanizePercentage": humanizePercentage,
+		"gtf":                compareFloats(func(a, b float64) bool { return a > b }),
+		"gef":                compareFloats(func(a, b float64) bool { return a >= b }),
+		"ltf":                compareFloats(func(a, b float64) bool { return a < b }),
+		"lef":                compareFloats(func(a, b float64) bool { return a <= b }),
+		"eqf":                compareFloats(func(a, b float64) bool { return a == b }),
+		"reReplaceAll":       reReplaceAll,
+		"toUpper":            func(text any) string { return strings.ToUpper(fmt.Sprint(text)) },
+		"toLower":            func(text any) string { return strings.ToLower(fmt.Sprint(text)) },
+	}
+}
+
+// expandAlias renders the alias for the series, the labels are accessible by their name and xvalue is the value as string.
+// If the template fails the raw alias is returned with the error.
+func expandAlias(alias string, series aliasSeries) (string, error) {
+	if alias == "" {
+		return "", nil
+	}
+
+	tmpl, err := template.New("Output").Funcs(templateFuncs(series)).Parse(alias)
+	if err != nil {
+		return alias, err
+	}
+
+	labelMap := make(map[string]string)
+	for label, value := range series.Labels {
+		var l = fmt.Sprintf("%v", label)
+		var v = fmt.Sprintf("%v", value)
+		labelMap[l] = v
+	}
+	labelMap["xvalue"] = fmt.Sprintf("%v", series.Value)
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, labelMap); err != nil {
+		return alias, err
+	}
+
+	return rendered.String(), nil
+}
+
+// newSummaryData counts the series per state and orders the problems by their severity
+func newSummaryData(query string, state check_x.State, series []aliasSeries) summaryData {
+	data := summaryData{Query: query, State: state.Name, Total: len(series)}
+	for _, s := range series {
+		labels := make(map[string]string, len(s.Labels))
+		for name, value := range s.Labels {
+			labels[string(name)] = string(value)
+		}
+		summary := seriesSummary{Labels: labels, Value: s.Value, State: s.State.Name, Alias: s.Alias, severity: stateSeverity(s.State)}
+		data.Series = append(data.Series, summary)
+
+		switch s.State.Code {
+		case check_x.OK.Code:
+			data.OK++
+		case check_x.Warning.Code:
+			data.Warning++
+		case check_x.Critical.Code:
+			data.Critical++
+		default:
+			data.Unknown++
+		}
+		if s.State.Code != check_x.OK.Code {
+			data.Problems = append(data.Problems, summary)
+		}
+	}
+
+	sort.SliceStable(data.Problems, func(i, j int) bool {
+		return data.Problems[i].severity > data.Problems[j].severity
+	})
+	if len(data.Problems) > 0 {
+		data.Worst = &data.Problems[0]
+	} else if len(data.Series) > 0 {
+		data.Worst = &data.Series[0]
+	}
+
+	return data
+}
+
+// renderSummary replaces the first line of the message by the summary templates and adds a long output line per
+// series if the series template is set. If a template fails the message is kept.
+func renderSummary(templates OutputTemplates, state check_x.State, msg, query string, series []aliasSeries) (string, error) {
+	var renderErr error
+	if summaryTemplate := templates.summaryTemplate(state); summaryTemplate != "" {
+		tmpl, err := template.New("Summary").Funcs(templateFuncs(aliasSeries{State: state})).Parse(summaryTemplate)
+		if err == nil {
+			var rendered bytes.Buffer
+			err = tmpl.Execute(&rendered, newSummaryData(query, state, series))
+			if err == nil {
+				msg = rendered.String()
+			}
+		}
+		renderErr = err
+	}
+
+	if templates.Series != "" {
+		for _, s := range series {
+			line, err := expandAlias(templates.Series, s)
+			if err != nil && renderErr == nil {
+				renderErr = err
+			}
+			msg += "\n" + line
+		}
+	}
+
+	return msg, renderErr
+}
+
+// evalSeriesStates picks the worst state out of the states of the series and renders the output with the templates.
+// The summary is appended to the default first line, the longOutput is added after the lines of the series.
+func evalSeriesStates(states check_x.States, output, query, summary, longOutput string, templates OutputTemplates, series []aliasSeries, templateErr error) (check_x.State, string, error) {
+	state, msg, err := evalStates(states, output, query)
+	if err != nil {
+		return state, msg, err
+	}
+	msg += summary
+
+	msg, err = renderSummary(templates, state, msg, query, series)
+	if templateErr == nil {
+		templateErr = err
+	}
+	msg += longOutput
+	if templateErr != nil {
+		return templateError(state, msg, templateErr, templates.Strict)
+	}
+
+	return state, msg, nil
+}
+
+// templateError returns UNKNOWN in strict mode, otherwise the output keeps the raw template and the error is only
+// traced with --debug-level
+func templateError(state check_x.State, msg string, err error, strict bool) (check_x.State, string, error) {
+	if strict {
+		return check_x.Unknown, fmt.Sprintf("Error rendering template: %s", err.Error()), err
+	}
+	helper.Debugf(helper.DebugRequests, "template error: %s", err.Error())
+
+	return state, msg, nil
+}
@@ -0,0 +1,143 @@
+package mode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consol-monitoring/check_prometheus/internal/helper"
+	"github.com/consol-monitoring/check_x"
+	"github.com/prometheus/common/model"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	series := aliasSeries{
+		Labels:   model.Metric{"instance": "db01:9100", "mountpoint": "/var", "size": "2048"},
+		Value:    0.8734,
+		State:    check_x.Warning,
+		Warning:  "0.8",
+		Critical: "0.9",
+	}
+	tests := []struct {
+		alias    string
+		expected string
+	}{
+		{`{{humanize 1234567}}`, "1.235M"},
+		{`{{humanize 0.0042}}`, "4.2m"},
+		{`{{humanizeBytes .size}}`, "2KiB"},
+		{`{{humanizeDuration 93784}}`, "1d 2h 3m 4s"},
+		{`{{humanizeDuration 0.25}}`, "250ms"},
+		{`{{humanizePercentage value}}`, "87.34%"},
+		{`{{printf "%.1f" value}}`, "0.9"},
+		{`{{round value 2}}`, "0.87"},
+		{`{{if gtf .xvalue 0.5}}high{{else}}low{{end}}`, "high"},
+		{`{{if ltf .size 1000}}small{{else}}big{{end}}`, "big"},
+		{`{{reReplaceAll ":[0-9]+$" "" .instance}}`, "db01"},
+		{`{{toUpper .mountpoint}} {{toLower "ABC"}}`, "/VAR abc"},
+		{`[{{state}}] {{.mountpoint}} above {{warning}}, critical at {{critical}}`, "[WARNING] /var above 0.8, critical at 0.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alias, func(t *testing.T) {
+			result, err := expandAlias(tt.alias, series)
+			if err != nil {
+				t.Fatalf("expandAlias returned error: %s", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expandAlias(%q) = %q, want %q", tt.alias, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestQueryTemplateError(t *testing.T) {
+	now := float64(time.Now().Unix())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"job":"api"},"value":[%f,"1"]}]}}`, now)
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	oldDebugLevel, oldDebugWriter := helper.DebugLevel, helper.DebugWriter
+	t.Cleanup(func() { helper.DebugLevel, helper.DebugWriter = oldDebugLevel, oldDebugWriter })
+	trace := &bytes.Buffer{}
+	helper.DebugWriter = trace
+
+	for _, strict := range []bool{false, true} {
+		collection := check_x.NewPerformanceDataCollection()
+		templates := OutputTemplates{Alias: "{{gtf .job 1}}", Strict: strict}
+		state, msg, err := Query(context.Background(), address, "up", QueryOptions{Templates: templates}, &collection)
+		if strict {
+			if err == nil || state.Code != check_x.Unknown.Code || !strings.HasPrefix(msg, "Error rendering template:") {
+				t.Errorf("strict: state = %s, message = %q, error = %v", state.Name, msg, err)
+			}
+			continue
+		}
+		if err != nil || state.Code != check_x.OK.Code {
+			t.Errorf("state = %s, error = %v", state.Name, err)
+		}
+		if strings.Contains(msg, "error") || !strings.Contains(msg, "{{gtf .job 1}}") {
+			t.Errorf("message %q does not fall back to the raw alias", msg)
+		}
+		if trace.Len() > 0 {
+			t.Errorf("template error traced without --debug-level: %s", trace.String())
+		}
+	}
+
+	helper.DebugLevel = helper.DebugRequests
+	collection := check_x.NewPerformanceDataCollection()
+	if _, msg, _ := Query(context.Background(), address, "up", QueryOptions{Templates: OutputTemplates{Alias: "{{gtf .job 1}}"}}, &collection); strings.Contains(msg, "error") {
+		t.Errorf("message %q reports the template error", msg)
+	}
+	if !strings.Contains(trace.String(), "template error: ") {
+		t.Errorf("trace %q does not contain the template error", trace.String())
+	}
+}
+
+func TestQuerySummaryTemplates(t *testing.T) {
+	now := float64(time.Now().Unix())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"instance":"db01","mountpoint":"/"},"value":[%f,"0.5"]},
+			{"metric":{"instance":"db01","mountpoint":"/var"},"value":[%f,"0.97"]},
+			{"metric":{"instance":"web01","mountpoint":"/"},"value":[%f,"0.85"]}]}}`, now, now, now)
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	templates := OutputTemplates{
+		Summary:  `{{.Critical}} of {{.Total}} disks critical: {{range .Problems}}{{.Labels.mountpoint}} on {{.Labels.instance}} ({{humanizePercentage .Value}}) {{end}}`,
+		Warning:  `{{.Warning}} disks warning, worst {{.Worst.Labels.instance}}`,
+		Critical: `{{.Critical}} of {{.Total}} disks critical, worst {{.Worst.Labels.mountpoint}} on {{.Worst.Labels.instance}} ({{humanizePercentage .Worst.Value}})`,
+		Series:   `[{{state}}] {{.mountpoint}} on {{.instance}}`,
+	}
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := Query(context.Background(), address, "disk_used_ratio", QueryOptions{Warning: "0.8", Critical: "0.95", Templates: templates}, &collection)
+	if err != nil {
+		t.Fatalf("Query returned error: %s", err)
+	}
+	if state.Code != check_x.Critical.Code {
+		t.Errorf("state = %s, want CRITICAL", state.Name)
+	}
+	expected := "1 of 3 disks critical, worst /var on db01 (97%)\n[OK] / on db01\n[CRITICAL] /var on db01\n[WARNING] / on web01"
+	if msg != expected {
+		t.Errorf("message = %q, want %q", msg, expected)
+	}
+
+	// Without a template for the state the summary is used
+	templates.Critical = ""
+	collection = check_x.NewPerformanceDataCollection()
+	_, msg, err = Query(context.Background(), address, "disk_used_ratio", QueryOptions{Warning: "0.8", Critical: "0.95", Templates: templates}, &collection)
+	if err != nil {
+		t.Fatalf("Query returned error: %s", err)
+	}
+	if firstLine := strings.Split(msg, "\n")[0]; firstLine != "1 of 3 disks critical: /var on db01 (97%) / on web01 (85%) " {
+		t.Errorf("first line = %q", firstLine)
+	}
+}
@@ -0,0 +1,339 @@
+package mode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/consol-monitoring/check_prometheus/internal/helper"
+	"github.com/consol-monitoring/check_x"
+	"github.com/prometheus/common/model"
+)
+
+// ThanosParameters are the additional query parameters of the Thanos querier, unset parameters are not sent
+type ThanosParameters struct {
+	// Dedup and PartialResponse are 'true' or 'false'
+	Dedup           string
+	PartialResponse string
+	// MaxSourceResolution is a duration like '5m' or 'auto'
+	MaxSourceResolution string
+}
+
+// values validates the parameters and returns them as url parameters
+func (t ThanosParameters) values() (url.Values, error) {
+	values := url.Values{}
+	for _, parameter := range []struct {
+		name  string
+		value string
+	}{
+		{"dedup", t.Dedup},
+		{"partial_response", t.PartialResponse},
+	} {
+		if parameter.value == "" {
+			continue
+		}
+		if _, err := strconv.ParseBool(parameter.value); err != nil {
+			return nil, fmt.Errorf("thanos parameter %s '%s' is neither true nor false", parameter.name, parameter.value)
+		}
+		values.Set(parameter.name, parameter.value)
+	}
+
+	if t.MaxSourceResolution != "" {
+		if t.MaxSourceResolution != "auto" {
+			if _, err := model.ParseDuration(t.MaxSourceResolution); err != nil {
+				return nil, fmt.Errorf("max source resolution '%s' is neither a duration nor auto", t.MaxSourceResolution)
+			}
+		}
+		values.Set("max_source_resolution", t.MaxSourceResolution)
+	}
+
+	return values, nil
+}
+
+type thanosStore struct {
+	Name      string              `json:"name"`
+	LastCheck time.Time           `json:"lastCheck"`
+	LastError *string             `json:"lastError"`
+	LabelSets []map[string]string `json:"labelSets"`
+	// MinTime and MaxTime are in milliseconds, unbounded stores return the smallest and largest int64
+	MinTime int64 `json:"minTime"`
+	MaxTime int64 `json:"maxTime"`
+}
+
+type thanosStores struct {
+	Status string                   `json:"status"`
+	Error  string                   `json:"error"`
+	Data   map[string][]thanosStore `json:"data"`
+}
+
+// getThanosStores fetches the stores of a Thanos querier grouped by their type
+func getThanosStores(ctx context.Context, address *url.URL) (*thanosStores, error) {
+	storesURL, err := url.Parse(address.String())
+	if err != nil {
+		return nil, err
+	}
+	storesURL.Path = path.Join(storesURL.Path, "/api/v1/stores")
+	jsonBytes, err := helper.DoAPIRequest(ctx, storesURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var stores thanosStores
+	if err := json.Unmarshal(jsonBytes, &stores); err != nil {
+		return nil, err
+	}
+	if stores.Status != "success" {
+		return nil, fmt.Errorf("the API stores return status was %s: %s", stores.Status, stores.Error)
+	}
+
+	return &stores, nil
+}
+
+// formatLabelSets prints the label sets of a store, which identify the prometheus or bucket behind it
+func formatLabelSets(labelSets []map[string]string) string {
+	sets := make([]string, 0, len(labelSets))
+	for _, labels := range labelSets {
+		sets = append(sets, formatLabels(labels))
+	}
+
+	return strings.Join(sets, " ")
+}
+
+// ThanosStores checks the stores a Thanos querier fans out to: stores with an error result in unhealthyState, sidecars
+// whose newest sample is older than maxLag are WARNING, as is a time range covered by the healthy stores shorter than
+// minCoverage. minStores are 'N' or 'type=N' entries of the healthy stores expected per store type.
+func ThanosStores(ctx context.Context, address *url.URL, minStores []string, maxLag, minCoverage time.Duration, unhealthyState check_x.State, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+	if address == nil {
+		err := fmt.Errorf("address to query is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if collection == nil {
+		err := fmt.Errorf("collection to store perf data is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	defaultMin, minPerType, err := parseMinTargets(minStores)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	stores, err := getThanosStores(ctx, address)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error getting stores out of address: %s : %s", address.String(), err.Error()), err
+	}
+
+	types := make([]string, 0, len(stores.Data))
+	for storeType := range stores.Data {
+		types = append(types, storeType)
+	}
+	for storeType := range minPerType {
+		if _, ok := stores.Data[storeType]; !ok {
+			types = append(types, storeType)
+		}
+	}
+	sort.Strings(types)
+
+	now := time.Now()
+	states := check_x.States{check_x.OK}
+	problems := []string{}
+	details := ""
+	total := 0
+	unhealthy := 0
+	oldest := int64(math.MaxInt64)
+	maxSidecarLag := time.Duration(-1)
+	for _, storeType := range types {
+		typeStores := stores.Data[storeType]
+		sort.Slice(typeStores, func(i, j int) bool { return typeStores[i].Name < typeStores[j].Name })
+
+		healthy := 0
+		for _, store := range typeStores {
+			storeState := check_x.OK
+			info := ""
+			if len(store.LabelSets) > 0 {
+				info += " " + formatLabelSets(store.LabelSets)
+			}
+			if store.LastError != nil && *store.LastError != "" {
+				storeState = unhealthyState
+				info += ", error: " + *store.LastError
+				if unhealthyState.Code != check_x.OK.Code {
+					problems = append(problems, fmt.Sprintf("%s %s is unhealthy", storeType, store.Name))
+				}
+			} else {
+				healthy++
+				if store.MinTime != math.MinInt64 && store.MinTime < oldest {
+					oldest = store.MinTime
+				}
+			}
+
+			if storeType == "sidecar" && store.MaxTime != math.MaxInt64 {
+				lag := now.Sub(time.UnixMilli(store.MaxTime))
+				maxSidecarLag = max(maxSidecarLag, lag)
+				info += fmt.Sprintf(", lag: %s", lag.Round(time.Second))
+				if maxLag > 0 && lag > maxLag {
+					if worst, err := (check_x.States{storeState, check_x.Warning}).GetWorst(); err == nil {
+						storeState = *worst
+					}
+					problems = append(problems, fmt.Sprintf("sidecar %s lags %s behind", store.Name, lag.Round(time.Second)))
+				}
+			}
+
+			states = append(states, storeState)
+			details += fmt.Sprintf("[%s] %s: %s%s\n", storeState.Name, storeType, store.Name, info)
+		}
+		total += len(typeStores)
+		unhealthy += len(typeStores) - healthy
+
+		expected, ok := minPerType[storeType]
+		if !ok {
+			expected = defaultMin
+		}
+		if healthy < expected {
+			states = append(states, check_x.Critical)
+			problems = append(problems, fmt.Sprintf("%s has %d healthy stores, expected at least %d", storeType, healthy, expected))
+		}
+
+		collection.AddPerformanceDataFloat64(storeType+"_healthy", float64(healthy))
+		collection.Min(storeType+"_healthy", 0)
+		collection.AddPerformanceDataFloat64(storeType+"_unhealthy", float64(len(typeStores)-healthy))
+		collection.Min(storeType+"_unhealthy", 0)
+	}
+
+	coverage := time.Duration(0)
+	if oldest != math.MaxInt64 {
+		coverage = now.Sub(time.UnixMilli(oldest))
+	}
+	collection.AddPerformanceDataFloat64("coverage", coverage.Round(time.Second).Seconds())
+	collection.Unit("coverage", "s")
+	collection.Min("coverage", 0)
+	if minCoverage > 0 && coverage < minCoverage {
+		states = append(states, check_x.Warning)
+		problems = append(problems, fmt.Sprintf("healthy stores cover %s, expected at least %s", coverage.Round(time.Second), minCoverage))
+	}
+	if maxSidecarLag >= 0 {
+		collection.AddPerformanceDataFloat64("max_lag", maxSidecarLag.Round(time.Second).Seconds())
+		collection.Unit("max_lag", "s")
+		collection.Min("max_lag", 0)
+	}
+
+	state, err := states.GetWorst()
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when picking the worst state out of many states: %s", err.Error()), err
+	}
+
+	msg := fmt.Sprintf("%d stores of %d types, %d unhealthy, covering %s", total, len(types), unhealthy, coverage.Round(time.Second))
+	if len(problems) > 0 {
+		msg += ", " + strings.Join(problems, ", ")
+	}
+	if details != "" {
+		msg += "\n" + strings.TrimSuffix(details, "\n")
+	}
+
+	return *state, msg, nil
+}
+
+// thanosCompactTodo are the metrics of the work the compactor has planned, added as perfdata if exposed
+var thanosCompactTodo = []string{
+	"thanos_compact_todo_compactions",
+	"thanos_compact_todo_compaction_blocks",
+	"thanos_compact_todo_downsample_blocks",
+	"thanos_compact_todo_deletion_blocks",
+}
+
+// ThanosCompactor scrapes the metrics endpoint of a Thanos compactor, a halted compactor is CRITICAL. The warning and
+// critical thresholds are applied on the number of planned compactions, a growing number shows a compactor falling behind.
+func ThanosCompactor(ctx context.Context, address *url.URL, metricsPath, warning, critical string, collection *check_x.PerformanceDataCollection) (check_x.State, string, error) {
+	if address == nil {
+		err := fmt.Errorf("address to query is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	if collection == nil {
+		err := fmt.Errorf("collection to store perf data is null")
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	warnThreshold, critThreshold, err := newThresholds(warning, critical)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	metricsURL, err := url.Parse(address.String())
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+	if metricsPath == "" {
+		metricsPath = DefaultMetricsPath
+	}
+	metricsURL.Path = path.Join(metricsURL.Path, metricsPath)
+
+	exposition, err := helper.ScrapeMetrics(ctx, metricsURL)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error scraping %s : %s", metricsURL.Redacted(), err.Error()), err
+	}
+
+	halted := exposition.Select("thanos_compact_halted", nil)
+	if len(halted) == 0 {
+		err := fmt.Errorf("no thanos_compact_halted metric found, is %s a Thanos compactor?", metricsURL.Redacted())
+		return check_x.Unknown, fmt.Sprintf("Error: %s", err.Error()), err
+	}
+
+	states := check_x.States{check_x.OK}
+	problems := []string{}
+	collection.AddPerformanceDataFloat64("halted", halted[0].Value)
+	collection.Min("halted", 0)
+	collection.Max("halted", 1)
+	if halted[0].Value != 0 {
+		states = append(states, check_x.Critical)
+	}
+
+	todo := []string{}
+	for _, name := range thanosCompactTodo {
+		samples := exposition.Select(name, nil)
+		if len(samples) == 0 {
+			continue
+		}
+		value := 0.0
+		for _, sample := range samples {
+			value += sample.Value
+		}
+		label := strings.TrimPrefix(name, "thanos_compact_")
+		collection.AddPerformanceDataFloat64(label, value)
+		collection.Min(label, 0)
+		if name == "thanos_compact_todo_compactions" {
+			collection.Warn(label, warnThreshold)
+			collection.Crit(label, critThreshold)
+			todoState := check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(value)
+			states = append(states, todoState)
+			if todoState.Code != check_x.OK.Code {
+				problems = append(problems, fmt.Sprintf("%g compactions are planned", value))
+			}
+		}
+		todo = append(todo, fmt.Sprintf("%s: %g", label, value))
+	}
+
+	state, err := states.GetWorst()
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when picking the worst state out of many states: %s", err.Error()), err
+	}
+
+	msg := "Thanos compactor is running"
+	if halted[0].Value != 0 {
+		msg = "Thanos compactor is halted"
+	}
+	if len(problems) > 0 {
+		msg += ", " + strings.Join(problems, ", ")
+	}
+	if len(todo) > 0 {
+		msg += "\n" + strings.Join(todo, "\n")
+	}
+
+	return *state, msg, nil
+}
@@ -0,0 +1,120 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+func TestThanosStores(t *testing.T) {
+	now := time.Now()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/stores" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{
+			"sidecar":[
+				{"name":"10.0.0.2:10901","lastCheck":"2024-01-01T00:00:00Z","lastError":null,"labelSets":[{"replica":"b"}],"minTime":%d,"maxTime":%d},
+				{"name":"10.0.0.1:10901","lastCheck":"2024-01-01T00:00:00Z","lastError":null,"labelSets":[{"replica":"a"}],"minTime":%d,"maxTime":%d}],
+			"store":[
+				{"name":"10.0.0.3:10901","lastCheck":"2024-01-01T00:00:00Z","lastError":"connection refused","labelSets":[],"minTime":%d,"maxTime":9223372036854775807}]}}`,
+			now.Add(-2*time.Hour).UnixMilli(), now.Add(-10*time.Minute).UnixMilli(),
+			now.Add(-2*time.Hour).UnixMilli(), now.Add(-30*time.Second).UnixMilli(),
+			now.Add(-720*time.Hour).UnixMilli())
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := ThanosStores(context.Background(), address, []string{"1", "store=1"}, 5*time.Minute, 24*time.Hour, check_x.Critical, &collection)
+	if err != nil {
+		t.Fatalf("ThanosStores returned error: %s", err)
+	}
+	if state.Code != check_x.Critical.Code {
+		t.Errorf("state = %s, want CRITICAL", state.Name)
+	}
+	lines := strings.Split(msg, "\n")
+	expected := "3 stores of 2 types, 1 unhealthy, covering 2h0m0s, sidecar 10.0.0.2:10901 lags 10m0s behind, store 10.0.0.3:10901 is unhealthy, " +
+		"store has 0 healthy stores, expected at least 1, healthy stores cover 2h0m0s, expected at least 24h0m0s"
+	if lines[0] != expected {
+		t.Errorf("first line = %q, want %q", lines[0], expected)
+	}
+	if len(lines) != 4 || !strings.HasPrefix(lines[1], `[OK] sidecar: 10.0.0.1:10901 {replica="a"}, lag: 30s`) ||
+		lines[3] != "[CRITICAL] store: 10.0.0.3:10901, error: connection refused" {
+		t.Errorf("long output does not list the stores: %q", msg)
+	}
+	perfdata := collection.PrintAllPerformanceData()
+	for _, want := range []string{"'sidecar_healthy'=2;;;0;", "'store_unhealthy'=1;;;0;", "'coverage'=7200s;;;0;", "'max_lag'=600s;;;0;"} {
+		if !strings.Contains(perfdata, want) {
+			t.Errorf("perfdata = %s, want %s", perfdata, want)
+		}
+	}
+}
+
+func TestThanosCompactor(t *testing.T) {
+	halted := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "thanos_compact_halted %d\n", halted)
+		fmt.Fprintf(w, "thanos_compact_todo_compactions{group=\"a\"} 30\n")
+		fmt.Fprintf(w, "thanos_compact_todo_compactions{group=\"b\"} 20\n")
+		fmt.Fprintf(w, "thanos_compact_todo_deletion_blocks 3\n")
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	state, msg, err := ThanosCompactor(context.Background(), address, "", "40", "100", &collection)
+	if err != nil {
+		t.Fatalf("ThanosCompactor returned error: %s", err)
+	}
+	if state.Code != check_x.Warning.Code || msg != "Thanos compactor is running, 50 compactions are planned\ntodo_compactions: 50\ntodo_deletion_blocks: 3" {
+		t.Errorf("state = %s, message = %q", state.Name, msg)
+	}
+	if perfdata := collection.PrintAllPerformanceData(); !strings.Contains(perfdata, "'todo_compactions'=50;40;100;0;") {
+		t.Errorf("perfdata = %s, want todo_compactions with thresholds", perfdata)
+	}
+
+	halted = 1
+	collection = check_x.NewPerformanceDataCollection()
+	state, msg, err = ThanosCompactor(context.Background(), address, "", "", "", &collection)
+	if err != nil || state.Code != check_x.Critical.Code || !strings.HasPrefix(msg, "Thanos compactor is halted") {
+		t.Errorf("halted compactor: state = %s, message = %q, err = %v", state.Name, msg, err)
+	}
+}
+
+func TestThanosParameters(t *testing.T) {
+	values, err := ThanosParameters{Dedup: "false", MaxSourceResolution: "auto"}.values()
+	if err != nil {
+		t.Fatalf("values returned error: %s", err)
+	}
+	if values.Encode() != "dedup=false&max_source_resolution=auto" {
+		t.Errorf("values = %s", values.Encode())
+	}
+	for _, parameters := range []ThanosParameters{{PartialResponse: "maybe"}, {MaxSourceResolution: "fine"}} {
+		if _, err := parameters.values(); err == nil {
+			t.Errorf("values accepted %+v", parameters)
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("partial_response"); got != "true" {
+			t.Errorf("partial_response = %q, want true", got)
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"scalar","result":[%d,"1"]}}`, time.Now().Unix())
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	_, _, err = Query(context.Background(), address, "1", QueryOptions{Thanos: ThanosParameters{PartialResponse: "true"}}, &collection)
+	if err != nil {
+		t.Fatalf("Query returned error: %s", err)
+	}
+}
@@ -0,0 +1,180 @@
+package mode
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// unitFactor is the factor of a unit to the base unit of its dimension
+type unitFactor struct {
+	dimension string
+	factor    float64
+}
+
+// unitFactors are the units values can be converted between, ratio is the unit of the _ratio suffix
+var unitFactors = map[string]unitFactor{
+	"B":     {"bytes", 1},
+	"KB":    {"bytes", 1e3},
+	"MB":    {"bytes", 1e6},
+	"GB":    {"bytes", 1e9},
+	"TB":    {"bytes", 1e12},
+	"KiB":   {"bytes", 1 << 10},
+	"MiB":   {"bytes", 1 << 20},
+	"GiB":   {"bytes", 1 << 30},
+	"TiB":   {"bytes", 1 << 40},
+	"ns":    {"time", 1e-9},
+	"us":    {"time", 1e-6},
+	"ms":    {"time", 1e-3},
+	"s":     {"time", 1},
+	"m":     {"time", 60},
+	"h":     {"time", 3600},
+	"d":     {"time", 86400},
+	"ratio": {"ratio", 1},
+	"%":     {"ratio", 0.01},
+}
+
+// ValueTransform changes the values before they are checked against the thresholds and added as perfdata.
+// The steps are applied in the order invert, convert, scale, clamp and round.
+type ValueTransform struct {
+	// Invert replaces the value x by 1 - x, e.g. to turn a used ratio into a free one
+	Invert bool
+	// Convert is the unit to convert to, like GiB or %, optionally prefixed by the source unit like B:GiB.
+	// Without source unit it is derived from the metric name.
+	Convert string
+	// Scale multiplies and Divide divides the value, 0 disables them
+	Scale  float64
+	Divide float64
+	// ClampMin and ClampMax limit the value, empty disables them
+	ClampMin string
+	ClampMax string
+	// Round rounds the value to the decimals
+	Round    bool
+	Decimals int
+	// KeepOriginal adds the value before the transformation as additional perfdata with the suffix _original
+	KeepOriginal bool
+}
+
+// enabled returns true if the transformation changes the values
+func (t ValueTransform) enabled() bool {
+	return t.Invert || t.Convert != "" || t.Scale != 0 || t.Divide != 0 || t.ClampMin != "" || t.ClampMax != "" || t.Round
+}
+
+// validate checks the units and limits of the transformation
+func (t ValueTransform) validate() error {
+	if t.Convert != "" {
+		from, to := t.units()
+		if _, ok := unitFactors[to]; !ok {
+			return fmt.Errorf("unknown unit '%s', available units are %s", to, availableUnits())
+		}
+		if from != "" {
+			if _, ok := unitFactors[from]; !ok {
+				return fmt.Errorf("unknown unit '%s', available units are %s", from, availableUnits())
+			}
+			if unitFactors[from].dimension != unitFactors[to].dimension {
+				return fmt.Errorf("can not convert %s into %s", from, to)
+			}
+		}
+	}
+	for name, value := range map[string]string{"clamp min": t.ClampMin, "clamp max": t.ClampMax} {
+		if value == "" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("%s '%s' is no number", name, value)
+		}
+	}
+
+	return nil
+}
+
+// units splits the conversion into the source and the target unit
+func (t ValueTransform) units() (string, string) {
+	if from, to, found := strings.Cut(t.Convert, ":"); found {
+		return from, to
+	}
+
+	return "", t.Convert
+}
+
+// unit returns the unit of the transformed values, empty if it is not converted
+func (t ValueTransform) unit() string {
+	_, to := t.units()
+	if to == "ratio" {
+		return ""
+	}
+
+	return to
+}
+
+// perfdataUnit returns the unit of the transformed values of the metric, empty if scaling made it unknown
+func (t ValueTransform) perfdataUnit(metric string) string {
+	if t.Convert != "" {
+		return t.unit()
+	}
+	if t.Invert || t.Scale != 0 || t.Divide != 0 {
+		return ""
+	}
+
+	return metricUnit(metric)
+}
+
+// sourceUnit returns the unit the values of the metric are converted from
+func (t ValueTransform) sourceUnit(metric string) string {
+	if from, _ := t.units(); from != "" {
+		return from
+	}
+	if strings.HasSuffix(metric, "_ratio") {
+		return "ratio"
+	}
+
+	return metricUnit(metric)
+}
+
+// apply transforms the value of the metric
+func (t ValueTransform) apply(value float64, metric string) (float64, error) {
+	if t.Invert {
+		value = 1 - value
+	}
+	if t.Convert != "" {
+		_, to := t.units()
+		from := t.sourceUnit(metric)
+		if from == "" {
+			return value, fmt.Errorf("the unit of '%s' is unknown, set it like B:%s", metric, to)
+		}
+		if unitFactors[from].dimension != unitFactors[to].dimension {
+			return value, fmt.Errorf("can not convert %s of '%s' into %s", from, metric, to)
+		}
+		value = value * unitFactors[from].factor / unitFactors[to].factor
+	}
+	if t.Scale != 0 {
+		value *= t.Scale
+	}
+	if t.Divide != 0 {
+		value /= t.Divide
+	}
+	if clampMin, err := strconv.ParseFloat(t.ClampMin, 64); err == nil {
+		value = math.Max(value, clampMin)
+	}
+	if clampMax, err := strconv.ParseFloat(t.ClampMax, 64); err == nil {
+		value = math.Min(value, clampMax)
+	}
+	if t.Round {
+		factor := math.Pow(10, float64(t.Decimals))
+		value = math.Round(value*factor) / factor
+	}
+
+	return value, nil
+}
+
+func availableUnits() string {
+	units := make([]string, 0, len(unitFactors))
+	for unit := range unitFactors {
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+
+	return strings.Join(units, ", ")
+}
@@ -0,0 +1,80 @@
+package mode
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/consol-monitoring/check_x"
+)
+
+func TestValueTransform(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform ValueTransform
+		value     float64
+		metric    string
+		expected  float64
+		wantErr   bool
+	}{
+		{name: "none", value: 0.5, expected: 0.5},
+		{name: "invert", transform: ValueTransform{Invert: true}, value: 0.25, expected: 0.75},
+		{name: "derived unit", transform: ValueTransform{Convert: "GiB"}, value: 3 << 30, metric: "node_memory_MemFree_bytes", expected: 3},
+		{name: "given unit", transform: ValueTransform{Convert: "s:ms"}, value: 1.5, metric: "up", expected: 1500},
+		{name: "ratio into percent", transform: ValueTransform{Invert: true, Convert: "%"}, value: 0.25, metric: "disk_used_ratio", expected: 75},
+		{name: "unknown source unit", transform: ValueTransform{Convert: "GiB"}, value: 1, metric: "up", wantErr: true},
+		{name: "other dimension", transform: ValueTransform{Convert: "ms"}, value: 1, metric: "node_memory_MemFree_bytes", wantErr: true},
+		{name: "scale and divide", transform: ValueTransform{Scale: 8, Divide: 1000}, value: 250, expected: 2},
+		{name: "clamp", transform: ValueTransform{ClampMin: "0", ClampMax: "100"}, value: 104, expected: 100},
+		{name: "round", transform: ValueTransform{Round: true, Decimals: 1}, value: 1.25, expected: 1.3},
+		{name: "round to integer", transform: ValueTransform{Round: true}, value: 1.5, expected: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.transform.apply(tt.value, tt.metric)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.expected {
+				t.Errorf("apply() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	if err := (ValueTransform{Convert: "B:ms"}).validate(); err == nil {
+		t.Error("validate() accepted a conversion of bytes into ms")
+	}
+	if err := (ValueTransform{Convert: "parsec"}).validate(); err == nil {
+		t.Error("validate() accepted an unknown unit")
+	}
+}
+
+func TestQueryTransform(t *testing.T) {
+	now := float64(time.Now().Unix())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"__name__":"disk_used_ratio","mountpoint":"/"},"value":[%f,"0.9"]}]}}`, now)
+	}))
+	t.Cleanup(server.Close)
+	address, _ := url.Parse(server.URL)
+
+	collection := check_x.NewPerformanceDataCollection()
+	transform := ValueTransform{Invert: true, Convert: "%", Round: true, KeepOriginal: true}
+	perfdata := PerfdataOptions{Label: "{{.mountpoint}}", Unit: PerfdataAuto, Min: PerfdataAuto, Max: PerfdataAuto}
+	state, _, err := Query(context.Background(), address, "disk_used_ratio", QueryOptions{Warning: "20:", Critical: "5:", Perfdata: perfdata, Transform: transform}, &collection)
+	if err != nil {
+		t.Fatalf("Query returned error: %s", err)
+	}
+	if state.Code != check_x.Warning.Code {
+		t.Errorf("state = %s, want WARNING", state.Name)
+	}
+	expected := `'/'=10%;20:;5:;0;100 '/_original'=0.9;;;0;1`
+	if got := collection.PrintAllPerformanceData(); !strings.Contains(got, expected) {
+		t.Errorf("perfdata = %s, want %s", got, expected)
+	}
+}
@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/consol-monitoring/check_prometheus/internal/helper"
 	"github.com/consol-monitoring/check_prometheus/internal/mode"
 	"github.com/consol-monitoring/check_x"
+	"github.com/prometheus/common/model"
 	"github.com/urfave/cli/v3"
 )
 
@@ -23,7 +25,8 @@ const (
 	Url
 )
 
-var (
+// checkFlags are the destinations of the flags, every Check has its own so no value leaks into the next run
+type checkFlags struct {
 	address             *url.URL
 	timeout             int64
 	warning             string
@@ -38,7 +41,70 @@ var (
 	emptyQueryMessage   string
 	emptyQueryStatusArg string
 	emptyQueryStatus    check_x.State
-)
+	jobWarning          string
+	jobCritical         string
+	jobs                []string
+	matchers            []string
+	minTargets          []string
+	scrapeAgeFactor     float64
+	scrapePools         []string
+	zeroActiveStateArg  string
+	maxExamples         int
+	metric              string
+	metricType          string
+	helpRegex           string
+	metricLabels        []string
+	countLabels         []string
+	labelWarning        string
+	labelCritical       string
+	lookback            time.Duration
+	metricsPath         string
+	remoteURLs          []string
+	remoteWrite         mode.RemoteWriteThresholds
+	stateFile           string
+	maxSeriesAge        time.Duration
+	staleStateArg       string
+	queryLint           bool
+	scrapeExpression    mode.ScrapeExpression
+	histogramType       string
+	quantiles           []float64
+	rateWindow          time.Duration
+	groupBy             []string
+	goodSelector        string
+	errorSelector       string
+	totalSelector       string
+	objective           float64
+	sloPeriodArg        string
+	burnRates           []float64
+	outputTemplates     mode.OutputTemplates
+	perfdataOptions     mode.PerfdataOptions
+	valueTransform      mode.ValueTransform
+	aggregation         mode.Aggregation
+	seriesCountStateArg string
+	queryStats          mode.QueryStatsThresholds
+	requestWarning      string
+	requestCritical     string
+	noDataStates        mode.NoDataStates
+	scalarNaNStateArg   string
+	emptyMatrixStateArg string
+	emptySeriesStateArg string
+	nanStateArg         string
+	infStateArg         string
+	stringDefaultArg    string
+	thanosParameters    mode.ThanosParameters
+	maxLag              time.Duration
+	minCoverage         time.Duration
+	unhealthyStateArg   string
+	ringPath            string
+	heartbeatTimeout    time.Duration
+	versionRegex        string
+	maxAges             []string
+	failureStateArg     string
+	probeTarget         string
+	probeModule         string
+	probeDirect         bool
+	probeThresholds     mode.ProbeThresholds
+}
 
 // This function is intended to be used for single-use cli mode
 // It will be called from main executable function as it returns int
@@ -66,6 +132,7 @@ func Check(args []string) (check_x.State, string, *check_x.PerformanceDataCollec
 	msg := "Cli action did not run yet"
 	collection := check_x.NewPerformanceDataCollection()
 	var err error = nil
+	var flags checkFlags
 
 	cmd := &cli.Command{
 		Name:    "check_prometheus",
@@ -77,24 +144,95 @@ func Check(args []string) (check_x.State, string, *check_x.PerformanceDataCollec
 				Aliases:     []string{"t"},
 				Usage:       "Seconds till check returns unknown, 0 to disable",
 				Value:       10,
-				Destination: &timeout,
+				Destination: &flags.timeout,
 			},
 			&cli.IntFlag{
 				Name:        "data-age",
 				Aliases:     []string{"f"},
-				Usage:       "If the checked data is older then this in seconds, unknown will be returned. Set to 0 to disable.",
+				Usage:       "If the checked data is older then this in seconds, unknown will be returned. Instant queries stamp their samples with the evaluation time, so if it is set explicitly the query mode checks the age of every series like --series-age. Scalar and matrix results are not checked. Set to 0 to disable.",
 				Value:       300,
 				Destination: &helper.TimestampFreshness,
 			},
 			&cli.BoolFlag{
-				Name:  "verbose",
-				Usage: "Turn the verbose mode on.",
-				Value: false,
-				Action: func(ctx context.Context, cmd *cli.Command, value bool) error {
-					helper.Verbose = value
-					return nil
+				Name:        "verbose",
+				Usage:       "Turn the verbose mode on, traces the requests and responses like --debug-level 2.",
+				Destination: &helper.Verbose,
+			},
+			&cli.IntFlag{
+				Name:        "debug-level",
+				Usage:       "Trace to stderr or the --debug-file: 1 requests, 2 also responses with status and duration, 3 also the parsed results. Never written to stdout.",
+				Destination: &helper.DebugLevel,
+			},
+			&cli.BoolFlag{
+				Name:        "debug-body",
+				Usage:       "Add the request and response bodies to the trace.",
+				Destination: &helper.DebugBody,
+			},
+			&cli.StringFlag{
+				Name:  "debug-file",
+				Usage: "Append the trace to this file instead of stderr.",
+				Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+					return helper.OpenDebugFile(value)
+				},
+			},
+			&cli.StringSliceFlag{
+				Name:        "redact-header",
+				Usage:       "Header whose value is hidden in the trace, can be given multiple times. Authorization and Cookie headers are always hidden.",
+				Destination: &helper.RedactHeaders,
+			},
+			&cli.StringFlag{
+				Name:        "request-warning",
+				Usage:       "Warning value for the summed up duration of all requests of the mode in seconds. If this or --request-critical is set, the perfdata request_duration and requests is added. Use nagios-plugin syntax here.",
+				Destination: &flags.requestWarning,
+			},
+			&cli.StringFlag{
+				Name:        "request-critical",
+				Usage:       "Critical value for the summed up duration of all requests of the mode in seconds. Use nagios-plugin syntax here.",
+				Destination: &flags.requestCritical,
+			},
+			&cli.StringSliceFlag{
+				Name:  "header",
+				Usage: "Header to send with every request in the form 'Name: Value', e.g. 'X-Scope-OrgID: tenant' for Mimir. Can be given multiple times.",
+				Action: func(ctx context.Context, cmd *cli.Command, value []string) error {
+					return helper.ParseHeaders(value)
 				},
 			},
+			&cli.StringFlag{
+				Name:        "record",
+				Usage:       "Save every request and response into this directory, with the values of secret headers and parameters hidden.",
+				Destination: &helper.RecordDir,
+			},
+			&cli.StringFlag{
+				Name:        "replay",
+				Usage:       "Answer the requests with the responses saved by --record into this directory instead of sending them. The --data-age of replayed responses is not checked.",
+				Destination: &helper.ReplayDir,
+			},
+			&cli.BoolFlag{
+				Name:        "sigv4",
+				Usage:       "Sign requests with AWS Signature Version 4, required by Amazon Managed Service for Prometheus. Credentials are resolved by the default chain of the AWS SDK: environment, ~/.aws/config and ~/.aws/credentials profiles including SSO and credential_process, web identity, ECS task role and EC2 instance profile.",
+				Destination: &helper.SigV4Enabled,
+			},
+			&cli.StringFlag{
+				Name:        "sigv4-region",
+				Usage:       "AWS region used for signing. Defaults to AWS_REGION, AWS_DEFAULT_REGION or the region of the profile.",
+				Destination: &helper.SigV4Region,
+			},
+			&cli.StringFlag{
+				Name:        "sigv4-service",
+				Usage:       "AWS service name used for signing.",
+				Value:       helper.DefaultSigV4Service,
+				Destination: &helper.SigV4Service,
+			},
+			&cli.StringFlag{
+				Name:        "sigv4-profile",
+				Usage:       "Profile of ~/.aws/config and ~/.aws/credentials. Defaults to AWS_PROFILE.",
+				Destination: &helper.SigV4Profile,
+			},
+			&cli.StringFlag{
+				Name:        "sigv4-role-arn",
+				Usage:       "ARN of a role to assume with the resolved credentials before signing.",
+				Destination: &helper.SigV4RoleARN,
+			},
 		},
 		Commands: []*cli.Command{
 			{
@@ -111,13 +249,13 @@ func Check(args []string) (check_x.State, string, *check_x.PerformanceDataCollec
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							var ctxPing context.Context
 							var ctxPingCancel context.CancelFunc
-							if timeout == 0 {
+							if flags.timeout == 0 {
 								ctxPing = context.WithoutCancel(ctx)
 							} else {
-								ctxPing, ctxPingCancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+								ctxPing, ctxPingCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
 								defer ctxPingCancel()
 							}
-							state, msg, err = mode.Ping(ctxPing, address, &collection)
+							state, msg, err = mode.Ping(ctxPing, flags.address, &collection)
 							return err
 						},
 						Flags: []cli.Flag{
@@ -127,7 +265,7 @@ func Check(args []string) (check_x.State, string, *check_x.PerformanceDataCollec
 								Value: "http://localhost:9100",
 								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
 									url, err := url.Parse(value)
-									address = url
+									flags.address = url
 									return err
 								},
 								Validator: func(value string) error {
@@ -145,6 +283,7 @@ func Check(args []string) (check_x.State, string, *check_x.PerformanceDataCollec
 						HideHelp: false,
 						Usage:    "Checks collected data",
 						Description: `Your Promqlquery has to return a vector / scalar / matrix result. The warning and critical values are applied to every value.
+									With --lint the query is parsed before it is sent and syntax errors are reported with their position, otherwise they are only logged with --debug-level. Use the lint mode to check it for common mistakes.
 									Examples:
 										Vector:
 											check_prometheus mode query -q 'up'
@@ -182,36 +321,138 @@ func Check(args []string) (check_x.State, string, *check_x.PerformanceDataCollec
 											check_prometheus m q -q 'up{instance="SUPERHOST"}' -a '{{.}}'
 											--> OK - map[__name__:up hostname:SUPERHOST instance:SUPERHOST job:snmp mib:RittalCMC xvalue:1]|'{__name__="up", hostname="SUPERHOST", instance="SUPERHOST", job="snmp", mib="RittalCMC"}'=1;;;;
 
+										Template functions of the Alias:
+											value, state, warning, critical: the value as number, the evaluated state and the thresholds of the series
+											humanize, humanize1024, humanizeBytes, humanizeDuration, humanizePercentage: format numbers, labels or value
+											round <number> <decimals>, toFloat, printf: round and format numbers
+											gtf, gef, ltf, lef, eqf: compare labels, xvalue or value as numbers
+											reReplaceAll <regex> <replacement> <text>, toUpper, toLower: change label values
+											check_prometheus m q -q 'node_filesystem_avail_bytes' -a '[{{state}}] {{.mountpoint}} has {{humanizeBytes value}} free{{if ltf value 1e9}}, below 1GB{{end}}\n' -c 500000000:
+											--> CRITICAL - [CRITICAL] /var has 476.8MiB free, below 1GB\n|...
+											A failing template is shown as it is, use --strict-templates to return UNKNOWN instead or --debug-level 1 to trace the error.
+
+										Summary and long output templates:
+											--summary replaces the first line, --ok-summary, --warning-summary, --critical-summary and --unknown-summary replace it in their state.
+											They provide the number of series .Total, .OK, .Warning, .Critical and .Unknown, the not OK series ordered by severity .Problems,
+											the worst series .Worst and all series .Series. Every series has .Labels, .Value, .State and the rendered .Alias.
+											--series-template adds a long output line per series, like the alias.
+											check_prometheus m q -q 'disk_used_ratio' -w 0.8 -c 0.95 --critical-summary '{{.Critical}} of {{.Total}} disks critical: {{range .Problems}}{{.Labels.mountpoint}} on {{.Labels.instance}} ({{humanizePercentage .Value}}) {{end}}' --series-template '[{{state}}] {{.mountpoint}} on {{.instance}}'
+											--> CRITICAL - 1 of 40 disks critical: /var on db01 (97%)
+											[OK] / on db01
+											...
+
+										Perfdata labels, units, min and max:
+											The labels are escaped, '=' becomes ':', numbered if they are not unique and truncated with --perfdata-label-length.
+											check_prometheus m q -q 'node_filesystem_avail_bytes' --perfdata-label '{{.instance}}_{{.mountpoint}}' --unit auto --min auto
+											--> OK - Query: 'node_filesystem_avail_bytes'|'db01_/'=2147483648B;;;0; 'db01_/var'=498073600B;;;0;
+
+										Transform the values before they are checked:
+											The steps are applied in the order --invert, --convert, --scale/--divide, --clamp-min/--clamp-max and --round.
+											check_prometheus m q -q 'node_filesystem_avail_bytes{mountpoint="/"}' --convert GiB --round 1 --keep-original -c 2: --perfdata-label '{{.mountpoint}}' --unit auto
+											--> OK - Query: 'node_filesystem_avail_bytes{mountpoint="/"}'|'/'=12.5GiB;;2:;; '/_original'=13421772800B;;;;
+											check_prometheus m q -q 'cache_used_ratio' --invert --convert % -w 20: --perfdata-label 'free' --unit auto
+											--> OK - Query: 'cache_used_ratio'|'free'=35%;20:;;;
+
+										Evaluate the state out of all series:
+											One breaching series out of many does not have to be a problem of the service. --aggregate applies
+											--aggregate-warning and --aggregate-critical on the number or percentage of series breaching -w and -c,
+											on the number of OK series or on the sum, avg, min or max of the values. The states of the series are listed in the long output.
+											check_prometheus m q -q 'up{job="node"}' -c 1: --aggregate percent --aggregate-critical @10:
+											--> OK - Query: 'up{job="node"}', 5% of 40 series warning or worse, 5% critical
+											[OK] {__name__="up", instance="db01:9100", job="node"} 1
+											...
+											check_prometheus m q -q 'up{job="etcd"}' -c 1: --aggregate quorum --aggregate-critical 2: --min-series 3
+											--> CRITICAL - Query: 'up{job="etcd"}', 1 of 3 series OK
+
+										Find queries which put too much load on the server:
+											--stats requests the query stats of prometheus, the number of samples is checked against --samples-warning and --samples-critical.
+											--request-warning and --request-critical check the duration of the requests of every mode and add it as perfdata.
+											check_prometheus --request-warning 2 m q -q 'sum(rate(http_requests_total[1d]))' --stats --samples-critical 1000000
+											--> CRITICAL - Query: 'sum(rate(http_requests_total[1d]))', samples 4213780|'{}'=12.3;;;; 'samples'=4213780;;1000000;0; 'peak_samples'=8231;;;0; 'eval_time'=1.03s;;;0; 'request_duration'=1.042s;2;;0; 'requests'=1;;;0;
+
 										Use Different Message and Status code for queries that return no data.
 											If you have a query that only returns data in an error condition you can use this flags to return a custom message and status code.
 											check_prometheus m q -eqm 'All OK' -eqs 'OK'  -q 'http_requests_total{job="prometheus"}' -w 0 -c 0
 											--> OK - All OK
 											Without -eqm, -eqs
 											check_prometheus m q -q 'http_requests_total{job="prometheus"}' -w 0 -c 0
-											--> UNKNOWN - The given States do not contain an State
+											--> UNKNOWN - Query 'http_requests_total{job="prometheus"}' returned no data.
+
+										Results without data and string results:
+											Empty vectors and matrices and NaN scalars return --eqm and --eqs, unless --empty-matrix-state or --scalar-nan-state is set.
+											--nan-state and --inf-state replace the threshold evaluation of NaN and Inf values.
+											String results are mapped to a state by --string-state, the first matching one wins.
+											check_prometheus m q -q '"running"' --string-state 'ok=running' --string-state 'critical=~^(failed|error)'
+											--> OK - Query: '"running"' returned: 'running'
+
+										Detect exporters which stopped updating their series.
+											Prometheus stamps the samples of instant queries with the evaluation time, so the timestamps of the result cannot tell old data.
+											--series-age, or an explicitly set --data-age, looks up the last samples of every selector of the query over a short range.
+											Series of a single selector are matched by all their labels, others get the newest sample of the selected series with their labels.
+											check_prometheus m q -q 'node_time_seconds' --series-age 5m --stale-state critical
+											--> CRITICAL - Query: 'node_time_seconds'\n[CRITICAL] {__name__="node_time_seconds", instance="db01:9100", job="node"} last sample is 20m3s old
 
 										`,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							var ctxQuery context.Context
 							var ctxQueryCancel context.CancelFunc
-							if timeout == 0 {
+							if flags.timeout == 0 {
 								ctxQuery = context.WithoutCancel(ctx)
 							} else {
-								ctxQuery, ctxQueryCancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+								ctxQuery, ctxQueryCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
 								defer ctxQueryCancel()
 							}
 
-							state, msg, err = mode.Query(ctxQuery, address, queryDecoded, warning, critical, alias, search, replace, emptyQueryMessage, emptyQueryStatus, &collection)
+							flags.outputTemplates.Alias = flags.alias
+							flags.aggregation.SeriesCountState = check_x.StateFromString(flags.seriesCountStateArg)
+							flags.noDataStates.ScalarNaN = optionalState(flags.scalarNaNStateArg)
+							flags.noDataStates.EmptyMatrix = optionalState(flags.emptyMatrixStateArg)
+							flags.noDataStates.EmptySeries = optionalState(flags.emptySeriesStateArg)
+							flags.noDataStates.NaN = optionalState(flags.nanStateArg)
+							flags.noDataStates.Inf = optionalState(flags.infStateArg)
+							flags.noDataStates.StringDefault = optionalState(flags.stringDefaultArg)
+							flags.valueTransform.Round = cmd.IsSet("round")
+							thanos := mode.ThanosParameters{MaxSourceResolution: flags.thanosParameters.MaxSourceResolution}
+							if cmd.IsSet("dedup") {
+								thanos.Dedup = strconv.FormatBool(cmd.Bool("dedup"))
+							}
+							if cmd.IsSet("partial-response") {
+								thanos.PartialResponse = strconv.FormatBool(cmd.Bool("partial-response"))
+							}
+							// Instant queries stamp their samples with the evaluation time, an explicitly set --data-age
+							// checks the age of every series instead
+							maxSeriesAge := flags.maxSeriesAge
+							if maxSeriesAge == 0 && cmd.IsSet("data-age") && helper.TimestampFreshness > 0 {
+								maxSeriesAge = time.Duration(helper.TimestampFreshness) * time.Second
+							}
+							state, msg, err = mode.Query(ctxQuery, flags.address, flags.queryDecoded, mode.QueryOptions{
+								Warning:           flags.warning,
+								Critical:          flags.critical,
+								Templates:         flags.outputTemplates,
+								Perfdata:          flags.perfdataOptions,
+								Transform:         flags.valueTransform,
+								Aggregation:       flags.aggregation,
+								Stats:             flags.queryStats,
+								Thanos:            thanos,
+								Search:            flags.search,
+								Replace:           flags.replace,
+								EmptyQueryMessage: flags.emptyQueryMessage,
+								EmptyQueryStatus:  flags.emptyQueryStatus,
+								NoData:            flags.noDataStates,
+								MaxSeriesAge:      maxSeriesAge,
+								StaleState:        check_x.StateFromString(flags.staleStateArg),
+								Lint:              flags.queryLint,
+							}, &collection)
 							return err
 						},
-						Flags: []cli.Flag{
+						Flags: append([]cli.Flag{
 							&cli.StringFlag{
 								Name:  "address",
 								Usage: "Prometheus address: Protocol + IP + Port.",
 								Value: "http://localhost:9100",
 								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
 									url, err := url.Parse(value)
-									address = url
+									flags.address = url
 									return err
 								},
 								Validator: func(value string) error {
@@ -223,117 +464,264 @@ func Check(args []string) (check_x.State, string, *check_x.PerformanceDataCollec
 							&cli.StringFlag{
 								Name:        "q",
 								Usage:       "Query to be executed",
-								Destination: &query,
+								Destination: &flags.query,
 								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
-									query = value
-									queryDecoded = value
+									flags.query = value
+									flags.queryDecoded = value
 									return nil
 								},
 							},
 							&cli.StringFlag{
 								Name:        "a",
 								Usage:       "Alias, will replace the query within the output, if set. You can use go text/template syntax to output label values (only for vector results).",
-								Destination: &alias,
+								Destination: &flags.alias,
 							},
 							&cli.StringFlag{
 								Name:        "w",
 								Usage:       "Warning value. Use nagios-plugin syntax here.",
-								Destination: &warning,
+								Destination: &flags.warning,
 							},
 							&cli.StringFlag{
 								Name:        "c",
 								Usage:       "Critical value. Use nagios-plugin syntax here.",
-								Destination: &critical,
+								Destination: &flags.critical,
 							},
 							&cli.StringFlag{
 								Name:        "search",
 								Usage:       "If this variable is set, the given Golang regex will be used to search and replace the result with the 'replace' flag content. This will be appied on the perflabels.",
-								Destination: &search,
+								Destination: &flags.search,
 							},
 							&cli.StringFlag{
 								Name:        "replace",
 								Usage:       "See search flag. If the 'search' flag is empty this flag will be ignored.",
-								Destination: &replace,
-							},
-							&cli.BoolFlag{
-								Name:        "insecure, k",
-								Usage:       "Skip TLS certificate verification (insecure)",
-								Destination: &helper.InsecureSkipVerify,
-							},
-							&cli.StringFlag{
-								Name:  "cookie",
-								Usage: "Cookie to send during the api request, in form '<name>=<value>' ",
-								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
-									cookieKey := value[:strings.IndexRune(value, '=')]
-									cookieValue := value[strings.IndexRune(value, '=')+1:]
-									cookie := &http.Cookie{
-										Name:     cookieKey,
-										Value:    cookieValue,
-										Path:     "/",
-										SameSite: http.SameSiteLaxMode,
-										MaxAge:   3600,
-										Expires:  time.Now().Add(time.Hour),
-									}
-									helper.Cookies = append(helper.Cookies, cookie)
-									return nil
-								},
-								Validator: func(value string) error {
-									strings.Count(value, "=")
-									if strings.Count(value, "=") != 1 {
-										return fmt.Errorf("there should be exactly one '=' in the cookie definition")
-									}
-									cookieKey := value[:strings.IndexRune(value, '=')]
-									cookieValue := value[strings.IndexRune(value, '=')+1:]
-									if cookieKey == "" {
-										return fmt.Errorf("cookie key cannot be empty")
-									}
-									if cookieValue == "" {
-										return fmt.Errorf("cookie value cannot be empty")
-									}
-									if len(cookieValue) > 4096 {
-										return fmt.Errorf("cookie value cannot be longer than 4096 characters")
-									}
-
-									return nil
-								},
+								Destination: &flags.replace,
 							},
+							newInsecureFlag(),
+							newCookieFlag(),
 							&cli.StringFlag{
 								Name:        "eqm",
 								Usage:       "Message if the query returns no data.",
-								Destination: &emptyQueryMessage,
+								Destination: &flags.emptyQueryMessage,
 							},
 							&cli.StringFlag{
 								Name:        "eqs",
 								Usage:       "Status if the query returns no data.",
-								Destination: &emptyQueryStatusArg,
+								Destination: &flags.emptyQueryStatusArg,
 								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
-									emptyQueryStatus = check_x.StateFromString(value)
+									flags.emptyQueryStatus = check_x.StateFromString(value)
 									return nil
 								},
 							},
+							&cli.StringFlag{
+								Name:        "scalar-nan-state",
+								Usage:       "Status if the query returns NaN as scalar. Defaults to --eqs, then unknown.",
+								Destination: &flags.scalarNaNStateArg,
+							},
+							&cli.StringFlag{
+								Name:        "empty-matrix-state",
+								Usage:       "Status if the query returns a matrix without any value. Defaults to --eqs, then unknown.",
+								Destination: &flags.emptyMatrixStateArg,
+							},
+							&cli.StringFlag{
+								Name:        "empty-series-state",
+								Usage:       "Status of series without values inside a matrix. They are skipped if not set.",
+								Destination: &flags.emptySeriesStateArg,
+							},
+							&cli.StringFlag{
+								Name:        "nan-state",
+								Usage:       "Status of NaN values instead of the threshold evaluation.",
+								Destination: &flags.nanStateArg,
+							},
+							&cli.StringFlag{
+								Name:        "inf-state",
+								Usage:       "Status of +Inf and -Inf values instead of the threshold evaluation.",
+								Destination: &flags.infStateArg,
+							},
+							&cli.StringSliceFlag{
+								Name:        "string-state",
+								Usage:       "Status of a string result, '<state>=<value>' if it is equal or '<state>=~<regex>' if it matches. The first matching one wins, can be given multiple times.",
+								Destination: &flags.noDataStates.Strings,
+							},
+							&cli.StringFlag{
+								Name:        "string-default-state",
+								Usage:       "Status of a string result which matches no --string-state.",
+								Value:       "unknown",
+								Destination: &flags.stringDefaultArg,
+							},
+							&cli.DurationFlag{
+								Name:        "series-age",
+								Usage:       "Looks up the time of the last sample of every series and reports series older than this with the --stale-state, e.g. '10m'. Aggregated series are as old as the newest of their input series. Defaults to an explicitly set --data-age, 0 to disable.",
+								Destination: &flags.maxSeriesAge,
+							},
+							&cli.StringFlag{
+								Name:        "stale-state",
+								Usage:       "Status of series older than --series-age.",
+								Value:       "unknown",
+								Destination: &flags.staleStateArg,
+							},
+							&cli.BoolFlag{
+								Name:        "lint",
+								Usage:       "Parses the query before it is sent and returns UNKNOWN with the position of syntax errors. Leave it off for servers with their own query language extensions, e.g. MetricsQL.",
+								Destination: &flags.queryLint,
+							},
+							&cli.StringFlag{
+								Name:        "unit",
+								Usage:       "Unit of the perfdata, e.g. 's', 'B' or '%'. 'auto' derives it from the _seconds and _bytes suffix of the metric name.",
+								Destination: &flags.perfdataOptions.Unit,
+							},
+							&cli.StringFlag{
+								Name:        "min",
+								Usage:       "Minimum of the perfdata. 'auto' derives it from the _bytes and _ratio suffix of the metric name.",
+								Destination: &flags.perfdataOptions.Min,
+							},
+							&cli.StringFlag{
+								Name:        "max",
+								Usage:       "Maximum of the perfdata. 'auto' derives it from the _ratio suffix of the metric name.",
+								Destination: &flags.perfdataOptions.Max,
+							},
+							&cli.StringFlag{
+								Name:        "perfdata-label",
+								Usage:       "Go text/template of the perfdata label, e.g. '{{.instance}}_{{.mountpoint}}'. Defaults to all labels of the series.",
+								Destination: &flags.perfdataOptions.Label,
+							},
+							&cli.IntFlag{
+								Name:        "perfdata-label-length",
+								Usage:       "Truncates the perfdata labels to this length, e.g. 100 for graphers which break on longer labels. 0 keeps their length.",
+								Destination: &flags.perfdataOptions.MaxLabelLength,
+							},
+							&cli.BoolFlag{
+								Name:        "invert",
+								Usage:       "Replaces the value x by 1 - x before it is checked, e.g. to turn a used ratio into a free one.",
+								Destination: &flags.valueTransform.Invert,
+							},
+							&cli.StringFlag{
+								Name:        "convert",
+								Usage:       "Converts the value into this unit before it is checked, e.g. 'GiB', 'ms' or '%'. The source unit is derived from the metric name, or given like 'B:GiB'.",
+								Destination: &flags.valueTransform.Convert,
+							},
+							&cli.FloatFlag{
+								Name:        "scale",
+								Usage:       "Multiplies the value by this factor before it is checked.",
+								Destination: &flags.valueTransform.Scale,
+							},
+							&cli.FloatFlag{
+								Name:        "divide",
+								Usage:       "Divides the value by this divisor before it is checked.",
+								Destination: &flags.valueTransform.Divide,
+							},
+							&cli.StringFlag{
+								Name:        "clamp-min",
+								Usage:       "Raises smaller values to this minimum before they are checked.",
+								Destination: &flags.valueTransform.ClampMin,
+							},
+							&cli.StringFlag{
+								Name:        "clamp-max",
+								Usage:       "Lowers larger values to this maximum before they are checked.",
+								Destination: &flags.valueTransform.ClampMax,
+							},
+							&cli.IntFlag{
+								Name:        "round",
+								Usage:       "Rounds the value to this number of decimals before it is checked.",
+								Destination: &flags.valueTransform.Decimals,
+							},
+							&cli.BoolFlag{
+								Name:        "keep-original",
+								Usage:       "Adds the value before the transformation as additional perfdata with the suffix _original.",
+								Destination: &flags.valueTransform.KeepOriginal,
+							},
+							&cli.BoolFlag{
+								Name:        "stats",
+								Usage:       "Requests the query stats and adds the samples the query processed, the peak samples in memory and the evaluation time as perfdata.",
+								Destination: &flags.queryStats.Enabled,
+							},
+							&cli.StringFlag{
+								Name:        "samples-warning",
+								Usage:       "Warning value for the number of samples the query processed, requires --stats. Use nagios-plugin syntax here.",
+								Destination: &flags.queryStats.SamplesWarning,
+							},
+							&cli.StringFlag{
+								Name:        "samples-critical",
+								Usage:       "Critical value for the number of samples the query processed, requires --stats. Use nagios-plugin syntax here.",
+								Destination: &flags.queryStats.SamplesCritical,
+							},
+							&cli.StringFlag{
+								Name:        "peak-samples-warning",
+								Usage:       "Warning value for the peak number of samples in memory, requires --stats. Use nagios-plugin syntax here.",
+								Destination: &flags.queryStats.PeakSamplesWarning,
+							},
+							&cli.StringFlag{
+								Name:        "peak-samples-critical",
+								Usage:       "Critical value for the peak number of samples in memory, requires --stats. Use nagios-plugin syntax here.",
+								Destination: &flags.queryStats.PeakSamplesCritical,
+							},
+							&cli.BoolFlag{
+								Name:  "dedup",
+								Usage: "Sends the Thanos parameter dedup, to enable or disable the deduplication of replicas. Not sent by default.",
+							},
+							&cli.BoolFlag{
+								Name:  "partial-response",
+								Usage: "Sends the Thanos parameter partial_response, to allow or deny results of only some of the stores. Not sent by default.",
+							},
+							&cli.StringFlag{
+								Name:        "max-source-resolution",
+								Usage:       "Sends the Thanos parameter max_source_resolution, the coarsest downsampled resolution to use, e.g. '5m', '1h' or 'auto'.",
+								Destination: &flags.thanosParameters.MaxSourceResolution,
+							},
+							&cli.StringFlag{
+								Name:        "aggregate",
+								Usage:       "Evaluates the state out of all series of a vector instead of the worst series: 'worst', 'count' or 'percent' of the series breaching -w and -c, 'quorum' of OK series, 'sum', 'avg', 'min' or 'max' of the values.",
+								Value:       mode.AggregateWorst,
+								Destination: &flags.aggregation.Mode,
+							},
+							&cli.StringFlag{
+								Name:        "aggregate-warning",
+								Usage:       "Warning value of the aggregate. Use nagios-plugin syntax here.",
+								Destination: &flags.aggregation.Warning,
+							},
+							&cli.StringFlag{
+								Name:        "aggregate-critical",
+								Usage:       "Critical value of the aggregate. Use nagios-plugin syntax here.",
+								Destination: &flags.aggregation.Critical,
+							},
+							&cli.IntFlag{
+								Name:        "min-series",
+								Usage:       "Minimum number of series the vector has to contain. 0 to disable.",
+								Destination: &flags.aggregation.MinSeries,
+							},
+							&cli.IntFlag{
+								Name:        "max-series",
+								Usage:       "Maximum number of series the vector may contain. 0 to disable.",
+								Destination: &flags.aggregation.MaxSeries,
+							},
+							&cli.StringFlag{
+								Name:        "series-count-state",
+								Usage:       "Status if the number of series is out of --min-series and --max-series.",
+								Value:       "critical",
+								Destination: &flags.seriesCountStateArg,
+							},
 							&cli.StringFlag{
 								Name:  "query-encoding",
 								Value: "raw",
 								Usage: "Query encoding if query is given in encoded form. Supports 'raw', 'base64' and 'url' type encodings. Specify this parameter after the query.",
 								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
-									if query == "" {
+									if flags.query == "" {
 										return fmt.Errorf("query argument is empty, specify query-encoding after specifying query")
 									}
 									switch strings.ToLower(value) {
 									case "raw":
-										queryEncoding = Raw
-										queryDecoded = query
+										flags.queryEncoding = Raw
+										flags.queryDecoded = flags.query
 									case "base64":
-										queryEncoding = Base64
-										bytes, err := base64.StdEncoding.DecodeString(query)
+										flags.queryEncoding = Base64
+										bytes, err := base64.StdEncoding.DecodeString(flags.query)
 										if err != nil {
 											return fmt.Errorf("base64 query decoding failed with error: %s", err.Error())
 										}
-										queryDecoded = string(bytes)
+										flags.queryDecoded = string(bytes)
 									case "url":
-										queryEncoding = Url
+										flags.queryEncoding = Url
 										var err error
-										queryDecoded, err = url.QueryUnescape(query)
+										flags.queryDecoded, err = url.QueryUnescape(flags.query)
 										if err != nil {
 											return fmt.Errorf("url query decoding failed with error: %s", err.Error())
 										}
@@ -346,11 +734,11 @@ func Check(args []string) (check_x.State, string, *check_x.PerformanceDataCollec
 								Validator: func(value string) error {
 									switch strings.ToLower(value) {
 									case "raw":
-										queryEncoding = Raw
+										flags.queryEncoding = Raw
 									case "base64":
-										queryEncoding = Base64
+										flags.queryEncoding = Base64
 									case "url":
-										queryEncoding = Url
+										flags.queryEncoding = Url
 									default:
 										return fmt.Errorf("unknown query encoding, available values are 'raw', 'base64', 'url'")
 									}
@@ -358,25 +746,88 @@ func Check(args []string) (check_x.State, string, *check_x.PerformanceDataCollec
 								},
 								ValidateDefaults: true,
 							},
+						}, newTemplateFlags(&flags.outputTemplates)...),
+					},
+
+					{
+						Name:     "lint",
+						HideHelp: false,
+						Usage:    "Validates a PromQL query without executing it",
+						Description: `Parses the query with the PromQL parser of prometheus and reports syntax errors with their position as critical.
+									Common mistakes are reported as warning:
+										- range selectors, query checks the values of a matrix result without perfdata and alias labels
+										- aggregations without 'by' which remove the labels used by a per series alias
+										- rate(), irate() and increase() on gauges, only if --address is given to look up the metadata
+									Examples:
+										check_prometheus m lint -q 'sum(rate(http_requests_total[5m])'
+										--> CRITICAL - Query: 'sum(rate(http_requests_total[5m])' is invalid: 1:34: parse error: unclosed left parenthesis
+
+										check_prometheus m lint --address http://localhost:9090 -q 'sum(rate(node_load1[5m]))' -a '{{.instance}}: {{.xvalue}}'
+										--> WARNING - Query: 'sum(rate(node_load1[5m]))' has 2 problems
+										1:1: sum removes the labels instance used by the alias, add them with by (...)
+										1:5: rate() is used on the gauge node_load1, it only works on counters, use deriv() or delta() instead
+										`,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							var ctxLint context.Context
+							var ctxLintCancel context.CancelFunc
+							if flags.timeout == 0 {
+								ctxLint = context.WithoutCancel(ctx)
+							} else {
+								ctxLint, ctxLintCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
+								defer ctxLintCancel()
+							}
+
+							state, msg, err = mode.Lint(ctxLint, flags.address, flags.query, flags.alias, &collection)
+							return err
+						},
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "address",
+								Usage: "Prometheus address: Protocol + IP + Port. Optional, the metadata of the metrics is only checked if it is set.",
+								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+									url, err := url.Parse(value)
+									flags.address = url
+									return err
+								},
+							},
+							&cli.StringFlag{
+								Name:        "q",
+								Usage:       "Query to be validated",
+								Destination: &flags.query,
+							},
+							&cli.StringFlag{
+								Name:        "a",
+								Usage:       "Alias of the query, its labels are compared with the labels of the result.",
+								Destination: &flags.alias,
+							},
+							newInsecureFlag(),
+							newCookieFlag(),
 						},
 					},
 
 					{
-						Name:        "targets_health",
-						HideHelp:    false,
-						Usage:       "Returns the health of the targets",
-						Description: `The warning and critical thresholds are appied on the health_rate. The health_rate is calculted: sum(healthy) / sum(targets).`,
+						Name:     "targets_health",
+						HideHelp: false,
+						Usage:    "Returns the health of the targets",
+						Description: `The warning and critical thresholds are appied on the health_rate. The health_rate is calculted: sum(healthy) / sum(targets).
+									The targets can be limited to jobs and label matchers, every job gets its own health_rate which is checked against the job thresholds.
+									Examples:
+										Only production targets, every job needs at least 2 targets, node needs 10:
+											check_prometheus m targets_health --match 'env=prod' --min-targets 2 --min-targets 'node=10'
+										Treat targets as unhealthy if they were not scraped for three scrape intervals:
+											check_prometheus m targets_health --job node --job-c 0.9: --max-scrape-age 3
+									`,
 						Action: func(ctx context.Context, cmd *cli.Command) error {
 							var ctxTargetsHealth context.Context
 							var ctxTargetsHealthCancel context.CancelFunc
-							if timeout == 0 {
+							if flags.timeout == 0 {
 								ctxTargetsHealth = context.WithoutCancel(ctx)
 							} else {
-								ctxTargetsHealth, ctxTargetsHealthCancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+								ctxTargetsHealth, ctxTargetsHealthCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
 								defer ctxTargetsHealthCancel()
 							}
 
-							state, msg, err = mode.TargetsHealth(ctxTargetsHealth, address, label, warning, critical, &collection)
+							state, msg, err = mode.TargetsHealth(ctxTargetsHealth, flags.address, flags.label, flags.warning, flags.critical, flags.jobWarning, flags.jobCritical, flags.jobs, flags.matchers, flags.minTargets, flags.scrapeAgeFactor, &collection)
 							return err
 						},
 						Flags: []cli.Flag{
@@ -386,7 +837,7 @@ func Check(args []string) (check_x.State, string, *check_x.PerformanceDataCollec
 								Value: "http://localhost:9100",
 								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
 									url, err := url.Parse(value)
-									address = url
+									flags.address = url
 									return err
 								},
 								Validator: func(value string) error {
@@ -398,29 +849,1426 @@ func Check(args []string) (check_x.State, string, *check_x.PerformanceDataCollec
 							&cli.StringFlag{
 								Name:        "w",
 								Usage:       "Warning value. Use nagios-plugin syntax here.",
-								Destination: &warning,
+								Destination: &flags.warning,
 							},
 							&cli.StringFlag{
 								Name:        "c",
 								Usage:       "Critical value. Use nagios-plugin syntax here.",
-								Destination: &critical,
+								Destination: &flags.critical,
 							},
+							newInsecureFlag(),
+							newCookieFlag(),
 							&cli.StringFlag{
 								Name:        "l",
-								Usage:       "Prometheus-Label, which will be used for the performance data label. By default job and instance should be available.",
-								Destination: &label,
+								Usage:       "Prometheus-Label, which will be used for the performance data label, prefixed by the job. By default job and instance should be available.",
+								Destination: &flags.label,
 								Value:       mode.DefaultLabel,
 							},
+							&cli.StringSliceFlag{
+								Name:        "job",
+								Usage:       "Only check targets of this job, can be given multiple times. Given jobs are reported even if they have no targets.",
+								Destination: &flags.jobs,
+							},
+							&cli.StringSliceFlag{
+								Name:        "match",
+								Usage:       "Only check targets matching this label matcher, e.g. 'env=prod', 'env!=dev', 'team=~db|web'. Can be given multiple times.",
+								Destination: &flags.matchers,
+							},
+							&cli.StringFlag{
+								Name:        "job-w",
+								Usage:       "Warning value for the health_rate of every job. Use nagios-plugin syntax here.",
+								Destination: &flags.jobWarning,
+							},
+							&cli.StringFlag{
+								Name:        "job-c",
+								Usage:       "Critical value for the health_rate of every job. Use nagios-plugin syntax here.",
+								Destination: &flags.jobCritical,
+							},
+							&cli.StringSliceFlag{
+								Name:        "min-targets",
+								Usage:       "Minimum number of targets per job, critical if less. Use 'N' for every job or 'job=N' for a single job, can be given multiple times.",
+								Destination: &flags.minTargets,
+							},
+							&cli.FloatFlag{
+								Name:        "max-scrape-age",
+								Usage:       "Treat targets as unhealthy if their last scrape is older than this multiple of their scrape interval. 0 to disable.",
+								Destination: &flags.scrapeAgeFactor,
+							},
 						},
 					},
-				},
-			},
-		},
-	}
 
-	if err := cmd.Run(context.Background(), args); err != nil {
-		return check_x.Unknown, fmt.Sprintf("Error when executing cli action : %s", err.Error()), &collection, err
-	}
+					{
+						Name:     "dropped_targets",
+						HideHelp: false,
+						Usage:    "Checks the service discovery by the active and dropped targets of the scrape pools",
+						Description: `Every scrape pool without active targets returns the --zero-active-state, the warning and critical thresholds are applied on the number of dropped targets per scrape pool.
+									Examples of the discovered labels of dropped targets are listed for every pool which is not OK, to help finding wrong relabel configs.
+									Examples:
+										All scrape pools, critical if a pool has no active targets or more than 100 dropped ones:
+											check_prometheus m dropped_targets -c 100
+										Only the kubernetes pods pool:
+											check_prometheus m dropped_targets --scrape-pool kubernetes-pods -w 50 -c 200
+									`,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							var ctxDroppedTargets context.Context
+							var ctxDroppedTargetsCancel context.CancelFunc
+							if flags.timeout == 0 {
+								ctxDroppedTargets = context.WithoutCancel(ctx)
+							} else {
+								ctxDroppedTargets, ctxDroppedTargetsCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
+								defer ctxDroppedTargetsCancel()
+							}
 
-	return state, msg, &collection, err
+							zeroActiveState := check_x.StateFromString(flags.zeroActiveStateArg)
+							state, msg, err = mode.DroppedTargets(ctxDroppedTargets, flags.address, flags.scrapePools, flags.warning, flags.critical, zeroActiveState, flags.maxExamples, &collection)
+							return err
+						},
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "address",
+								Usage: "Prometheus address: Protocol + IP + Port.",
+								Value: "http://localhost:9100",
+								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+									url, err := url.Parse(value)
+									flags.address = url
+									return err
+								},
+								Validator: func(value string) error {
+									_, err := url.Parse(value)
+									return err
+								},
+								ValidateDefaults: true,
+							},
+							&cli.StringFlag{
+								Name:        "w",
+								Usage:       "Warning value for the dropped targets of every scrape pool. Use nagios-plugin syntax here.",
+								Destination: &flags.warning,
+							},
+							&cli.StringFlag{
+								Name:        "c",
+								Usage:       "Critical value for the dropped targets of every scrape pool. Use nagios-plugin syntax here.",
+								Destination: &flags.critical,
+							},
+							newInsecureFlag(),
+							newCookieFlag(),
+							&cli.StringSliceFlag{
+								Name:        "scrape-pool",
+								Usage:       "Only check this scrape pool, can be given multiple times. By default all scrape pools are checked.",
+								Destination: &flags.scrapePools,
+							},
+							&cli.StringFlag{
+								Name:        "zero-active-state",
+								Usage:       "Status if a scrape pool has no active targets.",
+								Value:       "critical",
+								Destination: &flags.zeroActiveStateArg,
+							},
+							&cli.IntFlag{
+								Name:        "examples",
+								Usage:       "Number of dropped targets per scrape pool whose discovered labels are listed in the long output.",
+								Value:       3,
+								Destination: &flags.maxExamples,
+							},
+						},
+					},
+
+					{
+						Name:     "metric",
+						HideHelp: false,
+						Usage:    "Checks the existence, metadata, labels and series count of a metric",
+						Description: `Uses the metadata, series and label APIs to assert that a metric exists with the expected type, help text and labels.
+									The warning and critical thresholds are applied on the number of series, without thresholds a metric without series is critical.
+									Examples:
+										Counter with at least 10 series of the node job:
+											check_prometheus m metric --metric node_network_receive_bytes_total --type counter --match 'job=node' -c 10:
+										Required labels and at most 500 distinct paths:
+											check_prometheus m metric --metric http_requests_total --label method --label code --count-label path --label-c 500
+									`,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							var ctxMetric context.Context
+							var ctxMetricCancel context.CancelFunc
+							if flags.timeout == 0 {
+								ctxMetric = context.WithoutCancel(ctx)
+							} else {
+								ctxMetric, ctxMetricCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
+								defer ctxMetricCancel()
+							}
+
+							state, msg, err = mode.Metric(ctxMetric, flags.address, flags.metric, flags.matchers, flags.metricType, flags.helpRegex, flags.metricLabels, flags.countLabels, flags.warning, flags.critical, flags.labelWarning, flags.labelCritical, flags.lookback, &collection)
+							return err
+						},
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "address",
+								Usage: "Prometheus address: Protocol + IP + Port.",
+								Value: "http://localhost:9100",
+								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+									url, err := url.Parse(value)
+									flags.address = url
+									return err
+								},
+								Validator: func(value string) error {
+									_, err := url.Parse(value)
+									return err
+								},
+								ValidateDefaults: true,
+							},
+							&cli.StringFlag{
+								Name:        "metric",
+								Usage:       "Name of the metric, for histograms and summaries the base name without _bucket, _count or _sum.",
+								Destination: &flags.metric,
+								Required:    true,
+							},
+							&cli.StringSliceFlag{
+								Name:        "match",
+								Usage:       "Only consider series matching this label matcher, e.g. 'job=node'. Can be given multiple times.",
+								Destination: &flags.matchers,
+							},
+							&cli.StringFlag{
+								Name:        "type",
+								Usage:       "Expected metric type out of the metadata, e.g. 'counter', 'gauge', 'histogram', 'summary'.",
+								Destination: &flags.metricType,
+							},
+							&cli.StringFlag{
+								Name:        "help-regex",
+								Usage:       "Golang regex the help text out of the metadata has to match.",
+								Destination: &flags.helpRegex,
+							},
+							&cli.StringSliceFlag{
+								Name:        "label",
+								Usage:       "Label name the series have to provide, can be given multiple times.",
+								Destination: &flags.metricLabels,
+							},
+							&cli.StringSliceFlag{
+								Name:        "count-label",
+								Usage:       "Label whose distinct values are counted and checked against --label-w and --label-c, can be given multiple times.",
+								Destination: &flags.countLabels,
+							},
+							&cli.StringFlag{
+								Name:        "w",
+								Usage:       "Warning value for the number of series. Use nagios-plugin syntax here.",
+								Destination: &flags.warning,
+							},
+							&cli.StringFlag{
+								Name:        "c",
+								Usage:       "Critical value for the number of series. Use nagios-plugin syntax here.",
+								Destination: &flags.critical,
+							},
+							newInsecureFlag(),
+							newCookieFlag(),
+							&cli.StringFlag{
+								Name:        "label-w",
+								Usage:       "Warning value for the number of distinct values of every count label. Use nagios-plugin syntax here.",
+								Destination: &flags.labelWarning,
+							},
+							&cli.StringFlag{
+								Name:        "label-c",
+								Usage:       "Critical value for the number of distinct values of every count label. Use nagios-plugin syntax here.",
+								Destination: &flags.labelCritical,
+							},
+							&cli.DurationFlag{
+								Name:        "lookback",
+								Usage:       "Time range in which the series are searched.",
+								Value:       5 * time.Minute,
+								Destination: &flags.lookback,
+							},
+						},
+					},
+
+					{
+						Name:     "histogram",
+						HideHelp: false,
+						Usage:    "Checks the quantiles of a histogram or summary",
+						Description: `Builds the histogram_quantile query for classic or native histograms, or selects the quantiles of a summary, and checks every quantile per group.
+									The warning and critical thresholds are applied on every quantile. Metrics ending in _seconds or _bytes get the unit s or B in the perfdata.
+									The type auto uses the _bucket series of a classic histogram and falls back to a native histogram if there are none.
+									Examples:
+										99th percentile latency per job below 250ms, critical above 1s:
+											check_prometheus m histogram --metric http_request_duration_seconds --quantile 0.99 --by job -w 0.25 -c 1
+										--> WARNING - Histogram 'http_request_duration_seconds' (classic) has 2 groups, api_p99 is 0.4s
+										[WARNING] {job="api"} p99: 0.4s
+										[OK] {job="web"} p99: 0.12s|'api_p99'=0.4s;0.25;1;; 'web_p99'=0.12s;0.25;1;;
+
+										Median and 95th percentile of a native histogram over 10 minutes:
+											check_prometheus m histogram --metric rpc_duration_seconds --type native --quantile 0.5 --quantile 0.95 --window 10m
+									`,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							var ctxHistogram context.Context
+							var ctxHistogramCancel context.CancelFunc
+							if flags.timeout == 0 {
+								ctxHistogram = context.WithoutCancel(ctx)
+							} else {
+								ctxHistogram, ctxHistogramCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
+								defer ctxHistogramCancel()
+							}
+
+							state, msg, err = mode.Histogram(ctxHistogram, flags.address, flags.metric, flags.matchers, flags.histogramType, flags.quantiles, flags.rateWindow, flags.groupBy, flags.warning, flags.critical, &collection)
+							return err
+						},
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "address",
+								Usage: "Prometheus address: Protocol + IP + Port.",
+								Value: "http://localhost:9100",
+								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+									url, err := url.Parse(value)
+									flags.address = url
+									return err
+								},
+								Validator: func(value string) error {
+									_, err := url.Parse(value)
+									return err
+								},
+								ValidateDefaults: true,
+							},
+							&cli.StringFlag{
+								Name:        "metric",
+								Usage:       "Base name of the histogram or summary, without _bucket, _count or _sum.",
+								Destination: &flags.metric,
+								Required:    true,
+							},
+							&cli.StringSliceFlag{
+								Name:        "match",
+								Usage:       "Only consider series matching this label matcher, e.g. 'job=api'. Can be given multiple times.",
+								Destination: &flags.matchers,
+							},
+							&cli.StringFlag{
+								Name:        "type",
+								Usage:       "Type of the metric: 'auto', 'classic', 'native' or 'summary'.",
+								Value:       mode.HistogramAuto,
+								Destination: &flags.histogramType,
+							},
+							&cli.FloatSliceFlag{
+								Name:        "quantile",
+								Usage:       "Quantile between 0 and 1 to check, can be given multiple times.",
+								Value:       []float64{0.99},
+								Destination: &flags.quantiles,
+							},
+							&cli.DurationFlag{
+								Name:        "window",
+								Usage:       "Range of the rate the histogram quantiles are calculated of, not used for summaries.",
+								Value:       5 * time.Minute,
+								Destination: &flags.rateWindow,
+							},
+							&cli.StringSliceFlag{
+								Name:        "by",
+								Usage:       "Label the quantiles are grouped by, can be given multiple times.",
+								Destination: &flags.groupBy,
+							},
+							&cli.StringFlag{
+								Name:        "w",
+								Usage:       "Warning value for every quantile. Use nagios-plugin syntax here.",
+								Destination: &flags.warning,
+							},
+							&cli.StringFlag{
+								Name:        "c",
+								Usage:       "Critical value for every quantile. Use nagios-plugin syntax here.",
+								Destination: &flags.critical,
+							},
+							newInsecureFlag(),
+							newCookieFlag(),
+						},
+					},
+
+					{
+						Name:     "slo",
+						HideHelp: false,
+						Usage:    "Checks the burn rate and remaining error budget of a service level objective",
+						Description: `Calculates the error ratio out of the good or error series and the total series and alerts on the burn rate of the error budget
+									like the multiwindow, multi-burn-rate alerts of the SRE workbook:
+										CRITICAL if the burn rate over 1h and 5m is above 14.4 or over 6h and 30m is above 6
+										WARNING if the burn rate over 3d and 6h is above 1
+									The warning and critical thresholds are applied on the remaining error budget of the period in percent.
+									All windows are queried concurrently within the timeout.
+									Missing good or error series count as none, missing total series return UNKNOWN so a typo in the selector can't look like a healthy service.
+									Examples:
+										99.9% of the requests without server errors over 30 days:
+											check_prometheus m slo --errors 'http_requests_total{job="api", code=~"5.."}' --total 'http_requests_total{job="api"}' --objective 99.9 -w 25: -c 10:
+										--> WARNING - SLO 99.9% over 30d: availability 99.920%, error budget remaining 20.00%, burning 1.4x over 3d
+										[OK] 1h/5m burn rate 0.80/0.40, alerting above 14.4
+										[OK] 6h/30m burn rate 1.10/0.90, alerting above 6
+										[WARNING] 3d/6h burn rate 1.40/1.20, alerting above 1|...
+									`,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							var ctxSLO context.Context
+							var ctxSLOCancel context.CancelFunc
+							if flags.timeout == 0 {
+								ctxSLO = context.WithoutCancel(ctx)
+							} else {
+								ctxSLO, ctxSLOCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
+								defer ctxSLOCancel()
+							}
+
+							period, err := model.ParseDuration(flags.sloPeriodArg)
+							if err != nil {
+								return fmt.Errorf("invalid period '%s': %s", flags.sloPeriodArg, err.Error())
+							}
+							state, msg, err = mode.SLO(ctxSLO, flags.address, flags.goodSelector, flags.errorSelector, flags.totalSelector, flags.objective, time.Duration(period), mode.DefaultBurnRateWindows(flags.burnRates), flags.warning, flags.critical, &collection)
+							return err
+						},
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "address",
+								Usage: "Prometheus address: Protocol + IP + Port.",
+								Value: "http://localhost:9100",
+								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+									url, err := url.Parse(value)
+									flags.address = url
+									return err
+								},
+								Validator: func(value string) error {
+									_, err := url.Parse(value)
+									return err
+								},
+								ValidateDefaults: true,
+							},
+							&cli.StringFlag{
+								Name:        "good",
+								Usage:       "Series selector of the counter of good events, e.g. 'http_requests_total{code!~\"5..\"}'. Either --good or --errors is required.",
+								Destination: &flags.goodSelector,
+							},
+							&cli.StringFlag{
+								Name:        "errors",
+								Usage:       "Series selector of the counter of failed events, e.g. 'http_requests_total{code=~\"5..\"}'.",
+								Destination: &flags.errorSelector,
+							},
+							&cli.StringFlag{
+								Name:        "total",
+								Usage:       "Series selector of the counter of all events, e.g. 'http_requests_total'.",
+								Destination: &flags.totalSelector,
+								Required:    true,
+							},
+							&cli.FloatFlag{
+								Name:        "objective",
+								Usage:       "Objective as ratio or percentage, e.g. 0.999 or 99.9.",
+								Destination: &flags.objective,
+								Required:    true,
+							},
+							&cli.StringFlag{
+								Name:        "period",
+								Usage:       "Period of the objective the error budget is calculated for, e.g. '30d' or '4w'.",
+								Value:       "30d",
+								Destination: &flags.sloPeriodArg,
+							},
+							&cli.FloatSliceFlag{
+								Name:        "burn-rate",
+								Usage:       "Burn rate factors of the 1h/5m, 6h/30m and 3d/6h windows, in this order. Can be given up to three times.",
+								Value:       []float64{14.4, 6, 1},
+								Destination: &flags.burnRates,
+							},
+							&cli.StringFlag{
+								Name:        "w",
+								Usage:       "Warning value for the remaining error budget in percent. Use nagios-plugin syntax here.",
+								Destination: &flags.warning,
+							},
+							&cli.StringFlag{
+								Name:        "c",
+								Usage:       "Critical value for the remaining error budget in percent. Use nagios-plugin syntax here.",
+								Destination: &flags.critical,
+							},
+							newInsecureFlag(),
+							newCookieFlag(),
+						},
+					},
+
+					{
+						Name:     "remote_write",
+						HideHelp: false,
+						Usage:    "Checks the remote write queues, also of prometheus servers in agent mode",
+						Description: `Scrapes the metrics endpoint of the prometheus server itself and checks the prometheus_remote_storage_* metrics of every remote write queue.
+									The failed, retried and sent samples per second are calculated against the values of the last run, which are kept in the state file.
+									Examples:
+										Critical if a queue lags behind for more than 5 minutes or fails to send samples:
+											check_prometheus m remote_write --address http://agent:9090 --lag-w 120 --lag-c 300 --failed-c 0
+									`,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							var ctxRemoteWrite context.Context
+							var ctxRemoteWriteCancel context.CancelFunc
+							if flags.timeout == 0 {
+								ctxRemoteWrite = context.WithoutCancel(ctx)
+							} else {
+								ctxRemoteWrite, ctxRemoteWriteCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
+								defer ctxRemoteWriteCancel()
+							}
+
+							state, msg, err = mode.RemoteWrite(ctxRemoteWrite, flags.address, flags.metricsPath, flags.remoteURLs, flags.remoteWrite, flags.stateFile, &collection)
+							return err
+						},
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "address",
+								Usage: "Prometheus address: Protocol + IP + Port.",
+								Value: "http://localhost:9100",
+								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+									url, err := url.Parse(value)
+									flags.address = url
+									return err
+								},
+								Validator: func(value string) error {
+									_, err := url.Parse(value)
+									return err
+								},
+								ValidateDefaults: true,
+							},
+							&cli.StringFlag{
+								Name:        "metrics-path",
+								Usage:       "Path of the metrics endpoint.",
+								Value:       mode.DefaultMetricsPath,
+								Destination: &flags.metricsPath,
+							},
+							&cli.StringSliceFlag{
+								Name:        "remote-url",
+								Usage:       "Only check the queue of this remote write url, critical if it does not exist. Can be given multiple times.",
+								Destination: &flags.remoteURLs,
+							},
+							&cli.StringFlag{
+								Name:        "lag-w",
+								Usage:       "Warning value for the lag in seconds between the newest appended and the newest sent sample of every queue. Use nagios-plugin syntax here.",
+								Destination: &flags.remoteWrite.LagWarning,
+							},
+							&cli.StringFlag{
+								Name:        "lag-c",
+								Usage:       "Critical value for the lag in seconds between the newest appended and the newest sent sample of every queue. Use nagios-plugin syntax here.",
+								Destination: &flags.remoteWrite.LagCritical,
+							},
+							&cli.StringFlag{
+								Name:        "pending-w",
+								Usage:       "Warning value for the pending samples of every queue. Use nagios-plugin syntax here.",
+								Destination: &flags.remoteWrite.PendingWarning,
+							},
+							&cli.StringFlag{
+								Name:        "pending-c",
+								Usage:       "Critical value for the pending samples of every queue. Use nagios-plugin syntax here.",
+								Destination: &flags.remoteWrite.PendingCritical,
+							},
+							&cli.StringFlag{
+								Name:        "failed-w",
+								Usage:       "Warning value for the failed samples per second of every queue. Use nagios-plugin syntax here.",
+								Destination: &flags.remoteWrite.FailedWarning,
+							},
+							&cli.StringFlag{
+								Name:        "failed-c",
+								Usage:       "Critical value for the failed samples per second of every queue. Use nagios-plugin syntax here.",
+								Destination: &flags.remoteWrite.FailedCritical,
+							},
+							&cli.StringFlag{
+								Name:        "retried-w",
+								Usage:       "Warning value for the retried samples per second of every queue. Use nagios-plugin syntax here.",
+								Destination: &flags.remoteWrite.RetriedWarning,
+							},
+							&cli.StringFlag{
+								Name:        "retried-c",
+								Usage:       "Critical value for the retried samples per second of every queue. Use nagios-plugin syntax here.",
+								Destination: &flags.remoteWrite.RetriedCritical,
+							},
+							&cli.StringFlag{
+								Name:        "shards-w",
+								Usage:       "Warning value for the number of shards of every queue. Use nagios-plugin syntax here.",
+								Destination: &flags.remoteWrite.ShardsWarning,
+							},
+							&cli.StringFlag{
+								Name:        "shards-c",
+								Usage:       "Critical value for the number of shards of every queue. Use nagios-plugin syntax here.",
+								Destination: &flags.remoteWrite.ShardsCritical,
+							},
+							newInsecureFlag(),
+							newCookieFlag(),
+							&cli.StringFlag{
+								Name:        "state-file",
+								Usage:       "File to keep the counters for the rate calculation between two runs. Defaults to a file per address in check_prometheus of the cache directory of the user, e.g. ~/.cache/check_prometheus.",
+								Destination: &flags.stateFile,
+							},
+						},
+					},
+
+					{
+						Name:     "scrape",
+						HideHelp: false,
+						Usage:    "Checks the metrics endpoint of an exporter directly, without a prometheus server",
+						Description: `Fetches the text exposition or OpenMetrics format of an exporter and checks the selected samples like the query mode does with a vector result.
+									Rates are calculated against the values of the last run, which are kept in the state file. The first run returns unknown.
+									Examples:
+										Filesystems running full:
+											check_prometheus m scrape --address http://host:9100 --metric node_filesystem_avail_bytes --match 'fstype!~tmpfs|overlay' --divide-by node_filesystem_size_bytes -w 0.2: -c 0.1:
+										Network errors per second of all interfaces:
+											check_prometheus m scrape --address http://host:9100 --metric node_network_receive_errs_total --rate --sum -c 10
+									`,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							var ctxScrape context.Context
+							var ctxScrapeCancel context.CancelFunc
+							if flags.timeout == 0 {
+								ctxScrape = context.WithoutCancel(ctx)
+							} else {
+								ctxScrape, ctxScrapeCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
+								defer ctxScrapeCancel()
+							}
+
+							flags.outputTemplates.Alias = flags.alias
+							state, msg, err = mode.Scrape(ctxScrape, flags.address, flags.metricsPath, &flags.scrapeExpression, flags.warning, flags.critical, flags.outputTemplates, flags.search, flags.replace, flags.perfdataOptions.MaxLabelLength, flags.emptyQueryMessage, flags.emptyQueryStatus, flags.stateFile, &collection)
+							return err
+						},
+						Flags: append([]cli.Flag{
+							&cli.StringFlag{
+								Name:  "address",
+								Usage: "Exporter address: Protocol + IP + Port.",
+								Value: "http://localhost:9100",
+								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+									url, err := url.Parse(value)
+									flags.address = url
+									return err
+								},
+								Validator: func(value string) error {
+									_, err := url.Parse(value)
+									return err
+								},
+								ValidateDefaults: true,
+							},
+							&cli.StringFlag{
+								Name:        "metrics-path",
+								Usage:       "Path of the metrics endpoint.",
+								Value:       mode.DefaultMetricsPath,
+								Destination: &flags.metricsPath,
+							},
+							&cli.StringFlag{
+								Name:        "metric",
+								Usage:       "Name of the metric to check.",
+								Destination: &flags.scrapeExpression.Metric,
+								Required:    true,
+							},
+							&cli.StringSliceFlag{
+								Name:        "match",
+								Usage:       "Only check samples matching this label matcher, e.g. 'device=~sd.*'. Can be given multiple times.",
+								Destination: &flags.scrapeExpression.Matchers,
+							},
+							&cli.BoolFlag{
+								Name:        "rate",
+								Usage:       "Check the per second rate of the counters since the last run.",
+								Destination: &flags.scrapeExpression.Rate,
+							},
+							&cli.StringFlag{
+								Name:        "divide-by",
+								Usage:       "Metric the values are divided by, samples with the same labels are divided.",
+								Destination: &flags.scrapeExpression.DivideBy,
+							},
+							&cli.StringSliceFlag{
+								Name:        "divide-by-match",
+								Usage:       "Label matcher for the divide-by metric. Can be given multiple times.",
+								Destination: &flags.scrapeExpression.DivideByMatchers,
+							},
+							&cli.BoolFlag{
+								Name:        "sum",
+								Usage:       "Sum all samples up and check a single value. Together with divide-by the sums are divided.",
+								Destination: &flags.scrapeExpression.Sum,
+							},
+							&cli.StringFlag{
+								Name:        "a",
+								Usage:       "Alias, will replace the expression within the output, if set. You can use go text/template syntax to output label values.",
+								Destination: &flags.alias,
+							},
+							&cli.StringFlag{
+								Name:        "w",
+								Usage:       "Warning value. Use nagios-plugin syntax here.",
+								Destination: &flags.warning,
+							},
+							&cli.StringFlag{
+								Name:        "c",
+								Usage:       "Critical value. Use nagios-plugin syntax here.",
+								Destination: &flags.critical,
+							},
+							&cli.StringFlag{
+								Name:        "search",
+								Usage:       "If this variable is set, the given Golang regex will be used to search and replace the result with the 'replace' flag content. This will be appied on the perflabels.",
+								Destination: &flags.search,
+							},
+							&cli.StringFlag{
+								Name:        "replace",
+								Usage:       "See search flag. If the 'search' flag is empty this flag will be ignored.",
+								Destination: &flags.replace,
+							},
+							&cli.IntFlag{
+								Name:        "perfdata-label-length",
+								Usage:       "Truncates the perfdata labels to this length. 0 keeps their length.",
+								Destination: &flags.perfdataOptions.MaxLabelLength,
+							},
+							&cli.StringFlag{
+								Name:        "eqm",
+								Usage:       "Message if the expression returns no data.",
+								Destination: &flags.emptyQueryMessage,
+							},
+							&cli.StringFlag{
+								Name:        "eqs",
+								Usage:       "Status if the expression returns no data.",
+								Destination: &flags.emptyQueryStatusArg,
+								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+									flags.emptyQueryStatus = check_x.StateFromString(value)
+									return nil
+								},
+							},
+							&cli.StringFlag{
+								Name:        "state-file",
+								Usage:       "File to keep the counters for the rate calculation between two runs. Defaults to a file per address and expression in check_prometheus of the cache directory of the user, e.g. ~/.cache/check_prometheus.",
+								Destination: &flags.stateFile,
+							},
+							newInsecureFlag(),
+							newCookieFlag(),
+						}, newTemplateFlags(&flags.outputTemplates)...),
+					},
+
+					{
+						Name:     "thanos_stores",
+						HideHelp: false,
+						Usage:    "Checks the stores of a Thanos querier",
+						Description: `Fetches the stores the querier fans out to, like sidecars, store gateways, rulers and receivers. A store with an error returns the --unhealthy-state.
+									Sidecars whose newest sample is older than --max-lag and a time range covered by the healthy stores shorter than --min-coverage are WARNING.
+									Examples:
+										Two healthy sidecars and one store gateway covering at least 30 days:
+											check_prometheus m thanos_stores --address http://thanos-query:9090 --min-stores sidecar=2 --min-stores store=1 --min-coverage 720h
+										Sidecars lagging more than 5 minutes:
+											check_prometheus m thanos_stores --address http://thanos-query:9090 --max-lag 5m
+									`,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							var ctxThanosStores context.Context
+							var ctxThanosStoresCancel context.CancelFunc
+							if flags.timeout == 0 {
+								ctxThanosStores = context.WithoutCancel(ctx)
+							} else {
+								ctxThanosStores, ctxThanosStoresCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
+								defer ctxThanosStoresCancel()
+							}
+
+							unhealthyState := check_x.StateFromString(flags.unhealthyStateArg)
+							state, msg, err = mode.ThanosStores(ctxThanosStores, flags.address, flags.minTargets, flags.maxLag, flags.minCoverage, unhealthyState, &collection)
+							return err
+						},
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "address",
+								Usage: "Thanos querier address: Protocol + IP + Port.",
+								Value: "http://localhost:9100",
+								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+									url, err := url.Parse(value)
+									flags.address = url
+									return err
+								},
+								Validator: func(value string) error {
+									_, err := url.Parse(value)
+									return err
+								},
+								ValidateDefaults: true,
+							},
+							&cli.StringSliceFlag{
+								Name:        "min-stores",
+								Usage:       "Minimum number of healthy stores, 'N' for every store type or 'type=N' for a type like sidecar or store. Can be given multiple times.",
+								Destination: &flags.minTargets,
+							},
+							&cli.DurationFlag{
+								Name:        "max-lag",
+								Usage:       "Sidecars whose newest sample is older than this are WARNING, 0 to disable.",
+								Destination: &flags.maxLag,
+							},
+							&cli.DurationFlag{
+								Name:        "min-coverage",
+								Usage:       "Time range back from now the healthy stores have to cover, e.g. '720h'. 0 to disable.",
+								Destination: &flags.minCoverage,
+							},
+							&cli.StringFlag{
+								Name:        "unhealthy-state",
+								Usage:       "Status if a store has an error.",
+								Value:       "critical",
+								Destination: &flags.unhealthyStateArg,
+							},
+							newInsecureFlag(),
+							newCookieFlag(),
+						},
+					},
+
+					{
+						Name:     "thanos_compactor",
+						HideHelp: false,
+						Usage:    "Checks if a Thanos compactor is halted",
+						Description: `Scrapes the metrics endpoint of the compactor, a halted compactor is critical. The planned compactions, downsamplings and deletions are added as perfdata.
+									The warning and critical thresholds are applied on the number of planned compactions.
+									Examples:
+										Halted compactor or more than 100 planned compactions:
+											check_prometheus m thanos_compactor --address http://thanos-compact:10902 -c 100
+									`,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							var ctxThanosCompactor context.Context
+							var ctxThanosCompactorCancel context.CancelFunc
+							if flags.timeout == 0 {
+								ctxThanosCompactor = context.WithoutCancel(ctx)
+							} else {
+								ctxThanosCompactor, ctxThanosCompactorCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
+								defer ctxThanosCompactorCancel()
+							}
+
+							state, msg, err = mode.ThanosCompactor(ctxThanosCompactor, flags.address, flags.metricsPath, flags.warning, flags.critical, &collection)
+							return err
+						},
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "address",
+								Usage: "Thanos compactor address: Protocol + IP + Port.",
+								Value: "http://localhost:9100",
+								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+									url, err := url.Parse(value)
+									flags.address = url
+									return err
+								},
+								Validator: func(value string) error {
+									_, err := url.Parse(value)
+									return err
+								},
+								ValidateDefaults: true,
+							},
+							&cli.StringFlag{
+								Name:        "metrics-path",
+								Usage:       "Path of the metrics endpoint.",
+								Value:       mode.DefaultMetricsPath,
+								Destination: &flags.metricsPath,
+							},
+							&cli.StringFlag{
+								Name:        "w",
+								Usage:       "Warning value for the number of planned compactions. Use nagios-plugin syntax here.",
+								Destination: &flags.warning,
+							},
+							&cli.StringFlag{
+								Name:        "c",
+								Usage:       "Critical value for the number of planned compactions. Use nagios-plugin syntax here.",
+								Destination: &flags.critical,
+							},
+							newInsecureFlag(),
+							newCookieFlag(),
+						},
+					},
+
+					{
+						Name:        "mimir_ready",
+						HideHelp:    false,
+						Usage:       "Checks if a Mimir component is ready",
+						Description: `Every other status code of the /ready endpoint than 200 is critical, the body tells what the component is waiting for. Use --header to send the X-Scope-OrgID tenant header if required.`,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							var ctxMimirReady context.Context
+							var ctxMimirReadyCancel context.CancelFunc
+							if flags.timeout == 0 {
+								ctxMimirReady = context.WithoutCancel(ctx)
+							} else {
+								ctxMimirReady, ctxMimirReadyCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
+								defer ctxMimirReadyCancel()
+							}
+
+							state, msg, err = mode.MimirReady(ctxMimirReady, flags.address, &collection)
+							return err
+						},
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "address",
+								Usage: "Mimir component address: Protocol + IP + Port.",
+								Value: "http://localhost:9100",
+								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+									url, err := url.Parse(value)
+									flags.address = url
+									return err
+								},
+								Validator: func(value string) error {
+									_, err := url.Parse(value)
+									return err
+								},
+								ValidateDefaults: true,
+							},
+							newInsecureFlag(),
+							newCookieFlag(),
+						},
+					},
+
+					{
+						Name:     "mimir_ring",
+						HideHelp: false,
+						Usage:    "Checks the members of a Mimir hash ring",
+						Description: `Fetches the ring status page as json, members which are not ACTIVE or whose last heartbeat is older than --heartbeat-timeout are unhealthy.
+									The warning and critical thresholds are applied on the number of unhealthy members, they are listed in the long output.
+									Examples:
+										Ingester ring, critical if more than one ingester is unhealthy:
+											check_prometheus m mimir_ring --address http://mimir-distributor:8080 -w 0 -c 1
+										Ring of the store gateways:
+											check_prometheus m mimir_ring --address http://mimir-store-gateway:8080 --ring-path /store-gateway/ring -c 0
+									`,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							var ctxMimirRing context.Context
+							var ctxMimirRingCancel context.CancelFunc
+							if flags.timeout == 0 {
+								ctxMimirRing = context.WithoutCancel(ctx)
+							} else {
+								ctxMimirRing, ctxMimirRingCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
+								defer ctxMimirRingCancel()
+							}
+
+							state, msg, err = mode.MimirRing(ctxMimirRing, flags.address, flags.ringPath, flags.heartbeatTimeout, flags.warning, flags.critical, &collection)
+							return err
+						},
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "address",
+								Usage: "Mimir component address: Protocol + IP + Port.",
+								Value: "http://localhost:9100",
+								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+									url, err := url.Parse(value)
+									flags.address = url
+									return err
+								},
+								Validator: func(value string) error {
+									_, err := url.Parse(value)
+									return err
+								},
+								ValidateDefaults: true,
+							},
+							&cli.StringFlag{
+								Name:        "ring-path",
+								Usage:       "Path of the ring status page.",
+								Value:       mode.DefaultRingPath,
+								Destination: &flags.ringPath,
+							},
+							&cli.DurationFlag{
+								Name:        "heartbeat-timeout",
+								Usage:       "Members whose last heartbeat is older than this are unhealthy, 0 to disable.",
+								Value:       time.Minute,
+								Destination: &flags.heartbeatTimeout,
+							},
+							&cli.StringFlag{
+								Name:        "w",
+								Usage:       "Warning value for the number of unhealthy members. Use nagios-plugin syntax here.",
+								Destination: &flags.warning,
+							},
+							&cli.StringFlag{
+								Name:        "c",
+								Usage:       "Critical value for the number of unhealthy members. Use nagios-plugin syntax here.",
+								Destination: &flags.critical,
+							},
+							newInsecureFlag(),
+							newCookieFlag(),
+						},
+					},
+
+					{
+						Name:     "mimir_buildinfo",
+						HideHelp: false,
+						Usage:    "Returns the version of Mimir",
+						Description: `Reads the build information of the prometheus api, the address has to include the prefix of the api, /prometheus by default.
+									A version not matching --version is critical.
+									Examples:
+										Only 2.x versions:
+											check_prometheus m mimir_buildinfo --address http://mimir:8080/prometheus --version '^2\.'
+									`,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							var ctxMimirBuildInfo context.Context
+							var ctxMimirBuildInfoCancel context.CancelFunc
+							if flags.timeout == 0 {
+								ctxMimirBuildInfo = context.WithoutCancel(ctx)
+							} else {
+								ctxMimirBuildInfo, ctxMimirBuildInfoCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
+								defer ctxMimirBuildInfoCancel()
+							}
+
+							state, msg, err = mode.MimirBuildInfo(ctxMimirBuildInfo, flags.address, flags.versionRegex, &collection)
+							return err
+						},
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "address",
+								Usage: "Mimir address including the api prefix: Protocol + IP + Port + Prefix.",
+								Value: "http://localhost:9100",
+								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+									url, err := url.Parse(value)
+									flags.address = url
+									return err
+								},
+								Validator: func(value string) error {
+									_, err := url.Parse(value)
+									return err
+								},
+								ValidateDefaults: true,
+							},
+							&cli.StringFlag{
+								Name:        "version",
+								Usage:       "Golang regex the version has to match.",
+								Destination: &flags.versionRegex,
+							},
+							newInsecureFlag(),
+							newCookieFlag(),
+						},
+					},
+
+					{
+						Name:     "pushgateway",
+						HideHelp: false,
+						Usage:    "Checks the push times of the jobs pushing to a pushgateway",
+						Description: `Reads all push groups, identified by the job and the grouping labels, and checks their push_time_seconds against the maximum age of their job.
+									A group whose last push is older returns the --stale-state, a group whose push_failure_time_seconds is newer than the last successful push the --failure-state.
+									Every job given by --job or --max-age has to have at least one push group. All groups are listed in the long output.
+									Examples:
+										Every job has to push at least once per hour, the nightly backup once per day:
+											check_prometheus m pushgateway --address http://pushgateway:9091 --max-age 1h --max-age backup=26h
+										--> CRITICAL - 3 push groups of 2 jobs, 1 stale, 0 failed
+										[CRITICAL] {instance="db1", job="backup"} last push 30h0m0s ago, max age 26h0m0s
+										[OK] {instance="db2", job="backup"} last push 2h0m0s ago
+										[OK] {job="cleanup"} last push 10m0s ago|'backup_age'=108000s;;93600;0; 'cleanup_age'=600s;;3600;0; ...
+									`,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							var ctxPushgateway context.Context
+							var ctxPushgatewayCancel context.CancelFunc
+							if flags.timeout == 0 {
+								ctxPushgateway = context.WithoutCancel(ctx)
+							} else {
+								ctxPushgateway, ctxPushgatewayCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
+								defer ctxPushgatewayCancel()
+							}
+
+							staleState := check_x.StateFromString(flags.staleStateArg)
+							failureState := check_x.StateFromString(flags.failureStateArg)
+							state, msg, err = mode.Pushgateway(ctxPushgateway, flags.address, flags.jobs, flags.maxAges, staleState, failureState, &collection)
+							return err
+						},
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "address",
+								Usage: "Pushgateway address: Protocol + IP + Port.",
+								Value: "http://localhost:9091",
+								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+									url, err := url.Parse(value)
+									flags.address = url
+									return err
+								},
+								Validator: func(value string) error {
+									_, err := url.Parse(value)
+									return err
+								},
+								ValidateDefaults: true,
+							},
+							&cli.StringSliceFlag{
+								Name:        "job",
+								Usage:       "Only check the push groups of this job, can be given multiple times. By default all jobs are checked.",
+								Destination: &flags.jobs,
+							},
+							&cli.StringSliceFlag{
+								Name:        "max-age",
+								Usage:       "Maximum age of the last push, 'duration' for every job or 'job=duration' for a single job, e.g. '26h' or '1d'. Can be given multiple times.",
+								Destination: &flags.maxAges,
+							},
+							&cli.StringFlag{
+								Name:        "stale-state",
+								Usage:       "Status if the last push of a group is older than the maximum age or a job has no push group.",
+								Value:       "critical",
+								Destination: &flags.staleStateArg,
+							},
+							&cli.StringFlag{
+								Name:        "failure-state",
+								Usage:       "Status if the last push of a group failed.",
+								Value:       "critical",
+								Destination: &flags.failureStateArg,
+							},
+							newInsecureFlag(),
+							newCookieFlag(),
+						},
+					},
+
+					{
+						Name:     "probe",
+						HideHelp: false,
+						Usage:    "Checks a blackbox exporter probe of a target",
+						Description: `Reads the probe_* series prometheus stored for the target, or calls the /probe endpoint of the blackbox exporter directly with --direct.
+									A failed probe is critical. The total duration, the duration of every phase, the http status code and the days until the certificate expires are added as perfdata and checked by their thresholds.
+									Without --direct the target is selected by the instance label, use --match if several jobs probe the same target.
+									Examples:
+										Stored probe of a website, warning above 1s and if the certificate expires within 30 days:
+											check_prometheus m probe --address http://prometheus:9090 --target https://example.com -w 1 --cert-w 30: --cert-c 7:
+										--> OK - Probe of https://example.com succeeded after 0.234s, status 200, certificate expires in 45 days
+										[OK] dns: 0.004s
+										[OK] connect: 0.012s
+										[OK] tls: 0.051s
+										[OK] processing: 0.160s
+										[OK] transfer: 0.002s|'success'=1;;;0;1 'duration'=0.234s;1;;0; ...
+
+										Probe directly by the blackbox exporter:
+											check_prometheus m probe --address http://blackbox:9115 --direct --module http_2xx --target https://example.com --processing-c 2
+									`,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							var ctxProbe context.Context
+							var ctxProbeCancel context.CancelFunc
+							if flags.timeout == 0 {
+								ctxProbe = context.WithoutCancel(ctx)
+							} else {
+								ctxProbe, ctxProbeCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
+								defer ctxProbeCancel()
+							}
+
+							state, msg, err = mode.Probe(ctxProbe, flags.address, flags.probeTarget, flags.probeModule, flags.probeDirect, flags.matchers, flags.probeThresholds, &collection)
+							return err
+						},
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "address",
+								Usage: "Prometheus address, or blackbox exporter address with --direct: Protocol + IP + Port.",
+								Value: "http://localhost:9100",
+								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+									url, err := url.Parse(value)
+									flags.address = url
+									return err
+								},
+								Validator: func(value string) error {
+									_, err := url.Parse(value)
+									return err
+								},
+								ValidateDefaults: true,
+							},
+							&cli.StringFlag{
+								Name:        "target",
+								Usage:       "Target of the probe, the instance label of the stored series.",
+								Destination: &flags.probeTarget,
+								Required:    true,
+							},
+							&cli.BoolFlag{
+								Name:        "direct",
+								Usage:       "Call the /probe endpoint of the blackbox exporter at the address instead of reading the stored series.",
+								Destination: &flags.probeDirect,
+							},
+							&cli.StringFlag{
+								Name:        "module",
+								Usage:       "Module of the blackbox exporter for --direct probes.",
+								Value:       mode.DefaultProbeModule,
+								Destination: &flags.probeModule,
+							},
+							&cli.StringSliceFlag{
+								Name:        "match",
+								Usage:       "Label matcher selecting the stored probe, e.g. 'job=blackbox-http'. Can be given multiple times.",
+								Destination: &flags.matchers,
+							},
+							&cli.StringFlag{
+								Name:        "w",
+								Usage:       "Warning value for the total duration of the probe in seconds. Use nagios-plugin syntax here.",
+								Destination: &flags.probeThresholds.DurationWarning,
+							},
+							&cli.StringFlag{
+								Name:        "c",
+								Usage:       "Critical value for the total duration of the probe in seconds. Use nagios-plugin syntax here.",
+								Destination: &flags.probeThresholds.DurationCritical,
+							},
+							&cli.StringFlag{
+								Name:        "dns-w",
+								Usage:       "Warning value for the duration of the DNS lookup in seconds. Use nagios-plugin syntax here.",
+								Destination: &flags.probeThresholds.DNSWarning,
+							},
+							&cli.StringFlag{
+								Name:        "dns-c",
+								Usage:       "Critical value for the duration of the DNS lookup in seconds. Use nagios-plugin syntax here.",
+								Destination: &flags.probeThresholds.DNSCritical,
+							},
+							&cli.StringFlag{
+								Name:        "connect-w",
+								Usage:       "Warning value for the duration of connecting in seconds. Use nagios-plugin syntax here.",
+								Destination: &flags.probeThresholds.ConnectWarning,
+							},
+							&cli.StringFlag{
+								Name:        "connect-c",
+								Usage:       "Critical value for the duration of connecting in seconds. Use nagios-plugin syntax here.",
+								Destination: &flags.probeThresholds.ConnectCritical,
+							},
+							&cli.StringFlag{
+								Name:        "tls-w",
+								Usage:       "Warning value for the duration of the TLS handshake in seconds. Use nagios-plugin syntax here.",
+								Destination: &flags.probeThresholds.TLSWarning,
+							},
+							&cli.StringFlag{
+								Name:        "tls-c",
+								Usage:       "Critical value for the duration of the TLS handshake in seconds. Use nagios-plugin syntax here.",
+								Destination: &flags.probeThresholds.TLSCritical,
+							},
+							&cli.StringFlag{
+								Name:        "processing-w",
+								Usage:       "Warning value for the duration of the processing until the first byte of the response in seconds. Use nagios-plugin syntax here.",
+								Destination: &flags.probeThresholds.ProcessingWarning,
+							},
+							&cli.StringFlag{
+								Name:        "processing-c",
+								Usage:       "Critical value for the duration of the processing until the first byte of the response in seconds. Use nagios-plugin syntax here.",
+								Destination: &flags.probeThresholds.ProcessingCritical,
+							},
+							&cli.StringFlag{
+								Name:        "transfer-w",
+								Usage:       "Warning value for the duration of the transfer of the response in seconds. Use nagios-plugin syntax here.",
+								Destination: &flags.probeThresholds.TransferWarning,
+							},
+							&cli.StringFlag{
+								Name:        "transfer-c",
+								Usage:       "Critical value for the duration of the transfer of the response in seconds. Use nagios-plugin syntax here.",
+								Destination: &flags.probeThresholds.TransferCritical,
+							},
+							&cli.StringFlag{
+								Name:        "status-w",
+								Usage:       "Warning value for the http status code, e.g. '200:399'. Use nagios-plugin syntax here.",
+								Destination: &flags.probeThresholds.StatusWarning,
+							},
+							&cli.StringFlag{
+								Name:        "status-c",
+								Usage:       "Critical value for the http status code, e.g. '200:399'. Use nagios-plugin syntax here.",
+								Destination: &flags.probeThresholds.StatusCritical,
+							},
+							&cli.StringFlag{
+								Name:        "cert-w",
+								Usage:       "Warning value for the days until the earliest certificate expires, e.g. '30:'. Use nagios-plugin syntax here.",
+								Destination: &flags.probeThresholds.CertWarning,
+							},
+							&cli.StringFlag{
+								Name:        "cert-c",
+								Usage:       "Critical value for the days until the earliest certificate expires, e.g. '7:'. Use nagios-plugin syntax here.",
+								Destination: &flags.probeThresholds.CertCritical,
+							},
+							newInsecureFlag(),
+							newCookieFlag(),
+						},
+					},
+
+					{
+						Name:     "certs",
+						HideHelp: false,
+						Usage:    "Checks the days until certificates expire",
+						Description: `Queries a metric whose value is the expiry time of a certificate in unix seconds and converts it into the whole days remaining per certificate.
+									By default probe_ssl_earliest_cert_expiry of the blackbox exporter and x509_cert_not_after of the x509-certificate-exporter are used.
+									The warning and critical thresholds are applied on the days of every certificate, the certificates expiring first are listed in the long output.
+									Examples:
+										Warning 30 days and critical 7 days before a certificate expires:
+											check_prometheus m certs -w 30: -c 7:
+										--> WARNING - 12 certificates, soonest expires in 21 days {instance="https://example.com", job="blackbox"}, 1 certificates expire soon
+										[WARNING] {instance="https://example.com", job="blackbox"} expires in 21 days
+										[OK] {issuer_CN="R3", subject_CN="api.example.com"} expires in 64 days
+										...
+										Certificates of a namespace out of an own metric, only listing the subject:
+											check_prometheus m certs --metric ssl_cert_not_after --match 'namespace=prod' --label subject -w 30: -c 7:
+									`,
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							var ctxCerts context.Context
+							var ctxCertsCancel context.CancelFunc
+							if flags.timeout == 0 {
+								ctxCerts = context.WithoutCancel(ctx)
+							} else {
+								ctxCerts, ctxCertsCancel = context.WithTimeout(ctx, time.Duration(flags.timeout)*time.Second)
+								defer ctxCertsCancel()
+							}
+
+							state, msg, err = mode.Certs(ctxCerts, flags.address, flags.metric, flags.matchers, flags.metricLabels, flags.warning, flags.critical, flags.maxExamples, &collection)
+							return err
+						},
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "address",
+								Usage: "Prometheus address: Protocol + IP + Port.",
+								Value: "http://localhost:9100",
+								Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+									url, err := url.Parse(value)
+									flags.address = url
+									return err
+								},
+								Validator: func(value string) error {
+									_, err := url.Parse(value)
+									return err
+								},
+								ValidateDefaults: true,
+							},
+							&cli.StringFlag{
+								Name:        "metric",
+								Usage:       "Metric with the expiry time in unix seconds, 'auto' for probe_ssl_earliest_cert_expiry and x509_cert_not_after.",
+								Value:       mode.CertsAuto,
+								Destination: &flags.metric,
+							},
+							&cli.StringSliceFlag{
+								Name:        "match",
+								Usage:       "Only check certificates matching this label matcher, e.g. 'secret_namespace=prod'. Can be given multiple times.",
+								Destination: &flags.matchers,
+							},
+							&cli.StringSliceFlag{
+								Name:        "label",
+								Usage:       "Label identifying a certificate in the output, like subject_CN or instance. Can be given multiple times, by default all labels are shown.",
+								Destination: &flags.metricLabels,
+							},
+							&cli.StringFlag{
+								Name:        "w",
+								Usage:       "Warning value for the days until every certificate expires, e.g. '30:'. Use nagios-plugin syntax here.",
+								Destination: &flags.warning,
+							},
+							&cli.StringFlag{
+								Name:        "c",
+								Usage:       "Critical value for the days until every certificate expires, e.g. '7:'. Use nagios-plugin syntax here.",
+								Destination: &flags.critical,
+							},
+							&cli.IntFlag{
+								Name:        "list",
+								Usage:       "Number of certificates expiring first which are listed in the long output, -1 for all.",
+								Value:       10,
+								Destination: &flags.maxExamples,
+							},
+							newInsecureFlag(),
+							newCookieFlag(),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// The debug file is opened by the --debug-file flag and only lives for this run
+	defer helper.CloseDebugFile()
+
+	// The helper settings added by flag actions only live for this run as well
+	helper.Headers = http.Header{}
+	helper.Cookies = nil
+	helper.InsecureSkipVerify = false
+
+	helper.ResetRequestTiming()
+	if err := cmd.Run(context.Background(), args); err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when executing cli action : %s", err.Error()), &collection, err
+	}
+
+	state, msg, err = evalRequestTiming(state, msg, &collection, flags.requestWarning, flags.requestCritical)
+
+	return state, msg, &collection, err
+}
+
+// evalRequestTiming adds the summed up duration of the requests of the mode as perfdata and checks it against the
+// request thresholds, without thresholds the output stays as it is
+func evalRequestTiming(state check_x.State, msg string, collection *check_x.PerformanceDataCollection, requestWarning, requestCritical string) (check_x.State, string, error) {
+	requests, duration := helper.RequestTiming()
+	if requests == 0 || (requestWarning == "" && requestCritical == "") {
+		return state, msg, nil
+	}
+
+	warnThreshold, err := check_x.NewThreshold(requestWarning)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error creating warningThreshold from '%s' : %s", requestWarning, err.Error()), err
+	}
+	critThreshold, err := check_x.NewThreshold(requestCritical)
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error creating critThreshold from '%s' : %s", requestCritical, err.Error()), err
+	}
+
+	collection.AddPerformanceDataFloat64("request_duration", duration.Seconds())
+	collection.Unit("request_duration", "s")
+	collection.Warn("request_duration", warnThreshold)
+	collection.Crit("request_duration", critThreshold)
+	collection.Min("request_duration", 0)
+	collection.AddPerformanceDataFloat64("requests", float64(requests))
+	collection.Min("requests", 0)
+
+	durationState := check_x.Evaluator{Warning: warnThreshold, Critical: critThreshold}.Evaluate(duration.Seconds())
+	if durationState.Code == check_x.OK.Code {
+		return state, msg, nil
+	}
+	worst, err := check_x.States{state, durationState}.GetWorst()
+	if err != nil {
+		return check_x.Unknown, fmt.Sprintf("Error when picking the worst state out of many states: %s", err.Error()), err
+	}
+	firstLine, longOutput, found := strings.Cut(msg, "\n")
+	firstLine += fmt.Sprintf(", %d requests took %s", requests, duration.Round(time.Millisecond))
+	if found {
+		firstLine += "\n" + longOutput
+	}
+
+	return *worst, firstLine, nil
+}
+
+// optionalState parses the state of a flag, unset flags return an empty state so the mode picks its default
+func optionalState(arg string) check_x.State {
+	if arg == "" {
+		return check_x.State{}
+	}
+
+	return check_x.StateFromString(arg)
+}
+
+// newInsecureFlag creates the flag to skip the TLS certificate verification, shared by all modes doing http requests
+func newInsecureFlag() *cli.BoolFlag {
+	return &cli.BoolFlag{
+		Name:        "insecure, k",
+		Usage:       "Skip TLS certificate verification (insecure)",
+		Destination: &helper.InsecureSkipVerify,
+	}
+}
+
+// newCookieFlag creates the flag to send a cookie with every request, shared by all modes doing http requests
+func newCookieFlag() *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:  "cookie",
+		Usage: "Cookie to send during the api request, in form '<name>=<value>' ",
+		Action: func(ctx context.Context, cmd *cli.Command, value string) error {
+			cookieKey := value[:strings.IndexRune(value, '=')]
+			cookieValue := value[strings.IndexRune(value, '=')+1:]
+			cookie := &http.Cookie{
+				Name:     cookieKey,
+				Value:    cookieValue,
+				Path:     "/",
+				SameSite: http.SameSiteLaxMode,
+				MaxAge:   3600,
+				Expires:  time.Now().Add(time.Hour),
+			}
+			helper.Cookies = append(helper.Cookies, cookie)
+			return nil
+		},
+		Validator: func(value string) error {
+			strings.Count(value, "=")
+			if strings.Count(value, "=") != 1 {
+				return fmt.Errorf("there should be exactly one '=' in the cookie definition")
+			}
+			cookieKey := value[:strings.IndexRune(value, '=')]
+			cookieValue := value[strings.IndexRune(value, '=')+1:]
+			if cookieKey == "" {
+				return fmt.Errorf("cookie key cannot be empty")
+			}
+			if cookieValue == "" {
+				return fmt.Errorf("cookie value cannot be empty")
+			}
+			if len(cookieValue) > 4096 {
+				return fmt.Errorf("cookie value cannot be longer than 4096 characters")
+			}
+
+			return nil
+		},
+	}
+}
+
+// newTemplateFlags creates the flags of the output templates, shared by the modes checking series
+func newTemplateFlags(templates *mode.OutputTemplates) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "summary",
+			Usage:       "Template of the first output line. Provides .Total, .OK, .Warning, .Critical, .Unknown, .Problems, .Worst and .Series, every series has .Labels, .Value, .State and .Alias.",
+			Destination: &templates.Summary,
+		},
+		&cli.StringFlag{
+			Name:        "ok-summary",
+			Usage:       "Template of the first output line if the result is OK, see --summary.",
+			Destination: &templates.OK,
+		},
+		&cli.StringFlag{
+			Name:        "warning-summary",
+			Usage:       "Template of the first output line if the result is WARNING, see --summary.",
+			Destination: &templates.Warning,
+		},
+		&cli.StringFlag{
+			Name:        "critical-summary",
+			Usage:       "Template of the first output line if the result is CRITICAL, see --summary.",
+			Destination: &templates.Critical,
+		},
+		&cli.StringFlag{
+			Name:        "unknown-summary",
+			Usage:       "Template of the first output line if the result is UNKNOWN, see --summary.",
+			Destination: &templates.Unknown,
+		},
+		&cli.StringFlag{
+			Name:        "series-template",
+			Usage:       "Template of a long output line per series, with the same labels and functions as the alias.",
+			Destination: &templates.Series,
+		},
+		&cli.BoolFlag{
+			Name:        "strict-templates",
+			Usage:       "Return UNKNOWN if a template fails, instead of showing the template as it is.",
+			Destination: &templates.Strict,
+		},
+	}
 }
@@ -6,11 +6,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
-	"github.com/consol-monitoring/check_prometheus/internal/helper"
+	"github.com/consol-monitoring/check_prometheus/pkg/prometheustest"
 	"github.com/consol-monitoring/check_x"
 )
 
@@ -22,33 +23,9 @@ func TestCheckMainWritesQueryOutputToStdout(t *testing.T) {
 		t.Fatalf("create stdout pipe: %v", err)
 	}
 	os.Stdout = w
-
-	oldTimestampFreshness := helper.TimestampFreshness
-	oldInsecureSkipVerify := helper.InsecureSkipVerify
-	oldCookies := helper.Cookies
-	oldVerbose := helper.Verbose
-
 	t.Cleanup(func() {
 		os.Stdout = oldStdout
 		r.Close()
-		helper.TimestampFreshness = oldTimestampFreshness
-		helper.InsecureSkipVerify = oldInsecureSkipVerify
-		helper.Cookies = oldCookies
-		helper.Verbose = oldVerbose
-		address = nil
-		timeout = 0
-		warning = ""
-		critical = ""
-		query = ""
-		queryDecoded = ""
-		queryEncoding = Raw
-		alias = ""
-		search = ""
-		replace = ""
-		label = ""
-		emptyQueryMessage = ""
-		emptyQueryStatusArg = ""
-		emptyQueryStatus = check_x.State{}
 	})
 
 	// Mock Prometheus' query API with a fixed vector result.
@@ -83,7 +60,158 @@ func TestCheckMainWritesQueryOutputToStdout(t *testing.T) {
 	if !strings.Contains(got, "OK - Query: 'up'|") {
 		t.Fatalf("stdout %q does not contain query output", got)
 	}
-	if !strings.Contains(got, "'{__name__=\"up\", job=\"prometheus\"}'=1") {
+	if !strings.Contains(got, "'{__name__:\"up\", job:\"prometheus\"}'=1") {
 		t.Fatalf("stdout %q does not contain perfdata output", got)
 	}
+	if strings.Contains(got, "'requests'=") {
+		t.Fatalf("stdout %q contains the request timing without request thresholds", got)
+	}
+}
+
+func TestCheckRequestTiming(t *testing.T) {
+	server := prometheustest.NewServer(t)
+	server.Handle(prometheustest.QueryPath, prometheustest.Response{Data: prometheustest.Vector{{Labels: map[string]string{"job": "node"}, Value: 1}}})
+
+	state, msg, collection, err := Check([]string{"check_prometheus", "--request-warning", "10", "m", "q", "--address", server.Server.URL, "-q", "up"})
+	if err != nil || state.Code != check_x.OK.Code {
+		t.Fatalf("state = %s, message = %q, err = %v", state.Name, msg, err)
+	}
+	if perfdata := collection.PrintAllPerformanceData(); !strings.Contains(perfdata, "'requests'=1;;;0;") || !strings.Contains(perfdata, "'request_duration'=") {
+		t.Errorf("perfdata %q does not contain the request timing", perfdata)
+	}
+
+	state, msg, _, _ = Check([]string{"check_prometheus", "--request-critical", "0", "m", "q", "--address", server.Server.URL, "-q", "up"})
+	if state.Code != check_x.Critical.Code || !strings.Contains(msg, "1 requests took") {
+		t.Errorf("state = %s, message = %q, want CRITICAL", state.Name, msg)
+	}
+}
+
+func TestCheckThanosParametersPerRun(t *testing.T) {
+	server := prometheustest.NewServer(t)
+	server.Handle(prometheustest.QueryPath, prometheustest.Response{Data: prometheustest.Vector{{Labels: map[string]string{"job": "node"}, Value: 1}}})
+
+	Check([]string{"check_prometheus", "m", "q", "--address", server.Server.URL, "-q", "up", "--dedup=false", "--partial-response"})
+	Check([]string{"check_prometheus", "m", "q", "--address", server.Server.URL, "-q", "up"})
+
+	requests := server.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	if requests[0].Form.Get("dedup") != "false" || requests[0].Form.Get("partial_response") != "true" {
+		t.Errorf("first run sent dedup=%q partial_response=%q", requests[0].Form.Get("dedup"), requests[0].Form.Get("partial_response"))
+	}
+	if requests[1].Form.Has("dedup") || requests[1].Form.Has("partial_response") {
+		t.Errorf("second run sent the parameters of the first run: %v", requests[1].Form)
+	}
+}
+
+func TestCheckRoundPerRun(t *testing.T) {
+	server := prometheustest.NewServer(t)
+	server.Handle(prometheustest.QueryPath, prometheustest.Response{Data: prometheustest.Vector{{Labels: map[string]string{"job": "node"}, Value: 1.26}}})
+
+	_, _, collection, _ := Check([]string{"check_prometheus", "m", "q", "--address", server.Server.URL, "-q", "up", "--round", "1"})
+	if perfdata := collection.PrintAllPerformanceData(); !strings.Contains(perfdata, `'{job:"node"}'=1.3;`) {
+		t.Errorf("rounded perfdata = %s", perfdata)
+	}
+	_, _, collection, _ = Check([]string{"check_prometheus", "m", "q", "--address", server.Server.URL, "-q", "up"})
+	if perfdata := collection.PrintAllPerformanceData(); !strings.Contains(perfdata, `'{job:"node"}'=1.26;`) {
+		t.Errorf("second run without --round = %s", perfdata)
+	}
+}
+
+func TestCheckFlagsPerRun(t *testing.T) {
+	server := prometheustest.NewServer(t)
+	server.Handle(prometheustest.QueryPath, prometheustest.Response{Data: prometheustest.Vector{}})
+
+	state, _, _, _ := Check([]string{"check_prometheus", "--header", "X-Scope-OrgID: tenant", "m", "q", "--address", server.Server.URL, "-q", "up", "--eqs", "critical", "--cookie", "session=1"})
+	if state.Code != check_x.Critical.Code {
+		t.Errorf("first run state = %s, want CRITICAL", state.Name)
+	}
+	state, _, _, _ = Check([]string{"check_prometheus", "m", "q", "--address", server.Server.URL, "-q", "up"})
+	if state.Code != check_x.Unknown.Code {
+		t.Errorf("second run state = %s, want the default UNKNOWN of an empty result", state.Name)
+	}
+
+	requests := server.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	if requests[0].Header.Get("X-Scope-OrgID") != "tenant" || requests[0].Header.Get("Cookie") == "" {
+		t.Errorf("first run headers = %v", requests[0].Header)
+	}
+	if requests[1].Header.Get("X-Scope-OrgID") != "" || requests[1].Header.Get("Cookie") != "" {
+		t.Errorf("second run sent the headers of the first run: %v", requests[1].Header)
+	}
+}
+
+func TestCheckReplayWithDefaultFlags(t *testing.T) {
+	// The recorded samples are older than the default --data-age, nothing listens on the address
+	replayDir := filepath.Join("..", "..", "internal", "mode", "testdata", "replay")
+	state, msg, _, err := Check([]string{"check_prometheus", "--replay", replayDir, "m", "q", "--address", "http://prometheus.invalid:9090", "-q", "up"})
+	if err != nil || state.Code == check_x.Unknown.Code || !strings.HasPrefix(msg, "Query: 'up'") {
+		t.Errorf("state = %s, message = %q, err = %v", state.Name, msg, err)
+	}
+
+	// The next run checks the freshness again
+	server := prometheustest.NewServer(t)
+	server.Handle(prometheustest.QueryPath, prometheustest.Response{Data: prometheustest.Vector{{Labels: map[string]string{"job": "node"}, Value: 1, Timestamp: time.Now().Add(-time.Hour)}}})
+	state, msg, _, _ = Check([]string{"check_prometheus", "m", "q", "--address", server.Server.URL, "-q", "up"})
+	if state.Code != check_x.Unknown.Code || !strings.Contains(msg, "freshness") {
+		t.Errorf("state = %s, message = %q, want UNKNOWN for old data", state.Name, msg)
+	}
+}
+
+func TestCheckDataAgeChecksSeries(t *testing.T) {
+	labels := map[string]string{"__name__": "up", "job": "node"}
+	server := prometheustest.NewServer(t)
+	server.HandleQuery("up", prometheustest.Response{Data: prometheustest.Vector{{Labels: labels, Value: 1}}})
+	server.HandleQuery("up[10m]", prometheustest.Response{Data: prometheustest.Matrix{{Labels: labels, Points: []prometheustest.Point{{Timestamp: time.Now().Add(-8 * time.Minute), Value: 1}}}}})
+
+	// The default --data-age doesn't look up the series
+	state, _, _, _ := Check([]string{"check_prometheus", "m", "q", "--address", server.Server.URL, "-q", "up"})
+	if requests := server.Requests(); state.Code != check_x.OK.Code || len(requests) != 1 {
+		t.Errorf("state = %s, %d requests, want OK without lookup", state.Name, len(requests))
+	}
+
+	state, msg, _, _ := Check([]string{"check_prometheus", "--data-age", "300", "m", "q", "--address", server.Server.URL, "-q", "up"})
+	if state.Code != check_x.Unknown.Code || !strings.Contains(msg, `[UNKNOWN] {__name__="up", job="node"} last sample is 8m0s old`) {
+		t.Errorf("state = %s, message = %q, want the stale series", state.Name, msg)
+	}
+}
+
+func TestCheckCookieOfEveryMode(t *testing.T) {
+	cookies := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case cookies <- r.Header.Get("Cookie"):
+		default:
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(server.Close)
+
+	tests := [][]string{
+		{"targets_health"},
+		{"dropped_targets"},
+		{"metric", "--metric", "up"},
+		{"histogram", "--metric", "http_request_duration_seconds"},
+		{"slo", "--errors", "http_requests_errors_total", "--total", "http_requests_total", "--objective", "99.9"},
+		{"remote_write", "--state-file", filepath.Join(t.TempDir(), "state.json")},
+	}
+	for _, tt := range tests {
+		args := append([]string{"check_prometheus", "m"}, tt...)
+		args = append(args, "--address", server.URL, "--insecure", "--cookie", "session=1")
+		_, msg, _, _ := Check(args)
+		select {
+		case cookie := <-cookies:
+			if cookie != "session=1" {
+				t.Errorf("mode %s sent cookie %q", tt[0], cookie)
+			}
+		default:
+			t.Errorf("mode %s sent no request: %s", tt[0], msg)
+		}
+		for len(cookies) > 0 {
+			<-cookies
+		}
+	}
 }
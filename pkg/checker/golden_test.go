@@ -0,0 +1,131 @@
+package checker
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/consol-monitoring/check_prometheus/pkg/prometheustest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the end to end tests with the current output")
+
+// goldenDurations matches the perfdata of measured durations, which differ on every run
+var goldenDurations = regexp.MustCompile(`'(request_duration|duration)'=[^;]*`)
+
+// goldenResponse is a response of the fake prometheus in a case file, samples of a vector without timestamp are
+// answered with the current time
+type goldenResponse struct {
+	Vector    prometheustest.Vector `json:"vector"`
+	Data      json.RawMessage       `json:"data"`
+	Body      string                `json:"body"`
+	Status    int                   `json:"status"`
+	ErrorType string                `json:"errorType"`
+	Error     string                `json:"error"`
+}
+
+func (g goldenResponse) response() prometheustest.Response {
+	response := prometheustest.Response{Body: g.Body, StatusCode: g.Status, ErrorType: g.ErrorType, Error: g.Error}
+	if g.Vector != nil {
+		response.Data = g.Vector
+	} else if g.Data != nil {
+		response.Data = g.Data
+	}
+
+	return response
+}
+
+// goldenCase contains the arguments of a check, $ADDRESS is replaced with the address of the fake prometheus, and
+// the responses by path and by query
+type goldenCase struct {
+	Args      []string                  `json:"args"`
+	Responses map[string]goldenResponse `json:"responses"`
+	Queries   map[string]goldenResponse `json:"queries"`
+}
+
+// goldenOutput is the exit code and the stdout of a check, only the values of measured durations are masked as they
+// differ on every run
+func goldenOutput(code int, stdout string) string {
+	return fmt.Sprintf("exit code: %d\n--- stdout\n%s", code, goldenDurations.ReplaceAllString(stdout, "'$1'=<duration>"))
+}
+
+// runCheckMain runs the check like the binary does and returns its exit code and what it wrote to stdout
+func runCheckMain(t *testing.T, args []string) (int, string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("create stdout pipe: %s", err)
+	}
+	oldStdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = oldStdout }()
+
+	output := make(chan []byte)
+	go func() {
+		content, _ := io.ReadAll(r)
+		r.Close()
+		output <- content
+	}()
+	code := CheckMain(args)
+	w.Close()
+
+	return code, string(<-output)
+}
+
+// TestGolden runs the checks of testdata/golden/*.json against a fake prometheus and compares the exit code and the
+// stdout with the .golden files. Run with -update to rewrite them.
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "golden", "*.json"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no golden test cases found: %v", err)
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		t.Run(name, func(t *testing.T) {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("read case: %s", err)
+			}
+			var goldenCase goldenCase
+			if err := json.Unmarshal(content, &goldenCase); err != nil {
+				t.Fatalf("parse case: %s", err)
+			}
+
+			server := prometheustest.NewServer(t)
+			for path, response := range goldenCase.Responses {
+				server.Handle(path, response.response())
+			}
+			for query, response := range goldenCase.Queries {
+				server.HandleQuery(query, response.response())
+			}
+			args := []string{"check_prometheus"}
+			for _, arg := range goldenCase.Args {
+				args = append(args, strings.ReplaceAll(arg, "$ADDRESS", server.Server.URL))
+			}
+
+			got := goldenOutput(runCheckMain(t, args))
+
+			goldenFile := strings.TrimSuffix(file, ".json") + ".golden"
+			if *update {
+				if err := os.WriteFile(goldenFile, []byte(got), 0o644); err != nil {
+					t.Fatalf("write golden file: %s", err)
+				}
+				return
+			}
+			want, err := os.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatalf("read golden file, run with -update to create it: %s", err)
+			}
+			if got != string(want) {
+				t.Errorf("output of %s differs from %s, run with -update if intended\ngot:\n%s\nwant:\n%s", strings.Join(goldenCase.Args, " "), goldenFile, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package prometheustest
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Sample is a single value of a series, a zero Timestamp is replaced with the time of the response
+type Sample struct {
+	Labels    map[string]string
+	Value     float64
+	Timestamp time.Time
+}
+
+// Point is a value of a series at a time, a zero Timestamp is replaced with the time of the response
+type Point struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// Series is a series of a range query
+type Series struct {
+	Labels map[string]string
+	Points []Point
+}
+
+// Vector is the data of an instant query returning a vector
+type Vector []Sample
+
+// Matrix is the data of a range query
+type Matrix []Series
+
+// Scalar is the data of an instant query returning a scalar, evaluated at the time of the response
+type Scalar float64
+
+// apiValue formats a timestamp and value the way the api does
+func apiValue(timestamp time.Time, value float64) [2]any {
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	return [2]any{float64(timestamp.UnixMilli()) / 1000, strconv.FormatFloat(value, 'f', -1, 64)}
+}
+
+// apiLabels returns the labels of a series, never null
+func apiLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return map[string]string{}
+	}
+
+	return labels
+}
+
+// MarshalJSON formats the vector as query result
+func (v Vector) MarshalJSON() ([]byte, error) {
+	result := make([]map[string]any, 0, len(v))
+	for _, sample := range v {
+		result = append(result, map[string]any{"metric": apiLabels(sample.Labels), "value": apiValue(sample.Timestamp, sample.Value)})
+	}
+
+	return json.Marshal(map[string]any{"resultType": "vector", "result": result})
+}
+
+// MarshalJSON formats the matrix as query result
+func (m Matrix) MarshalJSON() ([]byte, error) {
+	result := make([]map[string]any, 0, len(m))
+	for _, series := range m {
+		values := make([][2]any, 0, len(series.Points))
+		for _, point := range series.Points {
+			values = append(values, apiValue(point.Timestamp, point.Value))
+		}
+		result = append(result, map[string]any{"metric": apiLabels(series.Labels), "values": values})
+	}
+
+	return json.Marshal(map[string]any{"resultType": "matrix", "result": result})
+}
+
+// MarshalJSON formats the scalar as query result
+func (s Scalar) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{"resultType": "scalar", "result": apiValue(time.Time{}, float64(s))})
+}
@@ -0,0 +1,212 @@
+// Package prometheustest provides an in-process fake Prometheus http api to test checks without a real server.
+//
+// The responses of the endpoints and of single queries are configured up front, they can be delayed, fail with api
+// or http errors or contain malformed json. The headers and credentials every request has to carry can be asserted.
+package prometheustest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Paths of the endpoints of the Prometheus http api
+const (
+	QueryPath       = "/api/v1/query"
+	QueryRangePath  = "/api/v1/query_range"
+	TargetsPath     = "/api/v1/targets"
+	AlertsPath      = "/api/v1/alerts"
+	RulesPath       = "/api/v1/rules"
+	BuildInfoPath   = "/api/v1/status/buildinfo"
+	RuntimeInfoPath = "/api/v1/status/runtimeinfo"
+	ConfigPath      = "/api/v1/status/config"
+	FlagsPath       = "/api/v1/status/flags"
+	TSDBPath        = "/api/v1/status/tsdb"
+)
+
+// Response is the answer of the fake server to a request
+type Response struct {
+	// Data is marshalled into the data field of a successful api response, e.g. a Vector or a v1.TargetsResult
+	Data any
+	// Body is sent as is instead of an api response, e.g. to send malformed json
+	Body string
+	// StatusCode of the response, defaults to 200 and to 422 if Error is set
+	StatusCode int
+	// ErrorType and Error turn the response into an api error
+	ErrorType string
+	Error     string
+	// Warnings are added to the api response
+	Warnings []string
+	// Latency delays the response in addition to the Latency of the server
+	Latency time.Duration
+}
+
+// Request is a request received by the fake server
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	// Form contains the url and the form encoded body parameters
+	Form url.Values
+}
+
+// Server is a fake Prometheus serving the configured responses, it is closed when the test ends
+type Server struct {
+	*httptest.Server
+	// Latency delays every response
+	Latency time.Duration
+
+	t         testing.TB
+	mutex     sync.Mutex
+	responses map[string]Response
+	queries   map[string]Response
+	header    http.Header
+	requests  []Request
+}
+
+// NewServer starts a fake Prometheus without any configured responses, requests to unknown endpoints are answered
+// with 404
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{
+		t:         t,
+		responses: map[string]Response{},
+		queries:   map[string]Response{},
+		header:    http.Header{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// URL returns the address of the server as parsed url
+func (s *Server) URL() *url.URL {
+	address, _ := url.Parse(s.Server.URL)
+
+	return address
+}
+
+// Handle answers every request of the path with the response
+func (s *Server) Handle(path string, response Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.responses[path] = response
+}
+
+// HandleQuery answers the instant and range queries of exactly this PromQL expression with the response, other
+// queries are answered by the response of the path
+func (s *Server) HandleQuery(query string, response Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.queries[query] = response
+}
+
+// ExpectHeader fails the test and answers with 401 if a request does not carry the header with the value
+func (s *Server) ExpectHeader(name, value string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.header.Set(name, value)
+}
+
+// ExpectBasicAuth fails the test and answers with 401 if a request is not authorized with the credentials
+func (s *Server) ExpectBasicAuth(username, password string) {
+	request := http.Request{Header: http.Header{}}
+	request.SetBasicAuth(username, password)
+	s.ExpectHeader("Authorization", request.Header.Get("Authorization"))
+}
+
+// ExpectBearerToken fails the test and answers with 401 if a request is not authorized with the token
+func (s *Server) ExpectBearerToken(token string) {
+	s.ExpectHeader("Authorization", "Bearer "+token)
+}
+
+// Requests returns all requests received so far
+func (s *Server) Requests() []Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]Request{}, s.requests...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.t.Errorf("prometheustest: parsing the parameters of %s %s: %s", r.Method, r.URL.Path, err.Error())
+	}
+
+	s.mutex.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Form: r.Form})
+	missing := []string{}
+	for name := range s.header {
+		if r.Header.Get(name) != s.header.Get(name) {
+			missing = append(missing, name)
+		}
+	}
+	response, ok := s.responses[r.URL.Path]
+	if r.URL.Path == QueryPath || r.URL.Path == QueryRangePath {
+		if queryResponse, found := s.queries[r.Form.Get("query")]; found {
+			response, ok = queryResponse, true
+		}
+	}
+	latency := s.Latency + response.Latency
+	s.mutex.Unlock()
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		s.t.Errorf("prometheustest: %s %s is missing the expected headers %s", r.Method, r.URL.Path, strings.Join(missing, ", "))
+		response = Response{StatusCode: http.StatusUnauthorized, ErrorType: "unauthorized", Error: "missing expected headers"}
+	} else if !ok {
+		response = Response{StatusCode: http.StatusNotFound, ErrorType: "not_found", Error: fmt.Sprintf("no response configured for %s", r.URL.Path)}
+	}
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	response.write(s.t, w)
+}
+
+// write sends the response as api response, or the raw body if set
+func (r Response) write(t testing.TB, w http.ResponseWriter) {
+	statusCode := r.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+		if r.Error != "" {
+			statusCode = http.StatusUnprocessableEntity
+		}
+	}
+
+	body := []byte(r.Body)
+	if r.Body == "" {
+		apiResponse := map[string]any{"status": "success", "data": r.Data}
+		if r.Error != "" {
+			apiResponse = map[string]any{"status": "error", "errorType": r.ErrorType, "error": r.Error}
+		}
+		if len(r.Warnings) > 0 {
+			apiResponse["warnings"] = r.Warnings
+		}
+		var err error
+		body, err = json.Marshal(apiResponse)
+		if err != nil {
+			t.Errorf("prometheustest: marshalling the response: %s", err.Error())
+			statusCode = http.StatusInternalServerError
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(body)
+}
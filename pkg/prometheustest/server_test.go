@@ -0,0 +1,154 @@
+package prometheustest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+func newAPI(t *testing.T, s *Server) v1.API {
+	t.Helper()
+	client, err := api.NewClient(api.Config{Address: s.Server.URL})
+	if err != nil {
+		t.Fatalf("creating client: %s", err)
+	}
+
+	return v1.NewAPI(client)
+}
+
+func TestQueries(t *testing.T) {
+	s := NewServer(t)
+	s.Handle(QueryPath, Response{Data: Vector{}})
+	s.HandleQuery("up", Response{Data: Vector{{Labels: map[string]string{"__name__": "up", "job": "node"}, Value: 1}}, Warnings: []string{"partial"}})
+	s.HandleQuery("pi", Response{Data: Scalar(3.14)})
+	s.Handle(QueryRangePath, Response{Data: Matrix{{Labels: map[string]string{"job": "node"}, Points: []Point{{time.Unix(100, 0), 1}, {time.Unix(160, 0), 2}}}}})
+	promAPI := newAPI(t, s)
+
+	result, warnings, err := promAPI.Query(context.Background(), "up", time.Now())
+	if err != nil {
+		t.Fatalf("query returned error: %s", err)
+	}
+	vector := result.(model.Vector)
+	if len(vector) != 1 || vector[0].Value != 1 || vector[0].Metric["job"] != "node" || len(warnings) != 1 {
+		t.Errorf("query up = %s, warnings %v", result, warnings)
+	}
+	if age := time.Since(vector[0].Timestamp.Time()); age < 0 || age > time.Minute {
+		t.Errorf("sample age = %s, want the time of the response", age)
+	}
+
+	result, _, _ = promAPI.Query(context.Background(), "pi", time.Now())
+	if scalar, ok := result.(*model.Scalar); !ok || scalar.Value != 3.14 {
+		t.Errorf("query pi = %s", result)
+	}
+	result, _, _ = promAPI.Query(context.Background(), "other", time.Now())
+	if vector, ok := result.(model.Vector); !ok || len(vector) != 0 {
+		t.Errorf("query other = %s, want the empty vector of the path", result)
+	}
+
+	result, _, err = promAPI.QueryRange(context.Background(), "rate(x[1m])", v1.Range{Start: time.Unix(100, 0), End: time.Unix(160, 0), Step: time.Minute})
+	if matrix, ok := result.(model.Matrix); err != nil || !ok || len(matrix[0].Values) != 2 || matrix[0].Values[1].Value != 2 {
+		t.Errorf("range query = %s, err %v", result, err)
+	}
+
+	requests := s.Requests()
+	if len(requests) != 4 || requests[0].Path != QueryPath || requests[0].Form.Get("query") != "up" {
+		t.Errorf("requests = %+v", requests)
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	s := NewServer(t)
+	s.Handle(TargetsPath, Response{Data: v1.TargetsResult{Active: []v1.ActiveTarget{{Labels: model.LabelSet{"job": "node"}, Health: v1.HealthGood}}}})
+	s.Handle(AlertsPath, Response{Data: v1.AlertsResult{Alerts: []v1.Alert{{Labels: model.LabelSet{"alertname": "Down"}, State: v1.AlertStateFiring}}}})
+	s.Handle(RulesPath, Response{Data: map[string]any{"groups": []any{}}})
+	s.Handle(BuildInfoPath, Response{Data: v1.BuildinfoResult{Version: "3.7.1"}})
+	promAPI := newAPI(t, s)
+
+	targets, err := promAPI.Targets(context.Background())
+	if err != nil || len(targets.Active) != 1 || targets.Active[0].Health != v1.HealthGood {
+		t.Errorf("targets = %+v, err %v", targets, err)
+	}
+	alerts, err := promAPI.Alerts(context.Background())
+	if err != nil || len(alerts.Alerts) != 1 || alerts.Alerts[0].State != v1.AlertStateFiring {
+		t.Errorf("alerts = %+v, err %v", alerts, err)
+	}
+	if _, err := promAPI.Rules(context.Background()); err != nil {
+		t.Errorf("rules returned error: %s", err)
+	}
+	buildInfo, err := promAPI.Buildinfo(context.Background())
+	if err != nil || buildInfo.Version != "3.7.1" {
+		t.Errorf("buildinfo = %+v, err %v", buildInfo, err)
+	}
+	if _, err := promAPI.Flags(context.Background()); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("unconfigured endpoint returned %v", err)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	s := NewServer(t)
+	s.HandleQuery("bad", Response{ErrorType: "bad_data", Error: "parse error"})
+	s.HandleQuery("down", Response{StatusCode: http.StatusServiceUnavailable, Body: "upstream unavailable"})
+	s.HandleQuery("broken", Response{Body: `{"status":"success","data":{"resultType":`})
+	s.HandleQuery("slow", Response{Data: Vector{}, Latency: time.Second})
+	promAPI := newAPI(t, s)
+
+	for query, want := range map[string]string{"bad": "parse error", "down": "503", "broken": "bad_response"} {
+		if _, _, err := promAPI.Query(context.Background(), query, time.Now()); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("query %s returned %v, want %s", query, err, want)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := promAPI.Query(ctx, "slow", time.Now()); err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("slow query returned %v, want a timeout", err)
+	}
+}
+
+func TestExpectHeaders(t *testing.T) {
+	s := NewServer(t)
+	s.Handle(QueryPath, Response{Data: Vector{}})
+	s.ExpectBasicAuth("user", "secret")
+	s.ExpectHeader("X-Scope-OrgID", "tenant")
+
+	client, _ := api.NewClient(api.Config{Address: s.Server.URL, RoundTripper: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		r.SetBasicAuth("user", "secret")
+		r.Header.Set("X-Scope-OrgID", "tenant")
+		return http.DefaultTransport.RoundTrip(r)
+	})})
+	if _, _, err := v1.NewAPI(client).Query(context.Background(), "up", time.Now()); err != nil {
+		t.Errorf("authorized query returned error: %s", err)
+	}
+
+	// A missing header fails the test, it is reported to a fake test instead
+	fake := &fakeTB{TB: t}
+	s.t = fake
+	if _, _, err := newAPI(t, s).Query(context.Background(), "up", time.Now()); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("unauthorized query returned %v", err)
+	}
+	if len(fake.errors) != 1 || !strings.Contains(fake.errors[0], "Authorization, X-Scope-Orgid") {
+		t.Errorf("reported errors = %q", fake.errors)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+type fakeTB struct {
+	testing.TB
+	errors []string
+}
+
+func (f *fakeTB) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}